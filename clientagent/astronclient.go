@@ -43,7 +43,7 @@ func (c *Client) init(config core.Role, conn gonet.Conn) {
 	c.client = net.NewClient(socket, c, time.Duration(config.Client.Keepalive)*time.Second)
 
 	if !c.client.Local() {
-		event := eventlogger.NewLoggedEvent("client-connected", "")
+		event := eventlogger.NewLoggedEvent(eventlogger.EVENT_CLIENT_CONNECTED, "")
 		event.Add("remote_address", conn.RemoteAddr().String())
 		event.Add("local_address", conn.LocalAddr().String())
 		c.logEvent(event)
@@ -67,14 +67,16 @@ func (c *Client) receiveDisconnect(err error) {
 	defer c.lock.Unlock()
 
 	if !c.cleanDisconnect && !c.client.Local() {
-		event := eventlogger.NewLoggedEvent("client-lost", "")
+		event := eventlogger.NewLoggedEvent(eventlogger.EVENT_CLIENT_LOST, "")
 		event.Add("remote_address", c.conn.RemoteAddr().String())
 		event.Add("local_address", c.conn.LocalAddr().String())
 		event.Add("reason", err.Error())
-		event.Send()
+		c.logEvent(event)
 	}
 
-	c.heartbeat.Stop()
+	if c.heartbeat != nil {
+		c.heartbeat.Stop()
+	}
 	c.annihilate()
 }
 
@@ -96,8 +98,14 @@ func (c *Client) ReceiveDatagram(dg Datagram) {
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				if _, ok := r.(DatagramIteratorEOF); ok {
+				switch r := r.(type) {
+				case DatagramIteratorEOF:
 					c.sendDisconnect(CLIENT_DISCONNECT_TRUNCATED_DATAGRAM, "Datagram unexpectedly ended while iterating.", false)
+				case FieldConstraintViolation:
+					event := eventlogger.NewLoggedEvent(eventlogger.EVENT_FIELD_VIOLATION, "")
+					event.Add("reason", r.Error())
+					c.logEvent(event)
+					c.sendDisconnect(CLIENT_DISCONNECT_FIELD_CONSTRAINT, r.Error(), true)
 				}
 				finish <- true
 			}
@@ -132,30 +140,30 @@ func (c *Client) handleIntroduction(dgi *DatagramIterator) {
 	hash := dgi.ReadUint32()
 	version := dgi.ReadString()
 
-	if version != c.ca.config.Version {
+	if version != c.config.Version {
 		c.sendDisconnect(CLIENT_DISCONNECT_BAD_VERSION,
-			fmt.Sprintf("Client version mismatch: client=%s, server=%s", version, c.cc.config.Version), false)
+			fmt.Sprintf("Client version mismatch: client=%s, server=%s", version, c.config.Version), false)
 	}
 
-	if hash != core.Hash {
+	if current := core.Current().Hash; hash != current {
 		c.sendDisconnect(CLIENT_DISCONNECT_BAD_VERSION,
-			fmt.Sprintf("Client DC hash mismatch: client=0x%x, server=0x%x", hash, core.Hash), false)
+			fmt.Sprintf("Client DC hash mismatch: client=0x%x, server=0x%x", hash, current), false)
 	}
 
 	resp := NewDatagram()
 	resp.AddUint16(CLIENT_HELLO_RESP)
 	c.client.SendDatagram(resp)
 
-	c.state = CLIENT_STATE_ANONYMOUS
+	c.setState(CLIENT_STATE_ANONYMOUS)
 }
 
 func (c *Client) handleAuthentication(dgi *DatagramIterator) {
 	msgType := dgi.ReadUint16()
 	switch msgType {
 	case CLIENT_DISCONNECT:
-		event := eventlogger.NewLoggedEvent("client-disconnected", "")
-		event.Add("who", c.conn.RemoteAddr().String())
-		event.Send()
+		event := eventlogger.NewLoggedEvent(eventlogger.EVENT_CLIENT_DISCONNECTED, "")
+		event.Add("remote_address", c.conn.RemoteAddr().String())
+		c.logEvent(event)
 
 		c.cleanDisconnect = true
 		c.client.Close()
@@ -173,9 +181,9 @@ func (c *Client) handleAuthenticated(dgi *DatagramIterator) {
 	msgType := dgi.ReadUint16()
 	switch msgType {
 	case CLIENT_DISCONNECT:
-		event := eventlogger.NewLoggedEvent("client-disconnected", "")
-		event.Add("who", c.conn.RemoteAddr().String())
-		event.Send()
+		event := eventlogger.NewLoggedEvent(eventlogger.EVENT_CLIENT_DISCONNECTED, "")
+		event.Add("remote_address", c.conn.RemoteAddr().String())
+		c.logEvent(event)
 
 		c.cleanDisconnect = true
 		c.client.Close()
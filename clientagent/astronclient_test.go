@@ -38,8 +38,8 @@ func connectClient() (*net.Client, error) {
 
 	participant := &MDParticipantFake{}
 	socket := net.NewSocketTransport(conn, 60*time.Second, 4096)
-	client := net.NewClient(socket, participant)
-	participant.Init()
+	client := net.NewClient(socket, participant, 60*time.Second)
+	participant.Init(participant)
 	return client, nil
 }
 
@@ -52,6 +52,7 @@ func init() {
 		core.Config = &core.ServerConfig{MessageDirector: struct {
 			Bind    string
 			Connect string
+			Capture string
 		}{Bind: "127.0.0.1:7199", Connect: ""}}
 		messagedirector.Start()
 	}
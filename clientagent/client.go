@@ -5,6 +5,7 @@ import (
 	"astrongo/dclass/dc"
 	"astrongo/eventlogger"
 	"astrongo/messagedirector"
+	"astrongo/metrics"
 	"astrongo/net"
 	. "astrongo/util"
 	"fmt"
@@ -22,6 +23,27 @@ const (
 	CLIENT_STATE_ESTABLISHED
 )
 
+func (s ClientState) String() string {
+	switch s {
+	case CLIENT_STATE_NEW:
+		return "new"
+	case CLIENT_STATE_ANONYMOUS:
+		return "anonymous"
+	case CLIENT_STATE_ESTABLISHED:
+		return "established"
+	}
+	return fmt.Sprintf("unknown (%d)", int(s))
+}
+
+var (
+	connectedClients = metrics.NewGauge("astron_clientagent_clients",
+		"Number of clients connected to the ClientAgent.", "state")
+	pendingInterests = metrics.NewGauge("astron_clientagent_interests_pending",
+		"Number of interest operations waiting for objects to arrive.", "")
+	interestTimeouts = metrics.NewCounter("astron_clientagent_interest_timeouts_total",
+		"Number of interest operations that were forced to finish after timing out.", "")
+)
+
 type DeclaredObject struct {
 	do Doid_t
 	dc *dc.Class
@@ -91,10 +113,13 @@ type Client struct {
 	finish           chan bool
 }
 
-func (c *Client) NewClient(config core.Role, ca *ClientAgent, conn gonet.Conn) *Client {
+// NewAstronClient sets up a client for a connection accepted by the client agent, allocating it a
+//  channel from the range of the agent.
+func NewAstronClient(config core.Role, ca *ClientAgent, conn gonet.Conn) *Client {
 	client := &Client{
 		config:           config,
 		ca:               ca,
+		conn:             conn,
 		visibleObjects:   make(map[Doid_t]VisibleObject),
 		declaredObjects:  make(map[Doid_t]DeclaredObject),
 		ownedObjects:     make(map[Doid_t]OwnedObject),
@@ -104,39 +129,46 @@ func (c *Client) NewClient(config core.Role, ca *ClientAgent, conn gonet.Conn) *
 		sendableFields:   make(map[Doid_t][]uint16),
 	}
 
-	client.init(config, conn)
-	client.Init(c)
-
+	client.Init(client)
 	client.allocatedChannel = ca.Allocate()
-	if client.allocatedChannel == 0 {
-		c.sendDisconnect(CLIENT_DISCONNECT_GENERIC, "Client capacity reached", false)
-		return nil
-	}
 	client.channel = client.allocatedChannel
-
 	client.log = log.WithFields(log.Fields{
 		"name": fmt.Sprintf("Client (%d)", client.channel),
 	})
 
+	client.init(config, conn)
+	if client.allocatedChannel == 0 {
+		client.sendDisconnect(CLIENT_DISCONNECT_GENERIC, "Client capacity reached", false)
+		return nil
+	}
+	ca.addClient(client)
+
 	client.SubscribeChannel(client.channel)
 	client.SubscribeChannel(BCHAN_CLIENTS)
+	connectedClients.Inc(client.state.String())
 
 	return client
 }
 
+func (c *Client) setState(state ClientState) {
+	connectedClients.Dec(c.state.String())
+	connectedClients.Inc(state.String())
+	c.state = state
+}
+
 func (c *Client) sendDisconnect(reason uint16, error string, security bool) {
 	// TODO: Implement security loglevel
 	var eventType string
 	if security {
-		c.log.Errorf("[SECURITY] Ejecting client (%s): %s", reason, error)
-		eventType = "client-ejected-security"
+		c.log.Errorf("[SECURITY] Ejecting client (%d): %s", reason, error)
+		eventType = eventlogger.EVENT_CLIENT_EJECTED_SECURITY
 	} else {
-		c.log.Errorf("Ejecting client (%s): %s", reason, error)
-		eventType = "client-ejected"
+		c.log.Errorf("Ejecting client (%d): %s", reason, error)
+		eventType = eventlogger.EVENT_CLIENT_EJECTED
 	}
 
 	event := eventlogger.NewLoggedEvent(eventType, "")
-	event.Add("reason_code", string(reason))
+	event.AddUint("reason_code", uint64(reason))
 	event.Add("reason_msg", error)
 	c.logEvent(event)
 
@@ -154,6 +186,7 @@ func (c *Client) sendDisconnect(reason uint16, error string, security bool) {
 
 func (c *Client) logEvent(event eventlogger.LoggedEvent) {
 	event.Add("sender", fmt.Sprintf("Client: %d", c.channel))
+	event.AddChannel("channel", c.channel)
 	event.Send()
 }
 
@@ -165,7 +198,12 @@ func (c *Client) annihilate() {
 		return
 	}
 
-	c.ca.Tracker.free(c.channel)
+	// Clients turned away at capacity were never given a channel nor added to the agent
+	if c.allocatedChannel != 0 {
+		c.ca.Tracker.free(c.channel)
+		c.ca.removeClient(c)
+		connectedClients.Dec(c.state.String())
+	}
 
 	// Delete all session object
 	for len(c.sessionObjects) > 0 {
@@ -333,9 +371,10 @@ func (c *Client) historicalObject(do Doid_t) bool {
 
 func (c *Client) lookupObject(do Doid_t) *dc.Class {
 	// Search UberDOGs
-	for i := range core.Uberdogs {
-		if core.Uberdogs[i].Id == do {
-			return core.Uberdogs[i].Class
+	uberdogs := core.Current().Uberdogs
+	for i := range uberdogs {
+		if uberdogs[i].Id == do {
+			return uberdogs[i].Class
 		}
 	}
 
@@ -391,7 +430,7 @@ func (c *Client) handleObjectEntrance(dgi *DatagramIterator, other bool) {
 	}
 
 	if _, ok := c.visibleObjects[do]; !ok {
-		cls, _ := core.DC.Class(int(dc))
+		cls, _ := core.Current().DC.Class(int(dc))
 		c.visibleObjects[do] = VisibleObject{
 			DeclaredObject: DeclaredObject{
 				do: do,
@@ -422,6 +461,10 @@ func (c *Client) HandleDatagram(dg Datagram, dgi *DatagramIterator) {
 	c.Lock()
 	defer c.Unlock()
 
+	if core.TraceEnabled() {
+		core.TraceDatagram(fmt.Sprintf("Client (%d)", c.channel), dg)
+	}
+
 	sender := dgi.ReadChannel()
 	msgType := dgi.ReadUint16()
 	if sender == c.channel {
@@ -435,7 +478,7 @@ func (c *Client) HandleDatagram(dg Datagram, dgi *DatagramIterator) {
 	case CLIENTAGENT_DROP:
 		c.handleDrop()
 	case CLIENTAGENT_SET_STATE:
-		c.state = ClientState(dgi.ReadUint16())
+		c.setState(ClientState(dgi.ReadUint16()))
 	case CLIENTAGENT_ADD_INTEREST:
 		c.context++
 		int := c.buildInterest(dgi, false)
@@ -477,7 +520,7 @@ func (c *Client) HandleDatagram(dg Datagram, dgi *DatagramIterator) {
 			return
 		}
 
-		cls, _ := core.DC.Class(int(dc))
+		cls, _ := core.Current().DC.Class(int(dc))
 		c.declaredObjects[do] = DeclaredObject{
 			do: do,
 			dc: cls,
@@ -603,7 +646,7 @@ func (c *Client) HandleDatagram(dg Datagram, dgi *DatagramIterator) {
 		do, parent, zone, dc := dgi.ReadDoid(), dgi.ReadDoid(), dgi.ReadZone(), dgi.ReadUint16()
 
 		if _, ok := c.ownedObjects[do]; !ok {
-			cls, _ := core.DC.Class(int(dc))
+			cls, _ := core.Current().DC.Class(int(dc))
 			c.ownedObjects[do] = OwnedObject{
 				DeclaredObject: DeclaredObject{
 					do: do,
@@ -669,11 +712,14 @@ func NewInterestOperation(client *Client, timeout int, interestId uint16,
 		callers:        []Channel_t{caller},
 	}
 
+	pendingInterests.Inc("")
+
 	// Timeout
 	go func() {
 		time.Sleep(time.Duration(timeout) * time.Second)
 		if !iop.finished {
 			client.log.Warnf("Interest operation timed out; forcing")
+			interestTimeouts.Inc("")
 			iop.finish()
 		}
 	}()
@@ -710,6 +756,7 @@ func (i *InterestOperation) finish() {
 	close(i.generateQueue)
 	close(i.pendingQueue)
 	i.finished = true
+	pendingInterests.Dec("")
 
 	for generate := range i.generateQueue {
 		dgi := NewDatagramIterator(&generate)
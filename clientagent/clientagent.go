@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"github.com/apex/log"
 	gonet "net"
+	"sync"
 )
 
 type ChannelTracker struct {
@@ -24,8 +25,10 @@ type ClientAgent struct {
 	config  core.Role
 	log     *log.Entry
 
-	rng             messagedirector.Range
-	interestTimeout int
+	rng messagedirector.Range
+
+	clients     map[Channel_t]*Client
+	clientsLock sync.Mutex
 }
 
 func NewChannelTracker(min Channel_t, max Channel_t, log *log.Entry) *ChannelTracker {
@@ -52,7 +55,8 @@ func (c *ChannelTracker) free(ch Channel_t) {
 
 func NewClientAgent(config core.Role) *ClientAgent {
 	ca := &ClientAgent{
-		config: config,
+		config:  config,
+		clients: make(map[Channel_t]*Client),
 		log: log.WithFields(log.Fields{
 			"name": fmt.Sprintf("ClientAgent (%s)", config.Bind),
 		}),
@@ -65,8 +69,6 @@ func NewClientAgent(config core.Role) *ClientAgent {
 		return nil
 	}
 
-	ca.interestTimeout = config.Tuning.Interest_Timeout
-
 	ca.Handler = ca
 	errChan := make(chan error)
 	go func() {
@@ -85,9 +87,58 @@ func NewClientAgent(config core.Role) *ClientAgent {
 func (c *ClientAgent) HandleConnect(conn gonet.Conn) {
 	// NOTE: AstronGo will not support multiple client types.
 	c.log.Debugf("Incoming connection from %s", conn.RemoteAddr())
-	NewAstronClient(c.config, c, conn)
+
+	c.clientsLock.Lock()
+	config := c.config
+	c.clientsLock.Unlock()
+	NewAstronClient(config, c, conn)
+}
+
+// Reconfigure applies the client settings and tuning of a reloaded role. Connected clients keep the
+//  settings they were created with; only new connections are affected.
+func (c *ClientAgent) Reconfigure(config core.Role) {
+	c.clientsLock.Lock()
+	defer c.clientsLock.Unlock()
+
+	c.config.Version = config.Version
+	c.config.Client = config.Client
+	c.config.Tuning = config.Tuning
+	c.log.Info("Applied reloaded configuration")
 }
 
 func (c *ClientAgent) Allocate() Channel_t {
 	return c.Tracker.alloc()
 }
+
+func (c *ClientAgent) addClient(client *Client) {
+	c.clientsLock.Lock()
+	c.clients[client.allocatedChannel] = client
+	c.clientsLock.Unlock()
+}
+
+func (c *ClientAgent) removeClient(client *Client) {
+	c.clientsLock.Lock()
+	delete(c.clients, client.allocatedChannel)
+	c.clientsLock.Unlock()
+}
+
+// Shutdown stops accepting new connections and ejects every connected client; each client is
+//  annihilated as it is ejected so that its session objects are deleted and post-removes are routed.
+func (c *ClientAgent) Shutdown(reason string) {
+	c.NetworkServer.Shutdown()
+
+	c.clientsLock.Lock()
+	clients := make([]*Client, 0, len(c.clients))
+	for _, client := range c.clients {
+		clients = append(clients, client)
+	}
+	c.clientsLock.Unlock()
+
+	c.log.Infof("Ejecting %d clients for shutdown", len(clients))
+	for _, client := range clients {
+		client.lock.Lock()
+		client.sendDisconnect(CLIENT_DISCONNECT_SHUTDOWN, reason, false)
+		client.lock.Unlock()
+		client.annihilate()
+	}
+}
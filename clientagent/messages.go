@@ -35,4 +35,5 @@ const (
 	CLIENT_DISCONNECT_BAD_DCHASH             = 125
 	CLIENT_DISCONNECT_FIELD_CONSTRAINT       = 127
 	CLIENT_DISCONNECT_SESSION_OBJECT_DELETED = 153
+	CLIENT_DISCONNECT_SHUTDOWN               = 154
 )
@@ -6,12 +6,39 @@ import (
 	"errors"
 	"fmt"
 	"github.com/spf13/viper"
+	"sync"
 )
 
 var Config *ServerConfig
 var Hash uint32
 var StopChan chan bool // For test purposes
 
+// State is the configuration of the daemon along with the DC file it is running, which are replaced
+//  together when the daemon is reloaded. Roles read them through Current once they are running.
+type State struct {
+	Config   *ServerConfig
+	DC       *dc.File
+	Hash     uint32
+	Uberdogs []Uberdog
+}
+
+var stateLock sync.RWMutex
+
+// Current returns the configuration and DC file the daemon is running with, as last published.
+func Current() State {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+	return State{Config: Config, DC: DC, Hash: Hash, Uberdogs: Uberdogs}
+}
+
+// Publish replaces the configuration and DC file of the daemon at once, so that roles never see the
+//  configuration of one reload alongside the DC file of another.
+func Publish(state State) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	Config, DC, Hash, Uberdogs = state.Config, state.DC, state.Hash, state.Uberdogs
+}
+
 type Uberdog struct {
 	Anonymous bool
 	Id        util.Doid_t
@@ -23,8 +50,10 @@ var Uberdogs []Uberdog
 type Role struct {
 	Type string
 
+	// CLIENT and EVENTLOGGER
+	Bind string
+
 	// CLIENT
-	Bind    string
 	Version string
 	Tuning  struct {
 		Interest_Timeout int
@@ -45,12 +74,23 @@ type Role struct {
 	Control int
 }
 
+// EventSink is a destination which receives a copy of the event log, besides the log file itself.
+type EventSink struct {
+	Type    string   // file, stdout, tcp or unix
+	Path    string   // FILE
+	Address string   // TCP and UNIX
+	Types   []string // Event types written to the sink; every type if empty
+	Buffer  int      // Events queued for the sink before further ones are dropped
+}
+
 type ServerConfig struct {
 	Daemon struct {
-		Name string
+		Name             string
+		Loglevel         string
+		Shutdown_Timeout int
 	}
 	General struct {
-		Eventlogger string
+		Eventlogger string // Address of the event logger to forward events to, if there is no eventlogger role
 		DC_Files    []string
 	}
 	Uberdogs []struct {
@@ -61,11 +101,24 @@ type ServerConfig struct {
 	MessageDirector struct {
 		Bind    string
 		Connect string
+		Capture string // File which every routed datagram is written to
 	}
 	Eventlogger struct {
 		Bind   string
 		Output string `"`
+		Rotate struct {
+			Size      int // Megabytes written before the log is rotated
+			Interval  int // Seconds after which the log is rotated
+			Compress  bool
+			Max_Files int // Number of closed logs which are kept
+			Max_Age   int // Hours after which closed logs are deleted
+		}
+		Sinks []EventSink
+	}
+	Metrics struct {
+		Bind string
 	}
+	Trace TraceConfig
 	Roles []Role
 }
 
@@ -76,15 +129,44 @@ func LoadConfig(path string, name string) (err error) {
 	viper.AddConfigPath(path)
 	viper.SetConfigName(name)
 
+	conf, err := ReadConfig()
+	if err != nil {
+		return err
+	}
+
+	Config = conf
+	return nil
+}
+
+// ReadConfig (re-)reads the configuration file located by LoadConfig without applying it.
+func ReadConfig() (*ServerConfig, error) {
 	if err := viper.ReadInConfig(); err != nil {
-		return errors.New(fmt.Sprintf("Unable to load configuration file: %v", err))
+		return nil, errors.New(fmt.Sprintf("Unable to load configuration file: %v", err))
 	}
 
 	conf := &ServerConfig{}
 	if err := viper.Unmarshal(conf); err != nil {
-		return errors.New(fmt.Sprintf("Unable to decode configuration file: %v", err))
+		return nil, errors.New(fmt.Sprintf("Unable to decode configuration file: %v", err))
 	}
 
-	Config = conf
-	return nil
+	return conf, nil
+}
+
+// LoadUberdogs resolves the UberDOG list of the given configuration against the given DC file.
+func LoadUberdogs(conf *ServerConfig, file *dc.File) ([]Uberdog, error) {
+	var uberdogs []Uberdog
+	for _, ud := range conf.Uberdogs {
+		class, ok := file.ClassByName(ud.Class)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("For UberDOG %d, class %s does not exist!", ud.ID, ud.Class))
+		}
+
+		uberdogs = append(uberdogs, Uberdog{
+			Anonymous: ud.Anonymous,
+			Id:        util.Doid_t(ud.ID),
+			Class:     class,
+		})
+	}
+
+	return uberdogs, nil
 }
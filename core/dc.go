@@ -3,38 +3,29 @@ package core
 import (
 	"astrongo/dclass/dc"
 	"astrongo/dclass/parse"
-	"errors"
-	"fmt"
-	"io/ioutil"
-	"strings"
 )
 
 var DC *dc.File
 
 func LoadDC() (err error) {
-	var configs []string
-
-	for _, conf := range Config.General.DC_Files {
-		data, err := ioutil.ReadFile(conf)
-		if err != nil {
-			return errors.New(fmt.Sprintf("Failed to read DC file %s: %v", conf, err))
-		}
-
-		configs = append(configs, string(data))
-	}
-
-	dctree, err := parse.ParseString(strings.Join(configs, "\n"))
+	file, err := ReadDC(Config.General.DC_Files)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Error while parsing DC file: %v", err))
+		return err
 	}
 
-	err = nil
-	defer func() {
-		if r := recover(); r != nil {
-			err = errors.New(fmt.Sprintf("Error while traversing DC file: %v", r))
-		}
-	}()
+	DC = file
+	return nil
+}
+
+// ReadDC parses and traverses the given DC files without replacing the loaded DC. If the files contain
+//  mistakes, the error is a parse.ErrorList giving the file, line and column of each one.
+func ReadDC(files []string) (file *dc.File, err error) {
+	return parse.ParseFiles(files...)
+}
 
-	DC = dctree.Traverse()
-	return err
+// ComputeHash returns the hash of a DC file as sent by clients in CLIENT_HELLO.
+func ComputeHash(file *dc.File) uint32 {
+	hasher := dc.NewHashGenerator()
+	file.GenerateHash(hasher)
+	return hasher.Hash()
 }
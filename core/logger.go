@@ -68,13 +68,16 @@ func (h *MultiHandler) HandleLog(e *log.Entry) error {
 type Handler struct {
 	mu     sync.Mutex
 	Writer io.Writer
+
+	colored bool // Set when writing to a terminal through colorable
 }
 
 // New handler.
 func NewLogger(w io.Writer) *Handler {
 	if f, ok := w.(*os.File); ok {
 		return &Handler{
-			Writer: colorable.NewColorable(f),
+			Writer:  colorable.NewColorable(f),
+			colored: true,
 		}
 	}
 
@@ -93,7 +96,7 @@ func (h *Handler) HandleLog(e *log.Entry) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if _, ok := h.Writer.(*colorable.Writer); ok {
+	if h.colored {
 		grey.Fprintf(h.Writer, "[%s] ", t.Format("2006-01-02 01:02:03"))
 		color.Fprintf(h.Writer, bold.Sprintf("%*s: ", 1, level))
 	} else {
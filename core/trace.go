@@ -0,0 +1,176 @@
+package core
+
+import (
+	"astrongo/dclass/dc"
+	"astrongo/util"
+	"fmt"
+	"github.com/apex/log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Traced datagrams are forgotten after this period; any hop that handles a datagram later than
+//  this will be logged with a fresh trace ID.
+const TRACE_EXPIRY = 10 * time.Second
+
+var TraceLog *log.Entry
+
+var traceCounter uint32
+var traceIds sync.Map
+
+type TraceConfig struct {
+	Enabled    bool
+	Senders    []uint64
+	Recipients []uint64
+	Msgtypes   []uint16
+}
+
+// TraceEnabled reports whether datagrams are being traced, so that hops can skip building their
+//  labels otherwise.
+func TraceEnabled() bool {
+	config := Current().Config
+	return config != nil && config.Trace.Enabled
+}
+
+// TraceDatagram logs a server datagram at the given hop if it matches the trace filter configured in
+//  ServerConfig. Every hop that handles the same datagram shares the trace ID assigned at the first hop,
+//  which allows an update to be followed from the MD through the StateServer and into a client.
+func TraceDatagram(hop string, dg util.Datagram) {
+	state := Current()
+	if state.Config == nil || !state.Config.Trace.Enabled || dg.Buffer == nil {
+		return
+	}
+
+	defer func() {
+		// Malformed datagrams are handled (and logged) by their recipients; we only care about valid ones.
+		recover()
+	}()
+
+	dgi := util.NewDatagramIterator(&dg)
+	var recipients []util.Channel_t
+	count := dgi.ReadUint8()
+	for n := 0; n < int(count); n++ {
+		recipients = append(recipients, dgi.ReadChannel())
+	}
+
+	if count == 1 && recipients[0] == util.CONTROL_MESSAGE {
+		return
+	}
+
+	sender := dgi.ReadChannel()
+	msgType := dgi.ReadUint16()
+	if !state.Config.Trace.matches(sender, recipients, msgType) {
+		return
+	}
+
+	TraceLog.Infof("[%08x] %s: sender=%d recipients=%v msgtype=%d%s",
+		traceId(dg), hop, sender, recipients, msgType, describePayload(state.DC, msgType, dgi))
+}
+
+func (t TraceConfig) matches(sender util.Channel_t, recipients []util.Channel_t, msgType uint16) bool {
+	if len(t.Senders) == 0 && len(t.Recipients) == 0 && len(t.Msgtypes) == 0 {
+		return true
+	}
+
+	for _, ch := range t.Senders {
+		if util.Channel_t(ch) == sender {
+			return true
+		}
+	}
+
+	for _, ch := range t.Recipients {
+		for _, recv := range recipients {
+			if util.Channel_t(ch) == recv {
+				return true
+			}
+		}
+	}
+
+	for _, msg := range t.Msgtypes {
+		if msg == msgType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Datagrams are routed by value, but every copy shares the same underlying buffer; thus, the buffer
+//  is used to identify a datagram as it travels through the daemon.
+func traceId(dg util.Datagram) uint32 {
+	if id, ok := traceIds.Load(dg.Buffer); ok {
+		return id.(uint32)
+	}
+
+	id := atomic.AddUint32(&traceCounter, 1)
+	if existing, loaded := traceIds.LoadOrStore(dg.Buffer, id); loaded {
+		return existing.(uint32)
+	}
+
+	buffer := dg.Buffer
+	time.AfterFunc(TRACE_EXPIRY, func() {
+		traceIds.Delete(buffer)
+	})
+	return id
+}
+
+func describePayload(file *dc.File, msgType uint16, dgi *util.DatagramIterator) string {
+	if file == nil {
+		return ""
+	}
+
+	switch msgType {
+	case util.STATESERVER_OBJECT_SET_FIELD:
+		do := dgi.ReadDoid()
+		return fmt.Sprintf(" do=%d field=%s", do, fieldName(file, dgi.ReadUint16()))
+	case util.STATESERVER_OBJECT_SET_FIELDS:
+		var names []string
+		do := dgi.ReadDoid()
+		count := dgi.ReadUint16()
+		for n := 0; n < int(count); n++ {
+			id := dgi.ReadUint16()
+			names = append(names, fieldName(file, id))
+			if field, ok := file.Field(int(id)); ok {
+				dgi.SkipField(*field)
+			} else {
+				break
+			}
+		}
+		return fmt.Sprintf(" do=%d fields=%s", do, strings.Join(names, ","))
+	case util.STATESERVER_OBJECT_ENTER_INTEREST_WITH_REQUIRED,
+		util.STATESERVER_OBJECT_ENTER_INTEREST_WITH_REQUIRED_OTHER:
+		dgi.ReadUint32() // Context
+		fallthrough
+	case util.STATESERVER_CREATE_OBJECT_WITH_REQUIRED,
+		util.STATESERVER_CREATE_OBJECT_WITH_REQUIRED_OTHER,
+		util.STATESERVER_OBJECT_ENTER_LOCATION_WITH_REQUIRED,
+		util.STATESERVER_OBJECT_ENTER_LOCATION_WITH_REQUIRED_OTHER,
+		util.STATESERVER_OBJECT_ENTER_AI_WITH_REQUIRED,
+		util.STATESERVER_OBJECT_ENTER_AI_WITH_REQUIRED_OTHER,
+		util.STATESERVER_OBJECT_ENTER_OWNER_WITH_REQUIRED,
+		util.STATESERVER_OBJECT_ENTER_OWNER_WITH_REQUIRED_OTHER:
+		do, parent, zone, id := dgi.ReadDoid(), dgi.ReadDoid(), dgi.ReadZone(), dgi.ReadUint16()
+		dclass := fmt.Sprintf("<unknown dclass %d>", id)
+		if cls, ok := file.Class(int(id)); ok {
+			dclass = cls.Name()
+		}
+		return fmt.Sprintf(" do=%d location=(%d, %d) dclass=%s", do, parent, zone, dclass)
+	}
+
+	return ""
+}
+
+func fieldName(file *dc.File, id uint16) string {
+	if field, ok := file.Field(int(id)); ok {
+		return (*field).Name()
+	}
+	return fmt.Sprintf("<unknown field %d>", id)
+}
+
+func init() {
+	TraceLog = log.WithFields(log.Fields{
+		"name": "Trace",
+	})
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	. "astrongo/util"
+	"github.com/apex/log"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// traceLines captures the lines logged by the tracer.
+type traceLines struct {
+	sync.Mutex
+	lines []string
+}
+
+func (t *traceLines) HandleLog(e *log.Entry) error {
+	t.Lock()
+	defer t.Unlock()
+	t.lines = append(t.lines, e.Message)
+	return nil
+}
+
+func (t *traceLines) take() []string {
+	t.Lock()
+	defer t.Unlock()
+	lines := t.lines
+	t.lines = nil
+	return lines
+}
+
+func setTrace(t *testing.T, trace TraceConfig) *traceLines {
+	file, err := ReadDC([]string{"dclass/parse/test.dc"})
+	require.NoError(t, err)
+
+	conf := &ServerConfig{}
+	conf.Trace = trace
+	Publish(State{Config: conf, DC: file})
+
+	lines := &traceLines{}
+	log.SetHandler(lines)
+	return lines
+}
+
+func TestTraceConfig_Matches(t *testing.T) {
+	recipients := []Channel_t{1000, 2000}
+
+	// An empty filter matches everything
+	require.True(t, TraceConfig{}.matches(5, recipients, 1))
+
+	require.True(t, TraceConfig{Senders: []uint64{5}}.matches(5, recipients, 1))
+	require.False(t, TraceConfig{Senders: []uint64{6}}.matches(5, recipients, 1))
+	require.True(t, TraceConfig{Recipients: []uint64{2000}}.matches(5, recipients, 1))
+	require.False(t, TraceConfig{Recipients: []uint64{3000}}.matches(5, recipients, 1))
+	require.True(t, TraceConfig{Msgtypes: []uint16{1}}.matches(5, recipients, 1))
+	require.False(t, TraceConfig{Msgtypes: []uint16{2}}.matches(5, recipients, 1))
+
+	// Any of the criteria is enough
+	require.True(t, TraceConfig{Senders: []uint64{6}, Msgtypes: []uint16{1}}.matches(5, recipients, 1))
+}
+
+func TestTraceDatagram_Filter(t *testing.T) {
+	lines := setTrace(t, TraceConfig{Enabled: true, Senders: []uint64{5}})
+	require.True(t, TraceEnabled())
+
+	dg := NewDatagram()
+	dg.AddServerHeader(1000, 5, STATESERVER_OBJECT_SET_FIELD)
+	dg.AddDoid(1234)
+	dg.AddUint16(0)
+	TraceDatagram("MD", dg)
+
+	other := NewDatagram()
+	other.AddServerHeader(1000, 6, STATESERVER_OBJECT_SET_FIELD)
+	TraceDatagram("MD", other)
+
+	control := NewDatagram()
+	control.AddControlHeader(CONTROL_ADD_CHANNEL)
+	control.AddChannel(5)
+	TraceDatagram("MD", control)
+
+	traced := lines.take()
+	require.Len(t, traced, 1)
+	require.Contains(t, traced[0], "MD: sender=5 recipients=[1000]")
+	require.Contains(t, traced[0], "do=1234 field=setRequired1")
+
+	// Nothing is traced once tracing is disabled
+	setTrace(t, TraceConfig{Senders: []uint64{5}})
+	require.False(t, TraceEnabled())
+	TraceDatagram("MD", dg)
+	require.Empty(t, lines.take())
+}
+
+func TestTraceDatagram_Propagation(t *testing.T) {
+	lines := setTrace(t, TraceConfig{Enabled: true})
+
+	dg := NewDatagram()
+	dg.AddServerHeader(1000, 5, STATESERVER_OBJECT_DELETE_RAM)
+	dg.AddDoid(1234)
+
+	other := NewDatagram()
+	other.AddServerHeader(1000, 5, STATESERVER_OBJECT_DELETE_RAM)
+	other.AddDoid(1234)
+
+	// Copies of a datagram share their trace ID at every hop, while other datagrams get their own
+	copied := dg
+	TraceDatagram("MD", dg)
+	TraceDatagram("ChannelMap -> Client", copied)
+	TraceDatagram("MD", other)
+
+	traced := lines.take()
+	require.Len(t, traced, 3)
+	id := func(line string) string {
+		return line[:strings.Index(line, "]")+1]
+	}
+	require.Equal(t, id(traced[0]), id(traced[1]))
+	require.NotEqual(t, id(traced[0]), id(traced[2]))
+	require.Equal(t, traceId(dg), traceId(copied))
+}
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"astrongo/dclass/parse"
+	"astrongo/util"
+	"fmt"
+	"github.com/spf13/viper"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var reservedChannels = []struct {
+	channel util.Channel_t
+	name    string
+}{
+	{util.CONTROL_MESSAGE, "CONTROL_MESSAGE"},
+	{util.BCHAN_CLIENTS, "BCHAN_CLIENTS"},
+	{util.BCHAN_STATESERVERS, "BCHAN_STATESERVERS"},
+	{util.BCHAN_DBSERVERS, "BCHAN_DBSERVERS"},
+}
+
+var validLoglevels = []string{"debug", "info", "warning", "error", "fatal"}
+
+// A channel (or range of channels) claimed by part of the configuration.
+type channelClaim struct {
+	owner    string
+	min, max util.Channel_t
+}
+
+// ValidateConfig checks the configuration file last read by LoadConfig or ReadConfig for mistakes which
+//  would otherwise go unnoticed until runtime. Every problem found is returned; an empty result means
+//  that the configuration is valid.
+func ValidateConfig(conf *ServerConfig) []string {
+	return validateConfig(conf, viper.AllSettings())
+}
+
+func validateConfig(conf *ServerConfig, settings map[string]interface{}) []string {
+	problems := unknownKeys("", settings, reflect.TypeOf(*conf))
+
+	if conf.Daemon.Loglevel != "" && !contains(validLoglevels, conf.Daemon.Loglevel) {
+		problems = append(problems, fmt.Sprintf("daemon.loglevel: unknown log level %q (expected one of %s)",
+			conf.Daemon.Loglevel, strings.Join(validLoglevels, ", ")))
+	}
+
+	// DC files and UberDOG classes
+	dcExists := len(conf.General.DC_Files) != 0
+	if !dcExists {
+		problems = append(problems, "general.dc_files: no DC files are configured")
+	}
+	for _, file := range conf.General.DC_Files {
+		if _, err := os.Stat(file); err != nil {
+			problems = append(problems, fmt.Sprintf("general.dc_files: cannot read DC file %s: %v", file, err))
+			dcExists = false
+		}
+	}
+
+	if dcExists {
+		if file, err := ReadDC(conf.General.DC_Files); err != nil {
+			if errs, ok := err.(parse.ErrorList); ok {
+				for _, err := range errs {
+					problems = append(problems, fmt.Sprintf("general.dc_files: %v", err))
+				}
+			} else {
+				problems = append(problems, fmt.Sprintf("general.dc_files: %v", err))
+			}
+		} else {
+			for n, ud := range conf.Uberdogs {
+				if _, ok := file.ClassByName(ud.Class); !ok {
+					problems = append(problems, fmt.Sprintf("uberdogs[%d]: class %s does not exist in the DC files", n, ud.Class))
+				}
+			}
+		}
+	}
+
+	if addr := conf.General.Eventlogger; addr != "" {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			problems = append(problems, fmt.Sprintf("general.eventlogger: invalid address: %v", err))
+		}
+	}
+
+	rotate := conf.Eventlogger.Rotate
+	for _, setting := range []struct {
+		key   string
+		value int
+	}{
+		{"size", rotate.Size},
+		{"interval", rotate.Interval},
+		{"max_files", rotate.Max_Files},
+		{"max_age", rotate.Max_Age},
+	} {
+		if setting.value < 0 {
+			problems = append(problems, fmt.Sprintf("eventlogger.rotate.%s: must not be negative", setting.key))
+		}
+	}
+
+	for n, sink := range conf.Eventlogger.Sinks {
+		owner := fmt.Sprintf("eventlogger.sinks[%d]", n)
+		switch sink.Type {
+		case "file":
+			if sink.Path == "" {
+				problems = append(problems, fmt.Sprintf("%s: missing path", owner))
+			}
+		case "tcp", "unix":
+			if sink.Address == "" {
+				problems = append(problems, fmt.Sprintf("%s: missing address", owner))
+			}
+		case "stdout":
+		case "":
+			problems = append(problems, fmt.Sprintf("%s: missing sink type", owner))
+		default:
+			problems = append(problems, fmt.Sprintf("%s: unknown sink type %q", owner, sink.Type))
+		}
+
+		if sink.Buffer < 0 {
+			problems = append(problems, fmt.Sprintf("%s: buffer must not be negative", owner))
+		}
+	}
+
+	// Channel allocation
+	var claims []channelClaim
+	claim := func(owner string, min, max util.Channel_t) {
+		for _, reserved := range reservedChannels {
+			if min <= reserved.channel && reserved.channel <= max {
+				problems = append(problems, fmt.Sprintf("%s: channel %d is reserved for %s",
+					owner, reserved.channel, reserved.name))
+			}
+		}
+
+		for _, other := range claims {
+			if min <= other.max && other.min <= max {
+				problems = append(problems, fmt.Sprintf("%s: channels %d-%d overlap with %s (%d-%d)",
+					owner, min, max, other.owner, other.min, other.max))
+			}
+		}
+
+		claims = append(claims, channelClaim{owner, min, max})
+	}
+
+	for n, ud := range conf.Uberdogs {
+		owner := fmt.Sprintf("uberdogs[%d]", n)
+		if ud.ID <= 0 {
+			problems = append(problems, fmt.Sprintf("%s: missing or invalid id", owner))
+			continue
+		}
+		claim(owner, util.Channel_t(ud.ID), util.Channel_t(ud.ID))
+	}
+
+	eventLoggers := 0
+	for n, role := range conf.Roles {
+		owner := fmt.Sprintf("roles[%d] (%s)", n, role.Type)
+		switch role.Type {
+		case "clientagent":
+			if role.Bind == "" {
+				problems = append(problems, fmt.Sprintf("%s: missing bind address", owner))
+			}
+			if role.Channels.Min <= 0 || role.Channels.Max <= 0 {
+				problems = append(problems, fmt.Sprintf("%s: missing channels.min or channels.max", owner))
+			} else if role.Channels.Min > role.Channels.Max {
+				problems = append(problems, fmt.Sprintf("%s: channels.min (%d) is greater than channels.max (%d)",
+					owner, role.Channels.Min, role.Channels.Max))
+			} else {
+				claim(owner, util.Channel_t(role.Channels.Min), util.Channel_t(role.Channels.Max))
+			}
+		case "eventlogger":
+			if eventLoggers++; eventLoggers > 1 {
+				problems = append(problems, fmt.Sprintf("%s: only one eventlogger role may be configured", owner))
+			}
+			if role.Bind != "" {
+				if _, _, err := net.SplitHostPort(role.Bind); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: invalid bind address: %v", owner, err))
+				}
+			}
+		case "stateserver":
+			if role.Control <= 0 {
+				problems = append(problems, fmt.Sprintf("%s: missing control channel", owner))
+			} else {
+				claim(owner, util.Channel_t(role.Control), util.Channel_t(role.Control))
+			}
+		case "":
+			problems = append(problems, fmt.Sprintf("%s: missing role type", owner))
+		default:
+			problems = append(problems, fmt.Sprintf("%s: unknown role type", owner))
+		}
+	}
+
+	return problems
+}
+
+// unknownKeys walks the raw configuration settings alongside the type they are decoded into, and
+//  reports every key that does not correspond to a field. Keys are matched case-insensitively, as
+//  they are when the configuration is decoded.
+func unknownKeys(path string, value interface{}, tp reflect.Type) []string {
+	var problems []string
+
+	switch tp.Kind() {
+	case reflect.Struct:
+		settings, ok := toStringMap(value).(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		keys := make([]string, 0, len(settings))
+		for key := range settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+
+			field, ok := fieldByKey(tp, key)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: unknown key", keyPath))
+				continue
+			}
+			problems = append(problems, unknownKeys(keyPath, settings[key], field.Type)...)
+		}
+	case reflect.Slice:
+		if list, ok := value.([]interface{}); ok {
+			for n, elem := range list {
+				problems = append(problems, unknownKeys(fmt.Sprintf("%s[%d]", path, n), elem, tp.Elem())...)
+			}
+		}
+	}
+
+	return problems
+}
+
+func fieldByKey(tp reflect.Type, key string) (reflect.StructField, bool) {
+	for n := 0; n < tp.NumField(); n++ {
+		if strings.EqualFold(tp.Field(n).Name, key) {
+			return tp.Field(n), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Maps nested in lists are left as-is by viper; depending on the YAML decoder they may be keyed by
+//  interface{}, and their keys are not lowercased.
+func toStringMap(value interface{}) interface{} {
+	if m, ok := value.(map[interface{}]interface{}); ok {
+		out := make(map[string]interface{})
+		for key, val := range m {
+			out[strings.ToLower(fmt.Sprint(key))] = val
+		}
+		return out
+	}
+
+	if m, ok := value.(map[string]interface{}); ok {
+		out := make(map[string]interface{})
+		for key, val := range m {
+			out[strings.ToLower(key)] = val
+		}
+		return out
+	}
+
+	return value
+}
+
+func contains(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func testConfig() *ServerConfig {
+	conf := &ServerConfig{}
+	conf.General.DC_Files = []string{"dclass/parse/test.dc"}
+	conf.Uberdogs = append(conf.Uberdogs, struct {
+		ID        int
+		Class     string
+		Anonymous bool
+	}{ID: 1234, Class: "UberDog1"})
+
+	ca := Role{Type: "clientagent", Bind: "127.0.0.1:7198"}
+	ca.Channels.Min, ca.Channels.Max = 1000000, 1009999
+	conf.Roles = []Role{ca, {Type: "stateserver", Control: 100100}}
+	return conf
+}
+
+func TestValidateConfig_Valid(t *testing.T) {
+	settings := map[string]interface{}{
+		"general": map[string]interface{}{"dc_files": []interface{}{"dclass/parse/test.dc"}},
+		"roles": []interface{}{
+			map[interface{}]interface{}{"type": "clientagent", "bind": "127.0.0.1:7198",
+				"channels": map[interface{}]interface{}{"min": 1000000, "max": 1009999}},
+			map[string]interface{}{"Type": "stateserver", "Control": 100100},
+		},
+	}
+
+	require.Empty(t, validateConfig(testConfig(), settings))
+}
+
+func TestValidateConfig_UnknownKeys(t *testing.T) {
+	settings := map[string]interface{}{
+		"genral": map[string]interface{}{},
+		"roles": []interface{}{
+			map[interface{}]interface{}{"type": "clientagent",
+				"chanels": map[interface{}]interface{}{"min": 1000000, "max": 1009999}},
+		},
+	}
+
+	require.Equal(t, []string{"genral: unknown key", "roles[0].chanels: unknown key"},
+		validateConfig(testConfig(), settings))
+}
+
+func TestValidateConfig_Problems(t *testing.T) {
+	conf := testConfig()
+	conf.General.DC_Files = append(conf.General.DC_Files, "missing.dc")
+	conf.Roles[0].Bind = ""
+	conf.Roles[0].Channels.Min = 1
+	conf.Roles[1].Control = 1234
+	conf.Roles = append(conf.Roles, Role{Type: "databaseserver"})
+	conf.Roles = append(conf.Roles, Role{Type: "eventlogger"}, Role{Type: "eventlogger", Bind: "7197"})
+	conf.General.Eventlogger = "127.0.0.1"
+	conf.Eventlogger.Rotate.Max_Age = -1
+	conf.Eventlogger.Sinks = []EventSink{{Type: "stdout"}, {Type: "tcp"}, {Type: "syslog", Buffer: -1}}
+
+	require.Equal(t, []string{
+		"general.dc_files: cannot read DC file missing.dc: stat missing.dc: no such file or directory",
+		"general.eventlogger: invalid address: address 127.0.0.1: missing port in address",
+		"eventlogger.rotate.max_age: must not be negative",
+		"eventlogger.sinks[1]: missing address",
+		"eventlogger.sinks[2]: unknown sink type \"syslog\"",
+		"eventlogger.sinks[2]: buffer must not be negative",
+		"roles[0] (clientagent): missing bind address",
+		"roles[0] (clientagent): channel 1 is reserved for CONTROL_MESSAGE",
+		"roles[0] (clientagent): channel 10 is reserved for BCHAN_CLIENTS",
+		"roles[0] (clientagent): channel 12 is reserved for BCHAN_STATESERVERS",
+		"roles[0] (clientagent): channel 13 is reserved for BCHAN_DBSERVERS",
+		"roles[0] (clientagent): channels 1-1009999 overlap with uberdogs[0] (1234-1234)",
+		"roles[1] (stateserver): channels 1234-1234 overlap with uberdogs[0] (1234-1234)",
+		"roles[1] (stateserver): channels 1234-1234 overlap with roles[0] (clientagent) (1-1009999)",
+		"roles[2] (databaseserver): unknown role type",
+		"roles[4] (eventlogger): only one eventlogger role may be configured",
+		"roles[4] (eventlogger): invalid bind address: address 7197: missing port in address",
+	}, validateConfig(conf, map[string]interface{}{}))
+}
+
+func TestValidateConfig_Uberdogs(t *testing.T) {
+	conf := testConfig()
+	conf.Uberdogs[0].Class = "UberDog9"
+
+	require.Equal(t, []string{"uberdogs[0]: class UberDog9 does not exist in the DC files"},
+		validateConfig(conf, map[string]interface{}{}))
+}
@@ -1,11 +1,36 @@
 package dc
 
+// Panda3D's built-in array types. These are packed like any other variable-length array, but are
+//  hashed using their own type codes, which must be preserved to keep legacy DC files compatible.
+const (
+	L_BLOB32           = 11
+	L_INT16ARRAY       = 12
+	L_INT32ARRAY       = 13
+	L_UINT16ARRAY      = 14
+	L_UINT32ARRAY      = 15
+	L_INT8ARRAY        = 16
+	L_UINT8ARRAY       = 17
+	L_UINT32UINT8ARRAY = 18
+)
+
+var legacyArrays = map[string]int{
+	"blob32":           L_BLOB32,
+	"int16array":       L_INT16ARRAY,
+	"int32array":       L_INT32ARRAY,
+	"uint16array":      L_UINT16ARRAY,
+	"uint32array":      L_UINT32ARRAY,
+	"int8array":        L_INT8ARRAY,
+	"uint8array":       L_UINT8ARRAY,
+	"uint32uint8array": L_UINT32UINT8ARRAY,
+}
+
 type ArrayType struct {
 	DistributedType
 
 	elemType   BaseType
 	arrayRange NumericRange
 	arraySize  uint
+	legacyType int
 }
 
 func NewArray(elem BaseType, rng NumericRange) *ArrayType {
@@ -45,6 +70,49 @@ func NewArray(elem BaseType, rng NumericRange) *ArrayType {
 	return a
 }
 
+// NewLegacyArray returns one of Panda3D's built-in array types, such as uint16array, by name. The
+//  elements of a uint32uint8array are pairs of a uint32 and a uint8, represented as a method type.
+func NewLegacyArray(name string, rng NumericRange) (a *ArrayType, ok bool) {
+	code, ok := legacyArrays[name]
+	if !ok {
+		return nil, false
+	}
+
+	var elem BaseType
+	switch code {
+	case L_BLOB32, L_UINT8ARRAY:
+		elem = NewNumber(T_UINT8)
+	case L_INT8ARRAY:
+		elem = NewNumber(T_INT8)
+	case L_INT16ARRAY:
+		elem = NewNumber(T_INT16)
+	case L_INT32ARRAY:
+		elem = NewNumber(T_INT32)
+	case L_UINT16ARRAY:
+		elem = NewNumber(T_UINT16)
+	case L_UINT32ARRAY:
+		elem = NewNumber(T_UINT32)
+	case L_UINT32UINT8ARRAY:
+		pair := NewMethod()
+		for _, tp := range []Type{T_UINT32, T_UINT8} {
+			param := NewParameter(pair)
+			param.SetType(NewNumber(tp))
+			pair.AddParameter(param)
+		}
+		elem = pair
+	}
+
+	a = NewArray(elem, rng)
+	a.legacyType = code
+	a.SetAlias(name)
+	return a, true
+}
+
+func IsLegacyArray(name string) bool {
+	_, ok := legacyArrays[name]
+	return ok
+}
+
 func (a *ArrayType) ArraySize() uint       { return a.arraySize }
 func (a *ArrayType) ElementType() BaseType { return a.elemType }
 
@@ -68,6 +136,11 @@ func (a *ArrayType) DefaultValue() interface{} {
 	return ""
 }
 func (a *ArrayType) GenerateHash(generator *HashGenerator) {
+	if a.legacyType != 0 {
+		a.generateLegacyHash(generator)
+		return
+	}
+
 	switch a.dataType {
 	case T_ARRAY, T_VARARRAY:
 		a.elemType.GenerateHash(generator)
@@ -95,3 +168,24 @@ func (a *ArrayType) GenerateHash(generator *HashGenerator) {
 		generator.AddInt(int(a.arrayRange.Max.Uinteger))
 	}
 }
+
+// Panda3D hashes its built-in arrays like any other simple parameter: by type code and divisor,
+//  followed by the modulus and range, if any.
+func (a *ArrayType) generateLegacyHash(generator *HashGenerator) {
+	generator.AddInt(a.legacyType)
+
+	if num, ok := a.elemType.(*NumericType); ok {
+		generator.AddInt(int(num.Divisor))
+		if num.Modulus != 0 {
+			generator.AddInt(int(num.calculatedModulus.Uinteger))
+		}
+	} else {
+		generator.AddInt(1)
+	}
+
+	if a.HasRange() {
+		generator.AddInt(1)
+		generator.AddInt(int(a.arrayRange.Min.Uinteger))
+		generator.AddInt(int(a.arrayRange.Max.Uinteger))
+	}
+}
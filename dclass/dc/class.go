@@ -127,6 +127,32 @@ func (c *Class) Name() string {
 	return c.name
 }
 
+// Module returns the module which the class is imported from, if any. Only imports naming the class
+//  are considered, since `from module import *` does not say which classes the module provides.
+func (c *Class) Module() (module string, ok bool) {
+	if imp, ok := c.file.ImportBySymbol(c.name); ok {
+		return imp.Module(), true
+	}
+	return "", false
+}
+
+// Suffixes returns the views of the class which are imported, e.g. AI, OV and UD.
+func (c *Class) Suffixes() []string {
+	if imp, ok := c.file.ImportBySymbol(c.name); ok {
+		return imp.SymbolSuffixes()
+	}
+	return nil
+}
+
+// Implementation returns the module and symbol which implement the class for the view with the given
+//  suffix; see SUFFIX_CLIENT, SUFFIX_AI, SUFFIX_OV and SUFFIX_UD.
+func (c *Class) Implementation(suffix string) (module string, symbol string, ok bool) {
+	if imp, ok := c.file.ImportBySymbol(c.name); ok {
+		return imp.Implementation(suffix)
+	}
+	return "", "", false
+}
+
 func (c *Class) GenerateHash(generator *HashGenerator) {
 	generator.AddString(c.name)
 
@@ -0,0 +1,491 @@
+package dc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Compatibility describes who is affected by a change between two revisions of a DC file.
+type Compatibility int
+
+const (
+	// Peers using either revision encode the change identically; only the DC hash differs.
+	WIRE_COMPATIBLE Compatibility = iota
+	// Every peer must be updated, but values stored with the old revision can still be read with
+	//  the new one, if necessary by converting them losslessly.
+	DB_COMPATIBLE
+	// Values stored with the old revision may be lost or misread, or messages which inline the
+	//  required fields of a class are laid out differently.
+	BREAKING
+)
+
+func (c Compatibility) String() string {
+	switch c {
+	case WIRE_COMPATIBLE:
+		return "wire-compatible"
+	case DB_COMPATIBLE:
+		return "db-compatible"
+	default:
+		return "breaking"
+	}
+}
+
+type ChangeKind int
+
+const (
+	CLASS_ADDED ChangeKind = iota
+	CLASS_REMOVED
+	CLASS_ID_SHIFTED
+	PARENTS_CHANGED
+	FIELD_ADDED
+	FIELD_REMOVED
+	FIELD_ID_SHIFTED
+	TYPE_CHANGED
+	KEYWORDS_CHANGED
+	REQUIRED_FIELDS_CHANGED
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case CLASS_ADDED:
+		return "class added"
+	case CLASS_REMOVED:
+		return "class removed"
+	case CLASS_ID_SHIFTED:
+		return "class ID shifted"
+	case PARENTS_CHANGED:
+		return "parents changed"
+	case FIELD_ADDED:
+		return "field added"
+	case FIELD_REMOVED:
+		return "field removed"
+	case FIELD_ID_SHIFTED:
+		return "field ID shifted"
+	case TYPE_CHANGED:
+		return "type changed"
+	case KEYWORDS_CHANGED:
+		return "keywords changed"
+	default:
+		return "required fields changed"
+	}
+}
+
+// Change is a single difference between two revisions of a DC file.
+type Change struct {
+	Kind          ChangeKind
+	Compatibility Compatibility
+
+	// The class the change was made to, and the field if it was made to one
+	Class string
+	Field string
+
+	Description string
+}
+
+func (c Change) String() string {
+	name := c.Class
+	if c.Field != "" {
+		name += "." + c.Field
+	}
+	return fmt.Sprintf("%s: %s", name, c.Description)
+}
+
+// Diff compares two revisions of a DC file, matching classes and fields by name, and returns every
+//  change which affects how fields are encoded or stored.
+func Diff(before *File, after *File) []Change {
+	var changes []Change
+	add := func(kind ChangeKind, compat Compatibility, class string, field string, format string, args ...interface{}) {
+		changes = append(changes, Change{kind, compat, class, field, fmt.Sprintf(format, args...)})
+	}
+
+	for _, old := range before.classes {
+		cls, ok := after.ClassByName(old.name)
+		if !ok {
+			add(CLASS_REMOVED, BREAKING, old.name, "", "class was removed; stored objects can no longer be loaded")
+			continue
+		}
+
+		if old.id != cls.id {
+			add(CLASS_ID_SHIFTED, DB_COMPATIBLE, old.name, "", "class ID changed from %d to %d", old.id, cls.id)
+		}
+
+		if oldParents, parents := classNames(old.parents), classNames(cls.parents); oldParents != parents {
+			if fieldNames(old.inheritedRequired()) != fieldNames(cls.inheritedRequired()) {
+				add(PARENTS_CHANGED, BREAKING, old.name, "", "parents changed from [%s] to [%s]; the inherited required fields change",
+					oldParents, parents)
+			} else {
+				add(PARENTS_CHANGED, DB_COMPATIBLE, old.name, "", "parents changed from [%s] to [%s]", oldParents, parents)
+			}
+		}
+
+		changes = append(changes, diffFields(before, after, old, cls)...)
+
+		// The required fields are sent in order with every object, so reordering them is breaking as well
+		if oldRequired, required := fieldNames(old.requiredFields()), fieldNames(cls.requiredFields()); oldRequired != required {
+			add(REQUIRED_FIELDS_CHANGED, BREAKING, old.name, "", "required fields sent with objects changed from [%s] to [%s]",
+				oldRequired, required)
+		}
+	}
+
+	for _, cls := range after.classes {
+		if _, ok := before.ClassByName(cls.name); !ok {
+			if int(cls.id) >= len(before.types) {
+				add(CLASS_ADDED, WIRE_COMPATIBLE, cls.name, "", "class was added with ID %d", cls.id)
+			} else {
+				add(CLASS_ADDED, DB_COMPATIBLE, cls.name, "", "class was added with ID %d, shifting the IDs of later classes", cls.id)
+			}
+		}
+	}
+
+	return changes
+}
+
+func diffFields(before *File, after *File, old *Class, cls *Class) []Change {
+	var changes []Change
+	add := func(kind ChangeKind, compat Compatibility, field string, format string, args ...interface{}) {
+		changes = append(changes, Change{kind, compat, old.name, field, fmt.Sprintf(format, args...)})
+	}
+
+	for _, oldField := range old.allFields() {
+		name := oldField.Name()
+		field, ok := cls.GetFieldByName(name)
+		if !ok {
+			switch {
+			case isInlined(oldField):
+				add(FIELD_REMOVED, BREAKING, name, "required field was removed; it is no longer inlined with the required fields")
+			case !old.HasField(name):
+				add(FIELD_REMOVED, DB_COMPATIBLE, name, "field is no longer inherited; stored values are discarded")
+			default:
+				add(FIELD_REMOVED, DB_COMPATIBLE, name, "field was removed; stored values are discarded")
+			}
+			continue
+		}
+
+		// Changes to a field inherited in both revisions are reported for the class declaring it
+		if !old.HasField(name) && !cls.HasField(name) {
+			continue
+		}
+
+		if oldField.Id() != field.Id() {
+			add(FIELD_ID_SHIFTED, DB_COMPATIBLE, name, "field ID changed from %d to %d", oldField.Id(), field.Id())
+		}
+
+		if compat, reason, changed := compareFields(oldField, field); changed {
+			add(TYPE_CHANGED, compat, name, "type changed from %s to %s (%s)",
+				before.typeString(oldField), after.typeString(field), reason)
+		}
+
+		oldKeywords, keywords := oldField.Keywords(), field.Keywords()
+		if kw1, kw2 := sortedKeywords(oldKeywords), sortedKeywords(keywords); kw1 != kw2 {
+			compat, reason := WIRE_COMPATIBLE, ""
+			if oldKeywords.HasKeyword("db") != keywords.HasKeyword("db") {
+				// Stored objects gain or lose values for the field
+				compat = DB_COMPATIBLE
+			}
+			if isInlined(oldField) || isInlined(field) {
+				for _, kw := range requiredKeywords {
+					if oldKeywords.HasKeyword(kw) != keywords.HasKeyword(kw) {
+						compat, reason = BREAKING, "; the required fields sent with objects change"
+					}
+				}
+			}
+			add(KEYWORDS_CHANGED, compat, name, "keywords changed from [%s] to [%s]%s", kw1, kw2, reason)
+		}
+	}
+
+	for _, field := range cls.allFields() {
+		name := field.Name()
+		if _, ok := old.GetFieldByName(name); ok {
+			continue
+		}
+
+		switch {
+		case isInlined(field):
+			add(FIELD_ADDED, BREAKING, name, "required field was added with ID %d; it is inlined with the required fields", field.Id())
+		case !cls.HasField(name):
+			// Whether its ID shifts others is reported for the class declaring it
+			add(FIELD_ADDED, WIRE_COMPATIBLE, name, "field is now inherited with ID %d", field.Id())
+		case int(field.Id()) >= len(before.fields):
+			add(FIELD_ADDED, WIRE_COMPATIBLE, name, "field was added with ID %d", field.Id())
+		default:
+			add(FIELD_ADDED, DB_COMPATIBLE, name, "field was added with ID %d, shifting the IDs of later fields", field.Id())
+		}
+	}
+
+	return changes
+}
+
+// requiredKeywords decide which fields are inlined, in class order, in STATESERVER_CREATE_OBJECT_WITH_REQUIRED
+//  and the ENTER_*_REQUIRED messages: every required field is sent to servers, and those which are
+//  also broadcast, clrecv or ownrecv to clients.
+var requiredKeywords = []string{"required", "broadcast", "clrecv", "ownrecv"}
+
+// isInlined returns whether a field is sent with the required fields of its class; the components of
+//  a molecular field are sent themselves.
+func isInlined(field Field) bool {
+	_, molecular := field.(*MolecularField)
+	return !molecular && field.HasKeyword("required")
+}
+
+// Overall returns the compatibility of a set of changes as a whole, i.e. that of the least
+//  compatible one.
+func Overall(changes []Change) Compatibility {
+	compat := WIRE_COMPATIBLE
+	for _, change := range changes {
+		if change.Compatibility > compat {
+			compat = change.Compatibility
+		}
+	}
+	return compat
+}
+
+// allFields returns the constructor of a class, if it has one, followed by its other fields including
+//  the ones it inherits.
+func (c *Class) allFields() []Field {
+	var fields []Field
+	if c.constructor != nil {
+		fields = append(fields, c.constructor)
+	}
+	return append(fields, c.fields...)
+}
+
+// requiredFields returns the fields inlined with the required fields of a class, in the order they
+//  are sent.
+func (c *Class) requiredFields() []Field {
+	var fields []Field
+	for _, field := range c.fields {
+		if isInlined(field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// inheritedRequired returns the required fields which a class inherits from its parents.
+func (c *Class) inheritedRequired() []Field {
+	var fields []Field
+	for _, field := range c.requiredFields() {
+		if !c.HasField(field.Name()) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func fieldNames(fields []Field) string {
+	var names []string
+	for _, field := range fields {
+		names = append(names, field.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+func classNames(classes []Class) string {
+	var names []string
+	for _, cls := range classes {
+		names = append(names, cls.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func sortedKeywords(list KeywordList) string {
+	keywords := append([]string{}, list.keywords...)
+	sort.Strings(keywords)
+	return strings.Join(keywords, " ")
+}
+
+func (f *File) typeString(field Field) string {
+	if mol, ok := field.(*MolecularField); ok {
+		var names []string
+		for _, f := range mol.fields {
+			names = append(names, f.Name())
+		}
+		return "molecular " + strings.Join(names, ", ")
+	}
+
+	w := &writer{file: f}
+	if method, ok := field.FieldType().(*Method); ok {
+		var params []string
+		for _, param := range method.parameters {
+			params = append(params, w.parameter(param.dataType, "", nil))
+		}
+		return "(" + strings.Join(params, ", ") + ")"
+	}
+
+	return w.parameter(field.FieldType(), "", nil)
+}
+
+// compareFields compares the encoding of two fields, returning false if it has not changed at all.
+func compareFields(old Field, field Field) (compat Compatibility, reason string, changed bool) {
+	oldMol, isOldMol := old.(*MolecularField)
+	mol, isMol := field.(*MolecularField)
+	switch {
+	case isOldMol && isMol:
+		if len(oldMol.fields) != len(mol.fields) {
+			return DB_COMPATIBLE, "components changed", true
+		}
+		for n := range oldMol.fields {
+			if oldMol.fields[n].Name() != mol.fields[n].Name() {
+				return DB_COMPATIBLE, "components changed", true
+			}
+		}
+		return WIRE_COMPATIBLE, "", false
+	case isOldMol || isMol:
+		return BREAKING, "changed between an atomic and a molecular field", true
+	}
+
+	if typeHash(old.FieldType()) == typeHash(field.FieldType()) {
+		return WIRE_COMPATIBLE, "", false
+	}
+
+	compat, reason = compareTypes(old.FieldType(), field.FieldType())
+	return compat, reason, true
+}
+
+func typeHash(t BaseType) uint32 {
+	generator := NewHashGenerator()
+	t.GenerateHash(generator)
+	return generator.Hash()
+}
+
+// compareTypes decides whether values of the old type can be read as the new one.
+func compareTypes(old BaseType, dtype BaseType) (Compatibility, string) {
+	if typeHash(old) == typeHash(dtype) {
+		return WIRE_COMPATIBLE, "same encoding"
+	}
+
+	switch t := dtype.(type) {
+	case *NumericType:
+		if o, ok := old.(*NumericType); ok {
+			return compareNumbers(o, t)
+		}
+	case *ArrayType:
+		if o, ok := old.(*ArrayType); ok {
+			return compareArrays(o, t)
+		}
+	case *Method:
+		if o, ok := old.(*Method); ok {
+			if len(o.parameters) != len(t.parameters) {
+				return BREAKING, "parameters added or removed"
+			}
+
+			var types [][2]BaseType
+			for n := range o.parameters {
+				types = append(types, [2]BaseType{o.parameters[n].dataType, t.parameters[n].dataType})
+			}
+			return compareAll(types)
+		}
+	case *Struct:
+		if o, ok := old.(*Struct); ok {
+			if len(o.fields) != len(t.fields) {
+				return BREAKING, "struct fields added or removed"
+			}
+
+			var types [][2]BaseType
+			for n := range o.fields {
+				types = append(types, [2]BaseType{o.fields[n].FieldType(), t.fields[n].FieldType()})
+			}
+			return compareAll(types)
+		}
+	}
+
+	return BREAKING, "incompatible encoding"
+}
+
+// compareAll returns the least compatible result of comparing each pair of types.
+func compareAll(types [][2]BaseType) (Compatibility, string) {
+	compat, reason := WIRE_COMPATIBLE, "same encoding"
+	for _, pair := range types {
+		if c, r := compareTypes(pair[0], pair[1]); c > compat || (c == compat && reason == "same encoding") {
+			compat, reason = c, r
+		}
+	}
+	return compat, reason
+}
+
+type numericLayout struct {
+	size   Sizetag_t
+	signed bool
+	float  bool
+}
+
+func layoutOf(n *NumericType) numericLayout {
+	switch n.dataType {
+	case T_INT8, T_INT16, T_INT32, T_INT64:
+		return numericLayout{n.size, true, false}
+	case T_FLOAT32, T_FLOAT64:
+		return numericLayout{n.size, true, true}
+	}
+	return numericLayout{n.size, false, false}
+}
+
+// widens reports whether every value of the old layout can be represented exactly by the new one.
+func (l numericLayout) widens(old numericLayout) bool {
+	switch {
+	case l.float && old.float:
+		return l.size >= old.size
+	case l.float:
+		// A float64 holds every integer of up to 32 bits, and a float32 of up to 16 bits
+		return old.size <= l.size/2
+	case old.float:
+		return false
+	case l.signed == old.signed:
+		return l.size >= old.size
+	default:
+		return l.signed && l.size > old.size
+	}
+}
+
+func compareNumbers(old *NumericType, n *NumericType) (Compatibility, string) {
+	if old.Divisor != n.Divisor || (n.Modulus != 0 && n.Modulus != old.Modulus) {
+		return BREAKING, "divisor or modulus changed"
+	}
+
+	if layout, oldLayout := layoutOf(n), layoutOf(old); layout != oldLayout {
+		if !layout.widens(oldLayout) {
+			return BREAKING, "narrowed"
+		}
+		return DB_COMPATIBLE, "widened"
+	}
+
+	// Stored values outside of a narrowed range can no longer be read
+	switch {
+	case n.HasRange() && (!old.HasRange() || n.Range.Min.Float > old.Range.Min.Float || n.Range.Max.Float < old.Range.Max.Float):
+		return BREAKING, "range narrowed"
+	case n.Range != old.Range:
+		return WIRE_COMPATIBLE, "range relaxed"
+	}
+
+	return WIRE_COMPATIBLE, "same encoding"
+}
+
+func compareArrays(old *ArrayType, a *ArrayType) (Compatibility, string) {
+	compat, reason := compareTypes(old.elemType, a.elemType)
+	if compat == BREAKING {
+		return compat, reason
+	}
+
+	switch {
+	case old.HasFixedSize() && a.HasFixedSize():
+		if old.arraySize != a.arraySize {
+			return BREAKING, "length changed"
+		}
+	case old.HasFixedSize():
+		// The length prefix of a variable-length array can be added when converting
+		if a.HasRange() && (uint64(old.arraySize) < a.arrayRange.Min.Uinteger || uint64(old.arraySize) > a.arrayRange.Max.Uinteger) {
+			return BREAKING, "length changed"
+		}
+		return DB_COMPATIBLE, "changed to a variable-length array"
+	case a.HasFixedSize():
+		return BREAKING, "changed to a fixed-length array"
+	case a.HasRange() && (!old.HasRange() || a.arrayRange.Min.Uinteger > old.arrayRange.Min.Uinteger ||
+		a.arrayRange.Max.Uinteger < old.arrayRange.Max.Uinteger):
+		return BREAKING, "length range narrowed"
+	}
+
+	if compat == WIRE_COMPATIBLE && old.arrayRange != a.arrayRange {
+		reason = "length range relaxed"
+	}
+	return compat, reason
+}
@@ -0,0 +1,226 @@
+package dc_test
+
+import (
+	"astrongo/dclass/dc"
+	"astrongo/dclass/parse"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	before, err := parse.ParseString(`
+struct Pos {
+	int16 x;
+	int16 y;
+};
+
+dclass DistributedToon {
+	setName(string name) required db;
+	setHp(uint8(0-100) hp) broadcast;
+	setLevel(uint16 level) db;
+	setPos(Pos pos) broadcast;
+};
+
+dclass DistributedPet {
+	setMood(uint32 mood) ram;
+	setOwner(uint32 owner) ram;
+	setAge(uint8(0-200) age) db;
+	setTag(string(0-50) tag) db;
+	setWeight(uint8(0-10) weight) db;
+};`)
+	if err != nil {
+		t.Fatalf("dclass parse failed: %s", err)
+	}
+
+	after, err := parse.ParseString(`
+struct Pos {
+	int16 x;
+	int16 y;
+};
+
+dclass DistributedToon {
+	setName(string name) required broadcast db;
+	setHp(uint16(0-200) hp) broadcast;
+	setPos(Pos pos) broadcast;
+};
+
+dclass DistributedPet {
+	setMood(int8 mood) ram;
+	setOwner(uint32 owner) ram;
+	setAge(uint8(0-10) age) db;
+	setTag(string(0-10) tag) db;
+	setWeight(uint8(0-200) weight) db;
+};
+
+dclass DistributedHouse {
+	setOwner(uint32 owner) required db;
+};`)
+	if err != nil {
+		t.Fatalf("dclass parse failed: %s", err)
+	}
+
+	changes := dc.Diff(before.Traverse(), after.Traverse())
+	expected := []string{
+		"breaking DistributedToon.setName: keywords changed from [db required] to [broadcast db required]; the required fields sent with objects change",
+		"db-compatible DistributedToon.setHp: type changed from (uint8(0-100)) to (uint16(0-200)) (widened)",
+		"db-compatible DistributedToon.setLevel: field was removed; stored values are discarded",
+		"db-compatible DistributedToon.setPos: field ID changed from 5 to 4",
+		"db-compatible DistributedPet.setMood: field ID changed from 6 to 5",
+		"breaking DistributedPet.setMood: type changed from (uint32) to (int8) (narrowed)",
+		"db-compatible DistributedPet.setOwner: field ID changed from 7 to 6",
+		"db-compatible DistributedPet.setAge: field ID changed from 8 to 7",
+		"breaking DistributedPet.setAge: type changed from (uint8(0-200)) to (uint8(0-10)) (range narrowed)",
+		"db-compatible DistributedPet.setTag: field ID changed from 9 to 8",
+		"breaking DistributedPet.setTag: type changed from (string(0-50)) to (string(0-10)) (length range narrowed)",
+		"db-compatible DistributedPet.setWeight: field ID changed from 10 to 9",
+		"wire-compatible DistributedPet.setWeight: type changed from (uint8(0-10)) to (uint8(0-200)) (range relaxed)",
+		"wire-compatible DistributedHouse: class was added with ID 3",
+	}
+
+	var result []string
+	for _, change := range changes {
+		result = append(result, change.Compatibility.String()+" "+change.String())
+	}
+
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("changes mismatch:\n%s", strings.Join(result, "\n"))
+	}
+
+	if dc.Overall(changes) != dc.BREAKING {
+		t.Fatalf("overall compatibility mismatch: %s", dc.Overall(changes))
+	}
+}
+
+func TestDiff_Required(t *testing.T) {
+	before, err := parse.ParseString(`
+dclass DistributedToon {
+	setName(string name) required db;
+	setHp(uint8 hp) required broadcast;
+	setLevel(uint16 level) broadcast;
+	setPos(int16 x, int16 y) required;
+};`)
+	if err != nil {
+		t.Fatalf("dclass parse failed: %s", err)
+	}
+
+	after, err := parse.ParseString(`
+dclass DistributedToon {
+	setName(string name) db;
+	setHp(uint8 hp) required;
+	setLevel(uint16 level) ram;
+	setPos(int16 x, int16 y) required;
+	setColor(uint8 color) required broadcast;
+};`)
+	if err != nil {
+		t.Fatalf("dclass parse failed: %s", err)
+	}
+
+	changes := dc.Diff(before.Traverse(), after.Traverse())
+	expected := []string{
+		"breaking DistributedToon.setName: keywords changed from [db required] to [db]; the required fields sent with objects change",
+		"breaking DistributedToon.setHp: keywords changed from [broadcast required] to [required]; the required fields sent with objects change",
+		"wire-compatible DistributedToon.setLevel: keywords changed from [broadcast] to [ram]",
+		"breaking DistributedToon.setColor: required field was added with ID 4; it is inlined with the required fields",
+		"breaking DistributedToon: required fields sent with objects changed from [setName, setHp, setPos] to [setHp, setPos, setColor]",
+	}
+
+	var result []string
+	for _, change := range changes {
+		result = append(result, change.Compatibility.String()+" "+change.String())
+	}
+
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("changes mismatch:\n%s", strings.Join(result, "\n"))
+	}
+
+	changes = dc.Diff(after.Traverse(), before.Traverse())
+	if removal := changes[len(changes)-2]; removal.String() != "DistributedToon.setColor: required field was removed; it is no longer inlined with the required fields" ||
+		removal.Compatibility != dc.BREAKING {
+		t.Fatalf("removal of a required field mismatch: %s", removal)
+	}
+}
+
+// diffStrings returns the changes between two revisions, each preceded by its compatibility.
+func diffStrings(t *testing.T, before string, after string) []string {
+	old, err := parse.ParseString(before)
+	if err != nil {
+		t.Fatalf("dclass parse failed: %s", err)
+	}
+	dct, err := parse.ParseString(after)
+	if err != nil {
+		t.Fatalf("dclass parse failed: %s", err)
+	}
+
+	var result []string
+	for _, change := range dc.Diff(old.Traverse(), dct.Traverse()) {
+		result = append(result, change.Compatibility.String()+" "+change.String())
+	}
+	return result
+}
+
+func TestDiff_RequiredOrder(t *testing.T) {
+	result := diffStrings(t, `
+dclass DistributedToon {
+	setName(string name) required;
+	setHp(uint8 hp) required;
+};`, `
+dclass DistributedToon {
+	setHp(uint8 hp) required;
+	setName(string name) required;
+};`)
+
+	expected := []string{
+		"db-compatible DistributedToon.setName: field ID changed from 0 to 1",
+		"db-compatible DistributedToon.setHp: field ID changed from 1 to 0",
+		"breaking DistributedToon: required fields sent with objects changed from [setName, setHp] to [setHp, setName]",
+	}
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("changes mismatch:\n%s", strings.Join(result, "\n"))
+	}
+}
+
+func TestDiff_Parents(t *testing.T) {
+	before := `
+dclass P {
+	setName(string name) required;
+};
+
+dclass Q {
+	setColor(uint8 color) ram;
+};
+
+dclass R {
+	setMood(uint8 mood) ram;
+};
+
+dclass DistributedToon : P {
+	setHp(uint8 hp) required;
+};
+
+dclass DistributedPet : Q {
+	setOwner(uint32 owner) required;
+};`
+
+	// Moving a class to parents without required fields loses the inherited ones
+	result := diffStrings(t, before, strings.Replace(before, "DistributedToon : P", "DistributedToon : Q", 1))
+	expected := []string{
+		"breaking DistributedToon: parents changed from [P] to [Q]; the inherited required fields change",
+		"breaking DistributedToon.setName: required field was removed; it is no longer inlined with the required fields",
+		"wire-compatible DistributedToon.setColor: field is now inherited with ID 1",
+		"breaking DistributedToon: required fields sent with objects changed from [setName, setHp] to [setHp]",
+	}
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("changes mismatch:\n%s", strings.Join(result, "\n"))
+	}
+
+	// The fields which are inherited are compared as well, but the required fields do not change
+	result = diffStrings(t, before, strings.Replace(before, "DistributedPet : Q", "DistributedPet : R", 1))
+	expected = []string{
+		"db-compatible DistributedPet: parents changed from [Q] to [R]",
+		"db-compatible DistributedPet.setColor: field is no longer inherited; stored values are discarded",
+		"wire-compatible DistributedPet.setMood: field is now inherited with ID 2",
+	}
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("changes mismatch:\n%s", strings.Join(result, "\n"))
+	}
+}
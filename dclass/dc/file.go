@@ -15,12 +15,28 @@ type File struct {
 	fields      []*Field
 	types       []BaseType
 	typesByName map[string]BaseType
+
+	imports         []*Import
+	importsBySymbol map[string]*Import
+
+	// Every keyword, import, typedef, struct and class in the order they were declared
+	declarations []interface{}
+}
+
+type typedef struct {
+	name  string
+	dtype BaseType
 }
 
 func NewFile() *File {
 	f := File{}
 	f.typedefs = make(map[string]BaseType, 0)
 	f.typesByName = make(map[string]BaseType, 0)
+	f.importsBySymbol = make(map[string]*Import, 0)
+
+	for _, kw := range historicalKeywords {
+		f.KeywordList.AddKeyword(kw.name)
+	}
 
 	return &f
 }
@@ -51,6 +67,7 @@ func (f *File) AddTypedef(name string, t BaseType) (err error) {
 	}
 
 	f.typedefs[name] = t
+	f.declarations = append(f.declarations, &typedef{name, t})
 	return nil
 }
 
@@ -76,6 +93,7 @@ func (f *File) AddClass(class *Class) (err error) {
 	f.types = append(f.types, BaseType(class))
 	f.classes = append(f.classes, class)
 	f.typesByName[class.name] = BaseType(class)
+	f.declarations = append(f.declarations, class)
 	return nil
 }
 
@@ -109,6 +127,7 @@ func (f *File) AddStruct(strct *Struct) (err error) {
 	f.types = append(f.types, BaseType(strct))
 	f.structs = append(f.structs, strct)
 	f.typesByName[strct.name] = BaseType(strct)
+	f.declarations = append(f.declarations, strct)
 	return nil
 }
 
@@ -125,6 +144,43 @@ func (f *File) AddField(field *Field) /* cannot throw an error */ {
 	f.fields = append(f.fields, field)
 }
 
+// AddKeyword declares a keyword which may be used by fields; declaring a keyword twice has no effect.
+func (f *File) AddKeyword(kw string) {
+	for _, decl := range f.declarations {
+		if decl == kw {
+			return
+		}
+	}
+
+	f.declarations = append(f.declarations, kw)
+	if !f.HasKeyword(kw) {
+		f.KeywordList.AddKeyword(kw)
+	}
+}
+
+func (f *File) AddImport(imp *Import) {
+	f.declarations = append(f.declarations, imp)
+	f.imports = append(f.imports, imp)
+	if imp.symbol != "*" {
+		f.importsBySymbol[imp.symbol] = imp
+	}
+}
+
+func (f File) Imports() []*Import {
+	return f.imports
+}
+
+func (f File) ImportBySymbol(symbol string) (imp *Import, ok bool) {
+	imp, ok = f.importsBySymbol[symbol]
+	return imp, ok
+}
+
+// GetNumDeclarations returns the number of keywords, imports, typedefs, structs and classes which
+//  have been declared; see WriteFrom.
+func (f *File) GetNumDeclarations() int {
+	return len(f.declarations)
+}
+
 func (f File) GenerateHash(generator *HashGenerator) {
 	generator.AddInt(1)
 	generator.AddInt(len(f.classes) + len(f.structs))
@@ -0,0 +1,568 @@
+package dc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var goNumericTypes = map[Type]string{
+	T_INT8:    "Int8",
+	T_INT16:   "Int16",
+	T_INT32:   "Int32",
+	T_INT64:   "Int64",
+	T_UINT8:   "Uint8",
+	T_UINT16:  "Uint16",
+	T_UINT32:  "Uint32",
+	T_UINT64:  "Uint64",
+	T_CHAR:    "Uint8",
+	T_FLOAT32: "Float32",
+	T_FLOAT64: "Float64",
+}
+
+// goWriter generates Go code for the classes of a file; see WriteGo.
+type goWriter struct {
+	bytes.Buffer
+	file *File
+	err  error
+
+	// The Go type generated for each struct and switch, and for the value of each class field
+	typeNames  map[BaseType]string
+	fieldTypes map[Field]string
+
+	// Structs and switches which are used but have not been generated yet
+	pending []BaseType
+
+	vars     int
+	usesMath bool
+}
+
+// goMember is a member of a generated Go struct, which is packed in order. The components of a
+//  molecular field have no type of their own, and are instead given the type generated for them.
+type goMember struct {
+	name     string
+	dtype    BaseType
+	typeName string
+}
+
+const goPrelude = `
+// Field is implemented by the value of every field of the generated classes.
+type Field interface {
+	// FieldId returns the ID of the field in the DC file.
+	FieldId() uint16
+
+	Pack(dg *util.Datagram)
+	Unpack(dgi *util.DatagramIterator)
+}
+
+// SetField builds a STATESERVER_OBJECT_SET_FIELD which updates a field of an object.
+func SetField(doid util.Doid_t, from util.Channel_t, field Field) util.Datagram {
+	dg := util.NewDatagram()
+	dg.AddServerHeader(util.Channel_t(doid), from, util.STATESERVER_OBJECT_SET_FIELD)
+	dg.AddDoid(doid)
+	dg.AddUint16(field.FieldId())
+	field.Pack(&dg)
+	return dg
+}
+`
+
+// WriteGo generates a Go package named pkg with a typed value for every field of every class, which
+//  packs and unpacks itself with util.Datagram. Code using the package no longer assembles field
+//  values by hand, so a change to the DC file which it is not updated for fails to compile. Structs
+//  and switches are generated as Go structs; integers with a divisor become float64.
+func (f *File) WriteGo(w io.Writer, pkg string) error {
+	gw := &goWriter{file: f, typeNames: make(map[BaseType]string), fieldTypes: make(map[Field]string)}
+
+	hasher := NewHashGenerator()
+	f.GenerateHash(hasher)
+	fmt.Fprintf(gw, "\n// DCHash is the hash of the DC files which the package was generated from.\n")
+	fmt.Fprintf(gw, "const DCHash uint32 = 0x%x\n", hasher.Hash())
+	gw.WriteString(goPrelude)
+
+	for _, decl := range f.declarations {
+		switch decl := decl.(type) {
+		case *typedef:
+			if sw, ok := decl.dtype.(*SwitchType); ok && sw.name == decl.name {
+				gw.namedType(sw, "")
+			}
+		case *Struct:
+			gw.namedType(decl, "")
+		case *Class:
+			gw.writeClass(decl)
+		}
+		gw.writePending()
+	}
+
+	if gw.err != nil {
+		return gw.err
+	}
+
+	header := new(bytes.Buffer)
+	header.WriteString("// Code generated by astron dc gen-go. DO NOT EDIT.\n\n")
+	fmt.Fprintf(header, "package %s\n\nimport (\n\t\"astrongo/util\"\n", pkg)
+	if gw.usesMath {
+		header.WriteString("\t\"math\"\n")
+	}
+	header.WriteString(")\n")
+
+	source, err := format.Source(append(header.Bytes(), gw.Bytes()...))
+	if err != nil {
+		return errors.New(fmt.Sprintf("generated invalid Go code: %s", err))
+	}
+
+	_, err = w.Write(source)
+	return err
+}
+
+func (w *goWriter) fail(format string, args ...interface{}) {
+	if w.err == nil {
+		w.err = errors.New(fmt.Sprintf(format, args...))
+	}
+}
+
+// exportName converts a DC identifier into an exported Go one, e.g. set_name and setName become SetName.
+func exportName(name string) string {
+	var str strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			str.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return str.String()
+}
+
+func memberName(name string, n int) string {
+	if name == "" {
+		return fmt.Sprintf("Field%d", n)
+	}
+	return exportName(name)
+}
+
+// namedType returns the name of the Go type generated for a struct or switch, queueing it to be
+//  generated if it has not been already. Anonymous switches are named after where they are used.
+func (w *goWriter) namedType(t BaseType, hint string) string {
+	if name, ok := w.typeNames[t]; ok {
+		return name
+	}
+
+	name := hint
+	switch t := t.(type) {
+	case *Struct:
+		name = exportName(t.name)
+	case *SwitchType:
+		if t.name != "" {
+			name = exportName(t.name)
+		}
+	}
+
+	w.typeNames[t] = name
+	w.pending = append(w.pending, t)
+	return name
+}
+
+func (w *goWriter) writePending() {
+	for len(w.pending) != 0 {
+		t := w.pending[0]
+		w.pending = w.pending[1:]
+
+		switch t := t.(type) {
+		case *Struct:
+			var members []goMember
+			for n, field := range t.fields {
+				members = append(members, goMember{name: memberName(field.Name(), n), dtype: field.FieldType()})
+			}
+
+			name := w.typeNames[t]
+			fmt.Fprintf(w, "\n// %s is the DC struct %s.\n", name, t.name)
+			w.writeStruct(name, members)
+			w.writeMethods(name, members)
+		case *SwitchType:
+			w.writeSwitch(t, w.typeNames[t])
+		}
+	}
+}
+
+func (w *goWriter) writeStruct(name string, members []goMember) {
+	fmt.Fprintf(w, "type %s struct {\n", name)
+	for _, member := range members {
+		if member.typeName != "" {
+			fmt.Fprintf(w, "\t%s %s\n", member.name, member.typeName)
+		} else {
+			fmt.Fprintf(w, "\t%s %s\n", member.name, w.goType(member.dtype, name+member.name))
+		}
+	}
+	w.WriteString("}\n")
+}
+
+func (w *goWriter) writeMethods(name string, members []goMember) {
+	fmt.Fprintf(w, "\nfunc (v *%s) Pack(dg *util.Datagram) {\n", name)
+	for _, member := range members {
+		w.pack("dg", "v."+member.name, member.dtype, "\t")
+	}
+	w.WriteString("}\n")
+
+	fmt.Fprintf(w, "\nfunc (v *%s) Unpack(dgi *util.DatagramIterator) {\n", name)
+	for _, member := range members {
+		w.unpack("v."+member.name, member.dtype, "\t")
+	}
+	w.WriteString("}\n")
+}
+
+func (w *goWriter) writeClass(c *Class) {
+	name := exportName(c.name)
+	for _, field := range c.baseFields {
+		w.writeField(name, field)
+	}
+
+	fields := append([]Field{}, c.fields...)
+	if c.constructor != nil {
+		fields = append(fields, c.constructor)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Id() < fields[j].Id() })
+
+	fmt.Fprintf(w, "\nconst %sClassId uint16 = %d\n", name, c.id)
+
+	fmt.Fprintf(w, "\n// %s holds the value of each field of the DC class %s which has been set.\n", name, c.name)
+	fmt.Fprintf(w, "type %s struct {\n", name)
+	for _, field := range fields {
+		fmt.Fprintf(w, "\t%s *%s\n", exportName(field.Name()), w.fieldTypes[field])
+	}
+	w.WriteString("}\n")
+
+	fmt.Fprintf(w, "\n// Decode%sField reads the value of the field of %s with the given ID.\n", name, c.name)
+	fmt.Fprintf(w, "func Decode%sField(fieldId uint16, dgi *util.DatagramIterator) (field Field, ok bool) {\n", name)
+	w.WriteString("\tswitch fieldId {\n")
+	for _, field := range fields {
+		fmt.Fprintf(w, "\tcase %d:\n\t\tfield = &%s{}\n", field.Id(), w.fieldTypes[field])
+	}
+	w.WriteString("\tdefault:\n\t\treturn nil, false\n\t}\n\n\tfield.Unpack(dgi)\n\treturn field, true\n}\n")
+
+	fmt.Fprintf(w, "\n// Set stores the value of a field, reporting whether it belongs to %s.\n", c.name)
+	fmt.Fprintf(w, "func (o *%s) Set(field Field) bool {\n", name)
+	if len(fields) != 0 {
+		w.WriteString("\tswitch f := field.(type) {\n")
+		for _, field := range fields {
+			fmt.Fprintf(w, "\tcase *%s:\n\t\to.%s = f\n", w.fieldTypes[field], exportName(field.Name()))
+		}
+		w.WriteString("\tdefault:\n\t\treturn false\n\t}\n\treturn true\n")
+	} else {
+		w.WriteString("\treturn false\n")
+	}
+	w.WriteString("}\n")
+
+	w.WriteString("\n// Fields returns the values of the fields which have been set, in order of their IDs.\n")
+	fmt.Fprintf(w, "func (o *%s) Fields() []Field {\n\tvar fields []Field\n", name)
+	for _, field := range fields {
+		member := exportName(field.Name())
+		fmt.Fprintf(w, "\tif o.%s != nil {\n\t\tfields = append(fields, o.%s)\n\t}\n", member, member)
+	}
+	w.WriteString("\treturn fields\n}\n")
+}
+
+func (w *goWriter) writeField(class string, field Field) {
+	name := class + exportName(field.Name())
+	w.fieldTypes[field] = name
+
+	var members []goMember
+	switch field := field.(type) {
+	case *MolecularField:
+		for _, component := range field.fields {
+			members = append(members, goMember{name: exportName(component.Name()), typeName: w.fieldTypes[component]})
+		}
+	case *AtomicField:
+		if method, ok := field.fieldType.(*Method); ok {
+			for n, param := range method.parameters {
+				members = append(members, goMember{name: memberName(param.name, n), dtype: param.dataType})
+			}
+		} else {
+			members = append(members, goMember{name: "Value", dtype: field.fieldType})
+		}
+	}
+
+	fmt.Fprintf(w, "\n// %s is the value of the field %s of %s.\n", name, field.Name(), class)
+	w.writeStruct(name, members)
+	fmt.Fprintf(w, "\nfunc (v *%s) FieldId() uint16 { return %d }\n", name, field.Id())
+	w.writeMethods(name, members)
+
+	w.WriteString("\n// Send builds a STATESERVER_OBJECT_SET_FIELD which sets the field of an object to this value.\n")
+	fmt.Fprintf(w, "func (v *%s) Send(doid util.Doid_t, from util.Channel_t) util.Datagram {\n", name)
+	w.WriteString("\treturn SetField(doid, from, v)\n}\n")
+}
+
+// writeSwitch generates a struct holding the key of a switch along with the fields of every case.
+//  Fields of different cases with the same name and type share a member.
+func (w *goWriter) writeSwitch(s *SwitchType, name string) {
+	members := []goMember{{name: "Key", dtype: s.key}}
+	types := map[string]string{"Key": w.goType(s.key, name)}
+
+	var groups []*switchFields
+	groupMembers := make(map[*switchFields][]goMember)
+	for _, c := range append(append([]*SwitchCase{}, s.cases...), s.defaultCase) {
+		if c == nil {
+			continue
+		}
+
+		if _, ok := groupMembers[c.fields]; ok {
+			continue
+		}
+		groups = append(groups, c.fields)
+		groupMembers[c.fields] = []goMember{}
+
+		for n, field := range c.fields.fields {
+			member := goMember{name: memberName(field.Name(), n), dtype: field.FieldType()}
+			goType := w.goType(member.dtype, name+member.name)
+			if existing, ok := types[member.name]; ok && existing != goType {
+				member.name += strconv.Itoa(len(groups))
+				goType = w.goType(member.dtype, name+member.name)
+			}
+
+			if _, ok := types[member.name]; !ok {
+				types[member.name] = goType
+				members = append(members, member)
+			}
+			groupMembers[c.fields] = append(groupMembers[c.fields], member)
+		}
+	}
+
+	fmt.Fprintf(w, "\n// %s is a switch; only the members for the case selected by its key are packed.\n", name)
+	w.writeStruct(name, members)
+
+	for _, method := range []string{"Pack", "Unpack"} {
+		if method == "Pack" {
+			fmt.Fprintf(w, "\nfunc (v *%s) Pack(dg *util.Datagram) {\n", name)
+			w.pack("dg", "v.Key", s.key, "\t")
+		} else {
+			fmt.Fprintf(w, "\nfunc (v *%s) Unpack(dgi *util.DatagramIterator) {\n", name)
+			w.unpack("v.Key", s.key, "\t")
+		}
+
+		if s.key.Type() == T_VARBLOB {
+			w.WriteString("\tswitch string(v.Key) {\n")
+		} else {
+			w.WriteString("\tswitch v.Key {\n")
+		}
+
+		for _, fields := range groups {
+			var values []string
+			for _, c := range s.cases {
+				if c.fields == fields {
+					values = append(values, goCaseValue(s, c.value))
+				}
+			}
+
+			if s.defaultCase != nil && s.defaultCase.fields == fields {
+				if len(values) != 0 {
+					fmt.Fprintf(w, "\tcase %s:\n\t\tfallthrough\n", strings.Join(values, ", "))
+				}
+				w.WriteString("\tdefault:\n")
+			} else {
+				fmt.Fprintf(w, "\tcase %s:\n", strings.Join(values, ", "))
+			}
+
+			for _, member := range groupMembers[fields] {
+				if method == "Pack" {
+					w.pack("dg", "v."+member.name, member.dtype, "\t\t")
+				} else {
+					w.unpack("v."+member.name, member.dtype, "\t\t")
+				}
+			}
+		}
+		w.WriteString("\t}\n}\n")
+	}
+}
+
+// goCaseValue returns the Go literal for a switch case, which is given as it appears on the wire.
+func goCaseValue(s *SwitchType, value []byte) string {
+	if key, ok := s.key.(*NumericType); ok && key.Divisor != 1 {
+		raw, _ := strconv.ParseFloat(caseValue(s, value), 64)
+		return strconv.FormatFloat(raw/float64(key.Divisor), 'g', -1, 64)
+	}
+
+	if _, ok := s.key.(*ArrayType); ok && s.key.HasFixedSize() {
+		var elems []string
+		for _, b := range value {
+			elems = append(elems, strconv.Itoa(int(b)))
+		}
+		return fmt.Sprintf("[%d]byte{%s}", len(value), strings.Join(elems, ", "))
+	}
+
+	return caseValue(s, value)
+}
+
+// goType returns the Go type representing values of a DC type. Structs and switches without a name
+//  of their own are named by the hint.
+func (w *goWriter) goType(t BaseType, hint string) string {
+	switch t := t.(type) {
+	case *NumericType:
+		switch {
+		case t.Divisor != 1 && t.dataType != T_FLOAT32:
+			return "float64"
+		case t.dataType == T_CHAR:
+			return "byte"
+		}
+		return numericTypeNames[t.dataType]
+	case *ArrayType:
+		switch {
+		case t.isBytes() && t.dataType == T_VARSTRING:
+			return "string"
+		case t.isBytes() && t.dataType == T_VARBLOB:
+			return "[]byte"
+		case t.isBytes():
+			return fmt.Sprintf("[%d]byte", t.arraySize)
+		case t.HasFixedSize():
+			return fmt.Sprintf("[%d]%s", t.arraySize, w.goType(t.elemType, hint+"Elem"))
+		}
+		return "[]" + w.goType(t.elemType, hint+"Elem")
+	case *Class:
+		w.fail("class %s cannot be used as a type in generated code", t.name)
+		return "struct{}"
+	case *Struct, *SwitchType:
+		return w.namedType(t, hint)
+	case *Method:
+		var params []string
+		for n, param := range t.parameters {
+			name := memberName(param.name, n)
+			params = append(params, name+" "+w.goType(param.dataType, hint+name))
+		}
+		return "struct {\n" + strings.Join(params, "\n") + "\n}"
+	}
+
+	w.fail("type %d cannot be used in generated code", t.Type())
+	return "struct{}"
+}
+
+func (w *goWriter) newVar(prefix string) string {
+	w.vars++
+	return prefix + strconv.Itoa(w.vars)
+}
+
+// pack writes the statements which add the value of expr to the datagram pointed to by dg.
+func (w *goWriter) pack(dg string, expr string, t BaseType, indent string) {
+	// Datagrams of nested arrays are local variables, whose methods are called without taking their address
+	local := strings.TrimPrefix(dg, "&")
+
+	switch t := t.(type) {
+	case *NumericType:
+		method := goNumericTypes[t.dataType]
+		switch {
+		case t.Modulus != 0:
+			w.packModulus(local, expr, t, indent)
+		case t.Divisor == 1:
+			fmt.Fprintf(w, "%s%s.Add%s(%s)\n", indent, local, method, expr)
+		case t.dataType == T_FLOAT32 || t.dataType == T_FLOAT64:
+			fmt.Fprintf(w, "%s%s.Add%s(%s * %d)\n", indent, local, method, expr, t.Divisor)
+		default:
+			w.usesMath = true
+			fmt.Fprintf(w, "%s%s.Add%s(%s(math.Floor(%s*%d + 0.5)))\n",
+				indent, local, method, strings.ToLower(method), expr, t.Divisor)
+		}
+	case *ArrayType:
+		switch {
+		case t.isBytes() && t.dataType == T_VARSTRING:
+			fmt.Fprintf(w, "%s%s.AddString(%s)\n", indent, local, expr)
+		case t.isBytes() && t.dataType == T_VARBLOB:
+			fmt.Fprintf(w, "%s%s.AddDataBlob(%s)\n", indent, local, expr)
+		case t.isBytes():
+			fmt.Fprintf(w, "%s%s.AddData(%s[:])\n", indent, local, expr)
+		case t.HasFixedSize():
+			i := w.newVar("i")
+			fmt.Fprintf(w, "%sfor %s := range %s {\n", indent, i, expr)
+			w.pack(dg, expr+"["+i+"]", t.elemType, indent+"\t")
+			fmt.Fprintf(w, "%s}\n", indent)
+		default:
+			array, elem := w.newVar("array"), w.newVar("elem")
+			fmt.Fprintf(w, "%s%s := util.NewDatagram()\n", indent, array)
+			fmt.Fprintf(w, "%sfor _, %s := range %s {\n", indent, elem, expr)
+			w.pack("&"+array, elem, t.elemType, indent+"\t")
+			fmt.Fprintf(w, "%s}\n", indent)
+			fmt.Fprintf(w, "%s%s.AddBlob(&%s)\n", indent, local, array)
+		}
+	case *Method:
+		for n, param := range t.parameters {
+			w.pack(dg, expr+"."+memberName(param.name, n), param.dataType, indent)
+		}
+	default:
+		fmt.Fprintf(w, "%s%s.Pack(%s)\n", indent, expr, dg)
+	}
+}
+
+// packModulus writes the statements which add a value of a numeric type with a modulus, bringing it
+//  into the range of the modulus first as Pack does.
+func (w *goWriter) packModulus(dg string, expr string, t *NumericType, indent string) {
+	method := goNumericTypes[t.dataType]
+	name := strings.ToLower(method)
+	v := w.newVar("mod")
+
+	switch {
+	case t.dataType == T_FLOAT32 || t.dataType == T_FLOAT64:
+		modulus := t.calculatedModulus.Float
+		w.usesMath = true
+		fmt.Fprintf(w, "%s%s := math.Mod(float64(%s)*%d, %v)\n", indent, v, expr, t.Divisor, modulus)
+		fmt.Fprintf(w, "%sif %s < 0 {\n%s\t%s += %v\n%s}\n", indent, v, indent, v, modulus, indent)
+	case t.dataType == T_UINT64 && t.Divisor == 1:
+		// Unsigned values are never negative, and may not fit into an int64
+		fmt.Fprintf(w, "%s%s.Add%s(%s %% %d)\n", indent, dg, method, expr, t.calculatedModulus.Uinteger)
+		return
+	default:
+		modulus := t.calculatedModulus.Uinteger
+		scaled := "int64(" + expr + ")"
+		if t.Divisor != 1 {
+			w.usesMath = true
+			scaled = fmt.Sprintf("int64(math.Floor(%s*%d + 0.5))", expr, t.Divisor)
+		}
+		fmt.Fprintf(w, "%s%s := %s %% %d\n", indent, v, scaled, modulus)
+		fmt.Fprintf(w, "%sif %s < 0 {\n%s\t%s += %d\n%s}\n", indent, v, indent, v, modulus, indent)
+	}
+	fmt.Fprintf(w, "%s%s.Add%s(%s(%s))\n", indent, dg, method, name, v)
+}
+
+// unpack writes the statements which read a value from dgi into expr.
+func (w *goWriter) unpack(expr string, t BaseType, indent string) {
+	switch t := t.(type) {
+	case *NumericType:
+		method := goNumericTypes[t.dataType]
+		switch {
+		case t.Divisor == 1:
+			fmt.Fprintf(w, "%s%s = dgi.Read%s()\n", indent, expr, method)
+		case t.dataType == T_FLOAT32 || t.dataType == T_FLOAT64:
+			fmt.Fprintf(w, "%s%s = dgi.Read%s() / %d\n", indent, expr, method, t.Divisor)
+		default:
+			fmt.Fprintf(w, "%s%s = float64(dgi.Read%s()) / %d\n", indent, expr, method, t.Divisor)
+		}
+	case *ArrayType:
+		switch {
+		case t.isBytes() && t.dataType == T_VARSTRING:
+			fmt.Fprintf(w, "%s%s = dgi.ReadString()\n", indent, expr)
+		case t.isBytes() && t.dataType == T_VARBLOB:
+			fmt.Fprintf(w, "%s%s = dgi.ReadBlob()\n", indent, expr)
+		case t.isBytes():
+			fmt.Fprintf(w, "%scopy(%s[:], dgi.ReadData(%d))\n", indent, expr, t.arraySize)
+		case t.HasFixedSize():
+			i := w.newVar("i")
+			fmt.Fprintf(w, "%sfor %s := range %s {\n", indent, i, expr)
+			w.unpack(expr+"["+i+"]", t.elemType, indent+"\t")
+			fmt.Fprintf(w, "%s}\n", indent)
+		default:
+			end, elem := w.newVar("end"), w.newVar("elem")
+			fmt.Fprintf(w, "%s%s := dgi.ReadSize()\n", indent, end)
+			fmt.Fprintf(w, "%s%s += dgi.Tell()\n", indent, end)
+			fmt.Fprintf(w, "%s%s = nil\n", indent, expr)
+			fmt.Fprintf(w, "%sfor dgi.Tell() < %s {\n", indent, end)
+			fmt.Fprintf(w, "%s\tvar %s %s\n", indent, elem, w.goType(t.elemType, ""))
+			w.unpack(elem, t.elemType, indent+"\t")
+			fmt.Fprintf(w, "%s\t%s = append(%s, %s)\n", indent, expr, expr, elem)
+			fmt.Fprintf(w, "%s}\n", indent)
+		}
+	case *Method:
+		for n, param := range t.parameters {
+			w.unpack(expr+"."+memberName(param.name, n), param.dataType, indent)
+		}
+	default:
+		fmt.Fprintf(w, "%s%s.Unpack(dgi)\n", indent, expr)
+	}
+}
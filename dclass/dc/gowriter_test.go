@@ -0,0 +1,84 @@
+package dc_test
+
+import (
+	"astrongo/dclass/parse"
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// typeCheck fails the test if generated code does not compile against the packages it imports.
+func typeCheck(t *testing.T, name string, src []byte) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name+".go", src, 0)
+	if err != nil {
+		t.Fatalf("%s: generated code does not parse: %s", name, err)
+	}
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check(name, fset, []*ast.File{file}, nil); err != nil {
+		t.Fatalf("%s: generated code does not compile: %s", name, err)
+	}
+}
+
+func TestFile_WriteGo(t *testing.T) {
+	for _, file := range []string{"dclass/parse/test.dc", "util/test.dc"} {
+		dct, err := parse.ParseFile(file)
+		if err != nil {
+			t.Fatalf("%s parse failed: %s", file, err)
+		}
+
+		var out bytes.Buffer
+		if err := dct.Traverse().WriteGo(&out, "dclass"); err != nil {
+			t.Fatalf("%s: generating Go failed: %s", file, err)
+		}
+		typeCheck(t, file, out.Bytes())
+	}
+
+	dct, err := parse.ParseString(`
+struct Point {
+	int16 / 10 x;
+	int16 / 10 y;
+};
+
+dclass DistributedToon {
+	setName(string name) required db;
+	setPath(Point points[]) broadcast;
+	setHeading(int16 % 360 h, uint16 / 10 % 360 p, float64 % 360 r, uint64 % 1000 t) broadcast;
+};`)
+	if err != nil {
+		t.Fatalf("dclass parse failed: %s", err)
+	}
+
+	var out bytes.Buffer
+	if err := dct.Traverse().WriteGo(&out, "toon"); err != nil {
+		t.Fatalf("generating Go failed: %s", err)
+	}
+	typeCheck(t, "toon", out.Bytes())
+
+	for _, expected := range []string{
+		"package toon",
+		"type Point struct {\n\tX float64\n\tY float64\n}",
+		"dg.AddInt16(int16(math.Floor(v.X*10 + 0.5)))",
+		"type DistributedToonSetName struct {\n\tName string\n}",
+		"func (v *DistributedToonSetName) FieldId() uint16 { return 2 }",
+		"type DistributedToonSetPath struct {\n\tPoints []Point\n}",
+		"const DistributedToonClassId uint16 = 1",
+		"func DecodeDistributedToonField(fieldId uint16, dgi *util.DatagramIterator) (field Field, ok bool) {",
+
+		// Values are brought into the range of their modulus before being packed, as Pack does
+		" := int64(v.H) % 360\n",
+		" := int64(math.Floor(v.P*10+0.5)) % 3600\n",
+		" := math.Mod(float64(v.R)*1, 360)\n",
+		"dg.AddUint64(v.T % 1000)",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("generated code does not contain:\n%s", expected)
+		}
+	}
+}
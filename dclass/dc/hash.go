@@ -30,6 +30,13 @@ func (g *HashGenerator) AddString(str string) {
 	}
 }
 
+func (g *HashGenerator) AddBlob(blob []byte) {
+	g.AddInt(len(blob))
+	for _, b := range blob {
+		g.AddInt(int(b))
+	}
+}
+
 func (g *HashGenerator) Hash() uint32 {
 	return g.hash
 }
@@ -0,0 +1,58 @@
+package dc
+
+// Suffixes used by DC imports to name the views of a class; e.g. `from game import Toon/AI/OV`
+//  means that game.Toon is used by clients, game.ToonAI by the AI and game.ToonOV by owners.
+const (
+	SUFFIX_CLIENT = ""
+	SUFFIX_AI     = "AI"
+	SUFFIX_OV     = "OV"
+	SUFFIX_UD     = "UD"
+)
+
+type Import struct {
+	module         string
+	moduleSuffixes []string
+	symbol         string
+	symbolSuffixes []string
+}
+
+func NewImport(module string, moduleSuffixes []string, symbol string, symbolSuffixes []string) *Import {
+	return &Import{module: module, moduleSuffixes: moduleSuffixes, symbol: symbol, symbolSuffixes: symbolSuffixes}
+}
+
+func (i *Import) Module() string           { return i.module }
+func (i *Import) ModuleSuffixes() []string { return i.moduleSuffixes }
+func (i *Import) Symbol() string           { return i.symbol }
+func (i *Import) SymbolSuffixes() []string { return i.symbolSuffixes }
+
+// Implementation returns the module and symbol which implement the imported symbol for the view with
+//  the given suffix. The base symbol is always available; other views only if the import lists them.
+func (i *Import) Implementation(suffix string) (module string, symbol string, ok bool) {
+	if suffix == SUFFIX_CLIENT {
+		return i.module, i.symbol, true
+	}
+
+	if !hasSuffix(i.symbolSuffixes, suffix) {
+		return "", "", false
+	}
+
+	module = i.module
+	switch {
+	case hasSuffix(i.moduleSuffixes, suffix):
+		module += suffix
+	case suffix == SUFFIX_UD && hasSuffix(i.moduleSuffixes, SUFFIX_AI):
+		// Like Panda3D, UberDOGs fall back to the AI module if they do not have their own.
+		module += SUFFIX_AI
+	}
+
+	return module, i.symbol + suffix, true
+}
+
+func hasSuffix(suffixes []string, suffix string) bool {
+	for _, s := range suffixes {
+		if s == suffix {
+			return true
+		}
+	}
+	return false
+}
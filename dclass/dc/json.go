@@ -0,0 +1,203 @@
+package dc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// FieldValue is the packed value of one field of a class.
+type FieldValue struct {
+	Field Field
+	Data  []byte
+}
+
+// FieldsToJSON converts packed field values into a JSON object, keyed by field name in the order given,
+//  e.g. {"setName": ["Bob"]}. Values are represented as described by Unpack, except that blobs are
+//  base64 encoded. Integers are written exactly, even beyond the precision of a JSON float.
+func (c *Class) FieldsToJSON(values ...FieldValue) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	for n, fv := range values {
+		if field, ok := c.fieldsById[fv.Field.Id()]; !ok || field != fv.Field {
+			return nil, errors.New(fmt.Sprintf("class %s has no field named %s", c.name, fv.Field.Name()))
+		}
+
+		value, size, err := Unpack(fv.Field, fv.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		if size != len(fv.Data) {
+			return nil, errors.New(fmt.Sprintf("%s: %d unexpected bytes after the value", fv.Field.Name(), len(fv.Data)-size))
+		}
+
+		if err := checkStrings(value); err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: %s", fv.Field.Name(), err))
+		}
+
+		name, _ := json.Marshal(fv.Field.Name())
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: %s", fv.Field.Name(), err))
+		}
+
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// FieldsFromJSON converts a JSON object, as produced by FieldsToJSON, back into packed field values
+//  in the order they appear.
+func (c *Class) FieldsFromJSON(data []byte) ([]FieldValue, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, errors.New("expected a JSON object of field values")
+	}
+
+	var values []FieldValue
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		name := token.(string)
+		field, ok := c.GetFieldByName(name)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("class %s has no field named %s", c.name, name))
+		}
+
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: %s", name, err))
+		}
+
+		value, err = fromJSON(field.FieldType(), value)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: %s", name, err))
+		}
+
+		packed, err := Pack(field, value)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, FieldValue{Field: field, Data: packed})
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// checkStrings refuses strings which are not valid UTF-8, which JSON cannot represent exactly.
+func checkStrings(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		if !utf8.ValidString(v) {
+			return errors.New(fmt.Sprintf("string %q is not valid UTF-8", v))
+		}
+	case []interface{}:
+		for _, elem := range v {
+			if err := checkStrings(elem); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// fromJSON converts a decoded JSON value into one which can be packed as the given type, which
+//  amounts to decoding blobs. Values of the wrong shape are passed on for Pack to report.
+func fromJSON(dtype BaseType, value interface{}) (interface{}, error) {
+	values, isList := value.([]interface{})
+
+	switch t := dtype.(type) {
+	case *ArrayType:
+		if t.isBytes() {
+			if s, ok := value.(string); ok && (t.dataType == T_BLOB || t.dataType == T_VARBLOB) {
+				data, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("blob is not valid base64: %s", err))
+				}
+				return data, nil
+			}
+			return value, nil
+		}
+
+		if isList {
+			return listFromJSON(values, func(n int) BaseType { return t.elemType })
+		}
+	case *MolecularField:
+		if isList && len(values) == len(t.fields) {
+			return listFromJSON(values, func(n int) BaseType { return t.fields[n].FieldType() })
+		}
+	case *Class:
+		if isList && len(values) == len(t.fields) {
+			return listFromJSON(values, func(n int) BaseType { return t.fields[n].FieldType() })
+		}
+	case *Struct:
+		if isList && len(values) == len(t.fields) {
+			return listFromJSON(values, func(n int) BaseType { return t.fields[n].FieldType() })
+		}
+	case *Method:
+		if isList && len(values) == len(t.parameters) {
+			return listFromJSON(values, func(n int) BaseType { return t.parameters[n].dataType })
+		}
+	case *SwitchType:
+		if !isList || len(values) == 0 {
+			break
+		}
+
+		key, err := fromJSON(t.key, values[0])
+		if err != nil {
+			return nil, err
+		}
+
+		packed, err := PackType(t.key, key)
+		if err != nil {
+			return value, nil
+		}
+
+		c, ok := t.CaseByValue(packed)
+		if !ok || len(values)-1 != len(c.fields.fields) {
+			return value, nil
+		}
+
+		fields, err := listFromJSON(values[1:], func(n int) BaseType { return c.fields.fields[n].FieldType() })
+		if err != nil {
+			return nil, err
+		}
+		return append([]interface{}{key}, fields...), nil
+	}
+
+	return value, nil
+}
+
+func listFromJSON(values []interface{}, elemType func(n int) BaseType) ([]interface{}, error) {
+	converted := make([]interface{}, len(values))
+	for n, value := range values {
+		var err error
+		if converted[n], err = fromJSON(elemType(n), value); err != nil {
+			return nil, err
+		}
+	}
+
+	return converted, nil
+}
@@ -0,0 +1,66 @@
+package dc_test
+
+import (
+	"astrongo/dclass/parse"
+	"bytes"
+	"testing"
+)
+
+func TestClass_FieldsJSON(t *testing.T) {
+	dctree, err := parse.ParseString(`
+struct Pos {
+	int16 / 10 x;
+	int16 / 10 y;
+};
+
+switch Item (string) {
+	case "hat":
+		uint8 size;
+		break;
+	case "key":
+		blob code;
+};
+
+dclass DistributedToon {
+	setName(string name) required db;
+	setBalance(uint64 balance, int64 debt) db;
+	setPos(Pos pos, float64 h) broadcast;
+	setIcon(blob icon) db;
+	setItems(Item items[]) ownrecv;
+};`)
+	if err != nil {
+		t.Fatalf("dclass parse failed: %s", err)
+	}
+
+	cls, _ := dctree.Traverse().ClassByName("DistributedToon")
+	expected := `{"setName":["Bob"],"setBalance":[18446744073709551615,-9223372036854775808],` +
+		`"setPos":[[1.5,-0.3],0.1],"setIcon":["AAH/"],"setItems":[[["hat",3],["key","c2VjcmV0"]]]}`
+
+	values, err := cls.FieldsFromJSON([]byte(expected))
+	if err != nil {
+		t.Fatalf("converting from JSON failed: %s", err)
+	}
+
+	if len(values) != 5 {
+		t.Fatalf("expected 5 field values, got %d", len(values))
+	}
+
+	if !bytes.Equal(values[0].Data, []byte{3, 0, 0, 0, 'B', 'o', 'b'}) {
+		t.Errorf("unexpected packed name: %v", values[0].Data)
+	}
+
+	result, err := cls.FieldsToJSON(values...)
+	if err != nil {
+		t.Fatalf("converting to JSON failed: %s", err)
+	}
+
+	if string(result) != expected {
+		t.Errorf("JSON did not round-trip:\n%s", result)
+	}
+
+	for _, bad := range []string{`{"setHp":[1]}`, `{"setIcon":["!!"]}`, `{"setBalance":[-1,0]}`} {
+		if _, err := cls.FieldsFromJSON([]byte(bad)); err == nil {
+			t.Errorf("expected an error converting %s", bad)
+		}
+	}
+}
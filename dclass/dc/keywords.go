@@ -1,9 +1,30 @@
 package dc
 
+// The keywords which were built into older versions of Panda3D; these are implicitly declared by every
+//  DC file, and are hashed as flags rather than by name.
+var historicalKeywords = []struct {
+	name string
+	flag int
+}{
+	{"required", 0x0001},
+	{"broadcast", 0x0002},
+	{"ownrecv", 0x0004},
+	{"ram", 0x0008},
+	{"db", 0x0010},
+	{"clsend", 0x0020},
+	{"clrecv", 0x0040},
+	{"ownsend", 0x0080},
+	{"airecv", 0x0100},
+}
+
 type KeywordList struct {
 	keywords []string
 }
 
+func (k *KeywordList) GetKeywords() []string {
+	return k.keywords
+}
+
 func (k *KeywordList) AddKeyword(kw string) {
 	k.keywords = append(k.keywords, kw)
 }
@@ -36,16 +57,9 @@ func (k *KeywordList) Copy(other KeywordList) {
 }
 
 func (k *KeywordList) GenerateHash(generator *HashGenerator) {
-	keywords := map[string]int{
-		"required":  0x0001,
-		"broadcast": 0x0002,
-		"ownrecv":   0x0004,
-		"ram":       0x0008,
-		"db":        0x0010,
-		"clsend":    0x0020,
-		"clrecv":    0x0040,
-		"ownsend":   0x0080,
-		"airecv":    0x0100,
+	keywords := make(map[string]int, len(historicalKeywords))
+	for _, kw := range historicalKeywords {
+		keywords[kw.name] = kw.flag
 	}
 
 	flags := 0
@@ -0,0 +1,223 @@
+package dc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// SwitchCase is a set of fields selected by a switch when its key matches one of the case values.
+//  Cases which fall through into each other (i.e. are not separated by a break) share the same fields.
+type SwitchCase struct {
+	value  []byte
+	fields *switchFields
+}
+
+type switchFields struct {
+	fields       []Field
+	fieldsByName map[string]Field
+}
+
+type SwitchType struct {
+	DistributedType
+
+	name string
+	key  BaseType
+
+	cases        []*SwitchCase
+	casesByValue map[string]*SwitchCase
+	defaultCase  *SwitchCase
+
+	// The fields which newly added fields are appended to, or nil after a break.
+	current *switchFields
+}
+
+func NewSwitch(name string, key BaseType) (s *SwitchType, err error) {
+	switch key.Type() {
+	case T_INT8, T_INT16, T_INT32, T_INT64, T_UINT8, T_UINT16, T_UINT32, T_UINT64, T_CHAR,
+		T_STRING, T_VARSTRING, T_BLOB, T_VARBLOB:
+	default:
+		return nil, errors.New("switch keys must be an integer, string or blob type")
+	}
+
+	s = &SwitchType{name: name, key: key}
+	s.dataType = T_SWITCH
+	s.casesByValue = make(map[string]*SwitchCase, 0)
+	return s, nil
+}
+
+func (s *SwitchType) Name() string  { return s.name }
+func (s *SwitchType) Key() BaseType { return s.key }
+
+func (s *SwitchType) GetNumCases() int          { return len(s.cases) }
+func (s *SwitchType) GetCase(n int) *SwitchCase { return s.cases[n] }
+func (s *SwitchType) DefaultCase() *SwitchCase  { return s.defaultCase }
+
+// CaseByValue returns the case selected by a key as it appears on the wire, falling back to the
+//  default case if no case matches.
+func (s *SwitchType) CaseByValue(value []byte) (c *SwitchCase, ok bool) {
+	if c, ok := s.casesByValue[string(value)]; ok {
+		return c, true
+	}
+
+	return s.defaultCase, s.defaultCase != nil
+}
+
+// AddCase adds a case matching the given value, which is an int64 for integer keys or a string for
+//  string and blob keys.
+func (s *SwitchType) AddCase(value interface{}) (err error) {
+	packed, err := s.packKey(value)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := s.casesByValue[string(packed)]; ok {
+		return errors.New(fmt.Sprintf("duplicate case value %v", value))
+	}
+
+	c := &SwitchCase{value: packed, fields: s.startCase()}
+	s.cases = append(s.cases, c)
+	s.casesByValue[string(packed)] = c
+	return nil
+}
+
+func (s *SwitchType) AddDefault() (err error) {
+	if s.defaultCase != nil {
+		return errors.New("switch already has a default case")
+	}
+
+	s.defaultCase = &SwitchCase{fields: s.startCase()}
+	return nil
+}
+
+// AddBreak ends the current case; the next case will not share its fields.
+func (s *SwitchType) AddBreak() (err error) {
+	if s.current == nil {
+		return errors.New("break must follow a case")
+	}
+
+	s.current = nil
+	return nil
+}
+
+func (s *SwitchType) AddField(field Field) (err error) {
+	if s.current == nil {
+		return errors.New("switch fields must follow a case")
+	}
+
+	if _, ok := field.(*MolecularField); ok {
+		return errors.New("switches cannot contain molecular fields")
+	}
+
+	if field.FieldType().Type() == T_METHOD {
+		return errors.New("switches cannot contain methods")
+	}
+
+	if name := field.Name(); name != "" {
+		if _, ok := s.current.fieldsByName[name]; ok {
+			return errors.New(fmt.Sprintf("field with name `%s` already exists in case", name))
+		}
+		s.current.fieldsByName[name] = field
+	}
+
+	s.current.fields = append(s.current.fields, field)
+	return nil
+}
+
+func (s *SwitchType) startCase() *switchFields {
+	if s.current == nil {
+		s.current = &switchFields{fieldsByName: make(map[string]Field, 0)}
+	}
+
+	return s.current
+}
+
+func (s *SwitchType) packKey(value interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	switch val := value.(type) {
+	case int64:
+		num, ok := s.key.(*NumericType)
+		if !ok {
+			return nil, errors.New("case value must be a string")
+		}
+
+		switch num.Size() {
+		case 1:
+			if val < math.MinInt8 || val > math.MaxUint8 {
+				goto overflow
+			}
+			buf.WriteByte(byte(val))
+		case 2:
+			if val < math.MinInt16 || val > math.MaxUint16 {
+				goto overflow
+			}
+			binary.Write(buf, binary.LittleEndian, uint16(val))
+		case 4:
+			if val < math.MinInt32 || val > math.MaxUint32 {
+				goto overflow
+			}
+			binary.Write(buf, binary.LittleEndian, uint32(val))
+		case 8:
+			binary.Write(buf, binary.LittleEndian, uint64(val))
+		}
+	case string:
+		array, ok := s.key.(*ArrayType)
+		if !ok {
+			return nil, errors.New("case value must be an integer")
+		}
+
+		if array.HasFixedSize() {
+			if uint(len(val)) != array.ArraySize() {
+				return nil, errors.New(fmt.Sprintf("case value must be %d bytes long", array.ArraySize()))
+			}
+		} else {
+			binary.Write(buf, binary.LittleEndian, Sizetag_t(len(val)))
+		}
+		buf.WriteString(val)
+	default:
+		return nil, errors.New("case value must be an integer or string")
+	}
+
+	return buf.Bytes(), nil
+
+overflow:
+	return nil, errors.New(fmt.Sprintf("case value %v does not fit in the switch key", value))
+}
+
+func (c *SwitchCase) IsDefault() bool { return c.value == nil }
+func (c *SwitchCase) Value() []byte   { return c.value }
+
+func (c *SwitchCase) GetNumFields() int    { return len(c.fields.fields) }
+func (c *SwitchCase) GetField(n int) Field { return c.fields.fields[n] }
+
+func (c *SwitchCase) GetFieldByName(name string) (field Field, ok bool) {
+	field, ok = c.fields.fieldsByName[name]
+	return field, ok
+}
+
+func (c *SwitchCase) generateHash(generator *HashGenerator, key BaseType) {
+	// Like Panda3D, the key is counted (and hashed) as the first field of every case.
+	generator.AddInt(len(c.fields.fields) + 1)
+	key.GenerateHash(generator)
+	for _, field := range c.fields.fields {
+		field.GenerateHash(generator)
+	}
+}
+
+func (s *SwitchType) GenerateHash(generator *HashGenerator) {
+	generator.AddString(s.name)
+	s.key.GenerateHash(generator)
+
+	generator.AddInt(len(s.cases))
+	for _, c := range s.cases {
+		generator.AddBlob(c.value)
+		c.generateHash(generator, s.key)
+	}
+
+	if s.defaultCase != nil {
+		s.defaultCase.generateHash(generator, s.key)
+	}
+}
@@ -30,6 +30,7 @@ const (
 
 	T_STRUCT
 	T_METHOD
+	T_SWITCH
 )
 
 func StringToType(s string) Type {
@@ -52,8 +53,7 @@ func StringToType(s string) Type {
 		return T_UINT64
 	case "char":
 		return T_CHAR
-	case "float":
-	case "float32":
+	case "float", "float32":
 		return T_FLOAT32
 	case "float64":
 		return T_FLOAT64
@@ -105,6 +105,20 @@ func (d *DistributedType) DefaultValue() interface{} {
 	return ""
 }
 
+// CopyType returns a copy of a numeric or array type, so that a typedef of a type which was itself
+//  declared by a typedef can be given an alias of its own. Other types are returned as is.
+func CopyType(t BaseType) BaseType {
+	switch t := t.(type) {
+	case *NumericType:
+		c := *t
+		return &c
+	case *ArrayType:
+		c := *t
+		return &c
+	}
+	return t
+}
+
 func (d *DistributedType) GenerateHash(generator *HashGenerator) {
 	generator.AddInt(int(d.dataType))
 	if d.alias != "" {
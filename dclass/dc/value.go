@@ -0,0 +1,553 @@
+package dc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Values are represented by plain Go types, so that they can be inspected, logged and converted
+//  without knowing the DC file in advance:
+//
+//    integers          int64 or uint64, depending on the sign of the type
+//    floats            float64, as are integers with a divisor
+//    char              a string of one character
+//    strings           string
+//    blobs             []byte
+//    arrays            []interface{}, one value per element
+//    structs, methods  []interface{}, one value per field or parameter
+//    molecular fields  []interface{}, one value per component field
+//    switches          []interface{}, the key followed by one value per field of the selected case
+//
+//  Packing is more lenient: any Go integer or float (or json.Number) is accepted for a number, and any
+//  slice for an array or a list of values.
+
+// Pack encodes the value of a field as it appears on the wire.
+func Pack(field Field, value interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := packValue(buf, field.FieldType(), value); err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %s", field.Name(), err))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unpack decodes the value of a field from the start of data, returning it along with the number of
+//  bytes which it was packed into.
+func Unpack(field Field, data []byte) (value interface{}, size int, err error) {
+	u := &unpacker{data: data}
+	if value, err = u.unpackValue(field.FieldType()); err != nil {
+		return nil, 0, errors.New(fmt.Sprintf("%s: %s", field.Name(), err))
+	}
+
+	return value, u.offset, nil
+}
+
+// PackType encodes a value of any DC type.
+func PackType(dtype BaseType, value interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := packValue(buf, dtype, value); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnpackType decodes a value of any DC type from the start of data.
+func UnpackType(dtype BaseType, data []byte) (value interface{}, size int, err error) {
+	u := &unpacker{data: data}
+	if value, err = u.unpackValue(dtype); err != nil {
+		return nil, 0, err
+	}
+
+	return value, u.offset, nil
+}
+
+// isBytes reports whether the elements of an array are plain bytes, which are represented together
+//  as a string or []byte rather than one value per element.
+func (a *ArrayType) isBytes() bool {
+	switch a.dataType {
+	case T_STRING, T_VARSTRING, T_BLOB, T_VARBLOB:
+	default:
+		return false
+	}
+
+	num, ok := a.elemType.(*NumericType)
+	return ok && num.Divisor == 1 && num.Modulus == 0 && !num.HasRange()
+}
+
+func (a *ArrayType) checkLength(length int) error {
+	if a.arraySize > 0 {
+		if uint(length) != a.arraySize {
+			return errors.New(fmt.Sprintf("length %d does not match the array size %d", length, a.arraySize))
+		}
+	} else if uint64(length) < a.arrayRange.Min.Uinteger || uint64(length) > a.arrayRange.Max.Uinteger {
+		return errors.New(fmt.Sprintf("length %d is outside of the range %d-%d",
+			length, a.arrayRange.Min.Uinteger, a.arrayRange.Max.Uinteger))
+	}
+
+	return nil
+}
+
+func packValue(buf *bytes.Buffer, dtype BaseType, value interface{}) error {
+	switch t := dtype.(type) {
+	case *NumericType:
+		return packNumber(buf, t, value)
+	case *ArrayType:
+		return packArray(buf, t, value)
+	case *MolecularField:
+		return packFields(buf, t.fields, value)
+	case *Class:
+		return packFields(buf, t.fields, value)
+	case *Struct:
+		return packFields(buf, t.fields, value)
+	case *Method:
+		values, err := valueList(value, len(t.parameters))
+		if err != nil {
+			return err
+		}
+
+		for n, param := range t.parameters {
+			if err := packValue(buf, param.dataType, values[n]); err != nil {
+				return errors.New(fmt.Sprintf("%s: %s", parameterName(param, n), err))
+			}
+		}
+		return nil
+	case *SwitchType:
+		return packSwitch(buf, t, value)
+	}
+
+	return errors.New(fmt.Sprintf("cannot pack values of type %d", dtype.Type()))
+}
+
+func packNumber(buf *bytes.Buffer, n *NumericType, value interface{}) error {
+	if s, ok := value.(string); ok && n.dataType == T_CHAR {
+		if len(s) != 1 {
+			return errors.New(fmt.Sprintf("char value \"%s\" is not a single character", s))
+		}
+		value = uint64(s[0])
+	}
+
+	num, err := toNumber(value)
+	if err != nil {
+		return err
+	}
+
+	switch n.dataType {
+	case T_FLOAT32, T_FLOAT64:
+		raw := num.Float * float64(n.Divisor)
+		if n.Modulus != 0 {
+			raw = math.Mod(raw, n.calculatedModulus.Float)
+			if raw < 0 {
+				raw += n.calculatedModulus.Float
+			}
+		}
+
+		if n.HasRange() && !n.calculatedRange.Contains(Number{Float: raw}) {
+			return n.rangeError(value)
+		}
+
+		if n.dataType == T_FLOAT32 {
+			binary.Write(buf, binary.LittleEndian, float32(raw))
+		} else {
+			binary.Write(buf, binary.LittleEndian, raw)
+		}
+		return nil
+	}
+
+	// Integers are scaled by their divisor, and must not lose any precision when they are not.
+	if n.Divisor != 1 || num.kind == FLOAT {
+		scaled := math.Floor(num.Float*float64(n.Divisor) + 0.5)
+		if n.Divisor == 1 && scaled != num.Float {
+			return errors.New(fmt.Sprintf("value %v is not an integer", value))
+		}
+
+		if scaled < math.MinInt64 || scaled >= math.MaxUint64 {
+			return n.overflowError(value)
+		}
+
+		if scaled < 0 {
+			num = number{kind: INT, Number: Number{Integer: int64(scaled)}}
+		} else {
+			num = number{kind: UINT, Number: Number{Uinteger: uint64(scaled)}}
+		}
+	}
+
+	if n.Modulus != 0 {
+		modulus := n.calculatedModulus.Uinteger
+		if num.kind == INT {
+			// The remainder of a negative number is negative, so it is brought back into range.
+			rem := uint64(-num.Integer) % modulus
+			num = number{kind: UINT, Number: Number{Uinteger: (modulus - rem) % modulus}}
+		} else {
+			num.Uinteger %= modulus
+		}
+	}
+
+	bits := uint(n.size) * 8
+	switch n.dataType {
+	case T_INT8, T_INT16, T_INT32, T_INT64:
+		if num.kind == UINT {
+			if num.Uinteger > math.MaxInt64 {
+				return n.overflowError(value)
+			}
+			num.Integer = int64(num.Uinteger)
+		}
+
+		if bits < 64 && (num.Integer < -1<<(bits-1) || num.Integer >= 1<<(bits-1)) {
+			return n.overflowError(value)
+		}
+
+		if n.HasRange() && !n.calculatedRange.Contains(num.Number) {
+			return n.rangeError(value)
+		}
+
+		writeInteger(buf, uint64(num.Integer), n.size)
+	default:
+		if num.kind == INT || (bits < 64 && num.Uinteger >= 1<<bits) {
+			return n.overflowError(value)
+		}
+
+		if n.HasRange() && !n.calculatedRange.Contains(num.Number) {
+			return n.rangeError(value)
+		}
+
+		writeInteger(buf, num.Uinteger, n.size)
+	}
+
+	return nil
+}
+
+func (n *NumericType) overflowError(value interface{}) error {
+	return errors.New(fmt.Sprintf("value %v does not fit in a %s", value, numericTypeNames[n.dataType]))
+}
+
+func (n *NumericType) rangeError(value interface{}) error {
+	return errors.New(fmt.Sprintf("value %v is outside of the range %v-%v", value, n.Range.Min.Float, n.Range.Max.Float))
+}
+
+// number is a Number whose kind tells which of its members holds the value. Integers also have
+//  their Float member set, so that the divisor of a type can be applied to them.
+type number struct {
+	Number
+	kind NumberType
+}
+
+func toNumber(value interface{}) (number, error) {
+	// Numbers decoded from JSON are parsed as integers first, so that large ones are exact.
+	if jsonNumber, ok := value.(json.Number); ok {
+		if integer, err := strconv.ParseInt(string(jsonNumber), 10, 64); err == nil {
+			value = integer
+		} else if uinteger, err := strconv.ParseUint(string(jsonNumber), 10, 64); err == nil {
+			value = uinteger
+		} else if float, err := jsonNumber.Float64(); err == nil {
+			value = float
+		} else {
+			return number{}, errors.New(fmt.Sprintf("expected a number, got %s", jsonNumber))
+		}
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			return number{kind: INT, Number: Number{Integer: v.Int(), Float: float64(v.Int())}}, nil
+		}
+		return number{kind: UINT, Number: Number{Uinteger: uint64(v.Int()), Float: float64(v.Int())}}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return number{kind: UINT, Number: Number{Uinteger: v.Uint(), Float: float64(v.Uint())}}, nil
+	case reflect.Float32, reflect.Float64:
+		if math.IsNaN(v.Float()) || math.IsInf(v.Float(), 0) {
+			return number{}, errors.New(fmt.Sprintf("value %v is not a finite number", value))
+		}
+		return number{kind: FLOAT, Number: Number{Float: v.Float()}}, nil
+	}
+
+	return number{}, errors.New(fmt.Sprintf("expected a number, got %T", value))
+}
+
+func writeInteger(buf *bytes.Buffer, value uint64, size Sizetag_t) {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, value)
+	buf.Write(data[:size])
+}
+
+func packArray(buf *bytes.Buffer, a *ArrayType, value interface{}) error {
+	var data []byte
+	if a.isBytes() {
+		switch v := value.(type) {
+		case string:
+			data = []byte(v)
+		case []byte:
+			data = v
+		default:
+			if a.dataType == T_STRING || a.dataType == T_VARSTRING {
+				return errors.New(fmt.Sprintf("expected a string, got %T", value))
+			}
+			return errors.New(fmt.Sprintf("expected a blob, got %T", value))
+		}
+
+		if err := a.checkLength(len(data)); err != nil {
+			return err
+		}
+	} else {
+		values, err := valueList(value, -1)
+		if err != nil {
+			return err
+		}
+
+		if err := a.checkLength(len(values)); err != nil {
+			return err
+		}
+
+		elements := new(bytes.Buffer)
+		for n, v := range values {
+			if err := packValue(elements, a.elemType, v); err != nil {
+				return errors.New(fmt.Sprintf("[%d]: %s", n, err))
+			}
+		}
+		data = elements.Bytes()
+	}
+
+	if !a.HasFixedSize() {
+		binary.Write(buf, binary.LittleEndian, Sizetag_t(len(data)))
+	}
+	buf.Write(data)
+	return nil
+}
+
+func packFields(buf *bytes.Buffer, fields []Field, value interface{}) error {
+	values, err := valueList(value, len(fields))
+	if err != nil {
+		return err
+	}
+
+	for n, field := range fields {
+		if err := packValue(buf, field.FieldType(), values[n]); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", fieldName(field, n), err))
+		}
+	}
+
+	return nil
+}
+
+func packSwitch(buf *bytes.Buffer, s *SwitchType, value interface{}) error {
+	values, err := valueList(value, -1)
+	if err != nil {
+		return err
+	}
+
+	if len(values) == 0 {
+		return errors.New("expected the switch key to be followed by the fields of its case")
+	}
+
+	key := new(bytes.Buffer)
+	if err := packValue(key, s.key, values[0]); err != nil {
+		return errors.New(fmt.Sprintf("key: %s", err))
+	}
+
+	c, ok := s.CaseByValue(key.Bytes())
+	if !ok {
+		return errors.New(fmt.Sprintf("no case of switch %s matches key %v", s.name, values[0]))
+	}
+
+	buf.Write(key.Bytes())
+	return packFields(buf, c.fields.fields, values[1:])
+}
+
+// valueList converts any slice or array into a list of values, checking its length unless it is
+//  negative.
+func valueList(value interface{}, length int) ([]interface{}, error) {
+	values, ok := value.([]interface{})
+	if !ok {
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, errors.New(fmt.Sprintf("expected a list of values, got %T", value))
+		}
+
+		values = make([]interface{}, v.Len())
+		for n := range values {
+			values[n] = v.Index(n).Interface()
+		}
+	}
+
+	if length >= 0 && len(values) != length {
+		return nil, errors.New(fmt.Sprintf("expected %d values, got %d", length, len(values)))
+	}
+
+	return values, nil
+}
+
+func fieldName(field Field, n int) string {
+	if field.Name() != "" {
+		return field.Name()
+	}
+	return fmt.Sprintf("[%d]", n)
+}
+
+func parameterName(param Parameter, n int) string {
+	if param.name != "" {
+		return param.name
+	}
+	return fmt.Sprintf("[%d]", n)
+}
+
+type unpacker struct {
+	data   []byte
+	offset int
+}
+
+func (u *unpacker) read(length int) ([]byte, error) {
+	if length < 0 || u.offset+length > len(u.data) {
+		return nil, errors.New(fmt.Sprintf("unexpected end of data reading %d bytes at offset %d", length, u.offset))
+	}
+
+	data := u.data[u.offset : u.offset+length]
+	u.offset += length
+	return data, nil
+}
+
+func (u *unpacker) unpackValue(dtype BaseType) (interface{}, error) {
+	switch t := dtype.(type) {
+	case *NumericType:
+		return u.unpackNumber(t)
+	case *ArrayType:
+		return u.unpackArray(t)
+	case *MolecularField:
+		return u.unpackFields(t.fields)
+	case *Class:
+		return u.unpackFields(t.fields)
+	case *Struct:
+		return u.unpackFields(t.fields)
+	case *Method:
+		values := make([]interface{}, len(t.parameters))
+		for n, param := range t.parameters {
+			value, err := u.unpackValue(param.dataType)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("%s: %s", parameterName(param, n), err))
+			}
+			values[n] = value
+		}
+		return values, nil
+	case *SwitchType:
+		start := u.offset
+		key, err := u.unpackValue(t.key)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("key: %s", err))
+		}
+
+		c, ok := t.CaseByValue(u.data[start:u.offset])
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("no case of switch %s matches key %v", t.name, key))
+		}
+
+		values, err := u.unpackFields(c.fields.fields)
+		if err != nil {
+			return nil, err
+		}
+		return append([]interface{}{key}, values.([]interface{})...), nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("cannot unpack values of type %d", dtype.Type()))
+}
+
+func (u *unpacker) unpackNumber(n *NumericType) (interface{}, error) {
+	data, err := u.read(int(n.size))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 8)
+	copy(buf, data)
+	bits := binary.LittleEndian.Uint64(buf)
+
+	var raw number
+	switch n.dataType {
+	case T_INT8, T_INT16, T_INT32, T_INT64:
+		shift := 64 - uint(n.size)*8
+		integer := int64(bits<<shift) >> shift
+		raw = number{kind: INT, Number: Number{Integer: integer, Float: float64(integer)}}
+	case T_FLOAT32:
+		raw = number{kind: FLOAT, Number: Number{Float: float64(math.Float32frombits(uint32(bits)))}}
+	case T_FLOAT64:
+		raw = number{kind: FLOAT, Number: Number{Float: math.Float64frombits(bits)}}
+	default:
+		raw = number{kind: UINT, Number: Number{Uinteger: bits, Float: float64(bits)}}
+	}
+
+	if n.HasRange() && !n.calculatedRange.Contains(raw.Number) {
+		return nil, n.rangeError(raw.Float / float64(n.Divisor))
+	}
+
+	switch {
+	case n.Divisor != 1 || raw.kind == FLOAT:
+		return raw.Float / float64(n.Divisor), nil
+	case n.dataType == T_CHAR:
+		return string([]byte{byte(raw.Uinteger)}), nil
+	case raw.kind == INT:
+		return raw.Integer, nil
+	default:
+		return raw.Uinteger, nil
+	}
+}
+
+func (u *unpacker) unpackArray(a *ArrayType) (interface{}, error) {
+	length := int(a.size)
+	if !a.HasFixedSize() {
+		data, err := u.read(4)
+		if err != nil {
+			return nil, err
+		}
+		length = int(binary.LittleEndian.Uint32(data))
+	}
+
+	data, err := u.read(length)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.isBytes() {
+		if err := a.checkLength(len(data)); err != nil {
+			return nil, err
+		}
+
+		if a.dataType == T_STRING || a.dataType == T_VARSTRING {
+			return string(data), nil
+		}
+		return append([]byte{}, data...), nil
+	}
+
+	elements := &unpacker{data: data}
+	values := make([]interface{}, 0)
+	for n := 0; elements.offset < len(data); n++ {
+		value, err := elements.unpackValue(a.elemType)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("[%d]: %s", n, err))
+		}
+		values = append(values, value)
+	}
+
+	if err := a.checkLength(len(values)); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (u *unpacker) unpackFields(fields []Field) (interface{}, error) {
+	values := make([]interface{}, len(fields))
+	for n, field := range fields {
+		value, err := u.unpackValue(field.FieldType())
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: %s", fieldName(field, n), err))
+		}
+		values[n] = value
+	}
+
+	return values, nil
+}
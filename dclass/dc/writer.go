@@ -0,0 +1,413 @@
+package dc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var numericTypeNames = map[Type]string{
+	T_INT8:    "int8",
+	T_INT16:   "int16",
+	T_INT32:   "int32",
+	T_INT64:   "int64",
+	T_UINT8:   "uint8",
+	T_UINT16:  "uint16",
+	T_UINT32:  "uint32",
+	T_UINT64:  "uint64",
+	T_CHAR:    "char",
+	T_FLOAT32: "float32",
+	T_FLOAT64: "float64",
+}
+
+// writer formats the declarations of a file as DC source.
+type writer struct {
+	bytes.Buffer
+	file *File
+}
+
+// Write writes every declaration in the file as canonical DC source. Parsing the output produces a
+//  file with the same hash; comments and the original layout are not preserved.
+func (f *File) Write(w io.Writer) error {
+	return f.WriteFrom(w, 0)
+}
+
+// WriteFrom writes the declarations of the file starting with the nth one. When a set of DC files is
+//  traversed into a single file, this allows each of them to be written out on its own.
+func (f *File) WriteFrom(w io.Writer, n int) error {
+	out := &writer{file: f}
+
+	var prev interface{}
+	for i := n; i < len(f.declarations); i++ {
+		decl := f.declarations[i]
+		if prev != nil && (isBlock(prev) || isBlock(decl) || fmt.Sprintf("%T", prev) != fmt.Sprintf("%T", decl)) {
+			out.WriteString("\n")
+		}
+
+		out.writeDeclaration(i)
+		prev = decl
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// Structs, classes and switches are separated from every other declaration by a blank line.
+func isBlock(decl interface{}) bool {
+	switch decl := decl.(type) {
+	case *Class, *Struct:
+		return true
+	case *typedef:
+		sw, ok := decl.dtype.(*SwitchType)
+		return ok && sw.name == decl.name
+	}
+	return false
+}
+
+func (w *writer) writeDeclaration(n int) {
+	switch decl := w.file.declarations[n].(type) {
+	case string:
+		fmt.Fprintf(w, "keyword %s;\n", decl)
+	case *Import:
+		w.WriteString("from " + decl.module)
+		for _, suffix := range decl.moduleSuffixes {
+			w.WriteString("/" + suffix)
+		}
+
+		w.WriteString(" import " + decl.symbol)
+		for _, suffix := range decl.symbolSuffixes {
+			w.WriteString("/" + suffix)
+		}
+		w.WriteString("\n")
+	case *typedef:
+		w.writeTypedef(n, decl)
+	case *Class:
+		w.WriteString("dclass " + decl.name)
+		for i, parent := range decl.parents {
+			if i == 0 {
+				w.WriteString(" : ")
+			} else {
+				w.WriteString(", ")
+			}
+			w.WriteString(parent.name)
+		}
+
+		w.WriteString(" {\n")
+		for _, field := range decl.baseFields {
+			w.writeField(field, "\t")
+		}
+		w.WriteString("};\n")
+	case *Struct:
+		w.WriteString("struct " + decl.name + " {\n")
+		for _, field := range decl.fields {
+			w.writeField(field, "\t")
+		}
+		w.WriteString("};\n")
+	}
+}
+
+func (w *writer) writeTypedef(n int, decl *typedef) {
+	if sw, ok := decl.dtype.(*SwitchType); ok && sw.name == decl.name {
+		w.writeSwitch(sw, "")
+		w.WriteString(";\n")
+		return
+	}
+
+	// A typedef of another typedef shares its type, so it is written in terms of the first one
+	for _, prev := range w.file.declarations[:n] {
+		if td, ok := prev.(*typedef); ok && td.dtype == decl.dtype {
+			fmt.Fprintf(w, "typedef %s %s;\n", td.name, decl.name)
+			return
+		}
+	}
+
+	base, bounds := w.literalType(decl.dtype, true)
+	fmt.Fprintf(w, "typedef %s %s%s;\n", base, decl.name, bounds)
+}
+
+func (w *writer) writeField(field Field, indent string) {
+	w.WriteString(indent)
+
+	if mol, ok := field.(*MolecularField); ok {
+		var names []string
+		for _, f := range mol.fields {
+			names = append(names, f.Name())
+		}
+
+		fmt.Fprintf(w, "%s : %s;\n", mol.BaseField.name, strings.Join(names, ", "))
+		return
+	}
+
+	atomic := field.(*AtomicField)
+	switch dtype := atomic.fieldType.(type) {
+	case *Method:
+		var params []string
+		for n, param := range dtype.parameters {
+			var def []interface{}
+			if n < len(atomic.defaultValue) {
+				def, _ = atomic.defaultValue[n].([]interface{})
+			}
+			params = append(params, w.parameter(param.dataType, param.name, def))
+		}
+
+		fmt.Fprintf(w, "%s(%s)", atomic.name, strings.Join(params, ", "))
+	case *SwitchType:
+		// Switches declared inside a struct or class are not typedefs, unlike top-level ones
+		if td, ok := w.file.typedefs[dtype.name]; !ok || td != BaseType(dtype) {
+			w.writeSwitch(dtype, indent)
+			w.WriteString(";\n")
+			return
+		}
+		w.WriteString(w.parameter(dtype, atomic.name, atomic.defaultValue))
+	default:
+		w.WriteString(w.parameter(dtype, atomic.name, atomic.defaultValue))
+	}
+
+	for _, kw := range atomic.keywords {
+		w.WriteString(" " + kw)
+	}
+	w.WriteString(";\n")
+}
+
+func (w *writer) writeSwitch(s *SwitchType, indent string) {
+	w.WriteString("switch ")
+	if s.name != "" {
+		w.WriteString(s.name + " ")
+	}
+
+	base, bounds := w.typeName(s.key, false)
+	fmt.Fprintf(w, "(%s%s) {\n", base, bounds)
+
+	// Cases which share their fields fell through into each other, and are written together
+	wroteDefault := false
+	for n := 0; n < len(s.cases); {
+		fields := s.cases[n].fields
+		for ; n < len(s.cases) && s.cases[n].fields == fields; n++ {
+			fmt.Fprintf(w, "%s\tcase %s:\n", indent, caseValue(s, s.cases[n].value))
+		}
+
+		if s.defaultCase != nil && s.defaultCase.fields == fields {
+			fmt.Fprintf(w, "%s\tdefault:\n", indent)
+			wroteDefault = true
+		}
+
+		w.writeCaseFields(fields, indent)
+	}
+
+	if s.defaultCase != nil && !wroteDefault {
+		fmt.Fprintf(w, "%s\tdefault:\n", indent)
+		w.writeCaseFields(s.defaultCase.fields, indent)
+	}
+
+	w.WriteString(indent + "}")
+}
+
+func (w *writer) writeCaseFields(fields *switchFields, indent string) {
+	for _, field := range fields.fields {
+		w.writeField(field, indent+"\t\t")
+	}
+	w.WriteString(indent + "\t\tbreak;\n")
+}
+
+// caseValue returns the DC literal for a switch case, which is given as it appears on the wire.
+func caseValue(s *SwitchType, value []byte) string {
+	if key, ok := s.key.(*NumericType); ok {
+		var val uint64
+		for n := len(value) - 1; n >= 0; n-- {
+			val = val<<8 | uint64(value[n])
+		}
+
+		switch key.dataType {
+		case T_INT8, T_INT16, T_INT32, T_INT64:
+		default:
+			if len(value) < 8 {
+				return strconv.FormatUint(val, 10)
+			}
+		}
+
+		shift := uint(64 - 8*len(value))
+		return strconv.FormatInt(int64(val<<shift)>>shift, 10)
+	}
+
+	if !s.key.HasFixedSize() {
+		value = value[binary.Size(Sizetag_t(0)):]
+	}
+	return strconv.Quote(string(value))
+}
+
+// parameter returns the declaration of a parameter or atomic field, e.g. `uint8(0-100) hp[2] = [5, 5]`.
+func (w *writer) parameter(t BaseType, name string, def []interface{}) string {
+	base, bounds := w.typeName(t, false)
+
+	str := base
+	if name != "" {
+		str += " " + name
+	}
+	str += bounds
+
+	if def != nil {
+		str += " = " + defaultValue(def)
+	}
+	return str
+}
+
+func (w *writer) isTypedef(t BaseType) bool {
+	td, ok := w.file.typedefs[t.Alias()]
+	return ok && td == t
+}
+
+// typeName returns the DC syntax for a type, split into the base type and the array bounds which
+//  follow the name of a parameter. Types which have been declared are referenced by name.
+func (w *writer) typeName(t BaseType, inTypedef bool) (base string, bounds string) {
+	switch t.(type) {
+	case *Class, *Struct, *SwitchType:
+		return w.literalType(t, inTypedef)
+	}
+
+	if w.isTypedef(t) {
+		return t.Alias(), ""
+	}
+
+	return w.literalType(t, inTypedef)
+}
+
+// literalType spells out a type. Strings and blobs parse differently in typedefs than in parameters: a
+//  parameter declared as `string` hashes differently from `char[]`, whereas a typedef does not; each
+//  is written in the form which hashes the same when it is reparsed.
+func (w *writer) literalType(t BaseType, inTypedef bool) (base string, bounds string) {
+	switch t := t.(type) {
+	case *Class:
+		return t.name, ""
+	case *Struct:
+		return t.name, ""
+	case *SwitchType:
+		return t.name, ""
+	case *NumericType:
+		return numericType(t), ""
+	case *ArrayType:
+		if t.legacyType != 0 {
+			return legacyArrayType(t), ""
+		}
+
+		if elem, ok := t.elemType.(*NumericType); ok && elem.Divisor == 1 && elem.Modulus == 0 && !elem.HasRange() {
+			switch {
+			case elem.dataType == T_CHAR && (inTypedef || elem.alias == "string"):
+				return "string" + arrayRange(t, "(", ")"), ""
+			case elem.dataType == T_UINT8 && (inTypedef || elem.alias == "blob"):
+				return "blob" + arrayRange(t, "(", ")"), ""
+			}
+		}
+
+		base, bounds = w.typeName(t.elemType, inTypedef)
+		if t.HasRange() {
+			return base, bounds + arrayRange(t, "[", "]")
+		}
+		return base, bounds + "[]"
+	}
+
+	return t.Alias(), ""
+}
+
+func numericType(n *NumericType) string {
+	str := numericTypeNames[n.dataType]
+	if n.Modulus != 0 {
+		str += "%" + strconv.FormatInt(int64(n.Modulus), 10)
+	}
+	if n.Divisor != 1 {
+		str += "/" + strconv.FormatUint(uint64(n.Divisor), 10)
+	}
+
+	if n.HasRange() {
+		lo, hi := int64(n.Range.Min.Float), int64(n.Range.Max.Float)
+		if lo == hi {
+			str += fmt.Sprintf("(%d)", lo)
+		} else {
+			str += fmt.Sprintf("(%d-%d)", lo, hi)
+		}
+	}
+
+	return str
+}
+
+func legacyArrayType(a *ArrayType) string {
+	var str string
+	for name, code := range legacyArrays {
+		if code == a.legacyType {
+			str = name
+		}
+	}
+
+	if elem, ok := a.elemType.(*NumericType); ok {
+		if elem.Modulus != 0 {
+			str += "%" + strconv.FormatInt(int64(elem.Modulus), 10)
+		}
+		if elem.Divisor != 1 {
+			str += "/" + strconv.FormatUint(uint64(elem.Divisor), 10)
+		}
+	}
+
+	return str + arrayRange(a, "(", ")")
+}
+
+func arrayRange(a *ArrayType, open string, close string) string {
+	if !a.HasRange() {
+		return ""
+	}
+
+	lo, hi := a.arrayRange.Min.Uinteger, a.arrayRange.Max.Uinteger
+	if lo == hi {
+		return fmt.Sprintf("%s%d%s", open, lo, close)
+	}
+	return fmt.Sprintf("%s%d-%d%s", open, lo, hi, close)
+}
+
+// defaultValue formats a default value as produced by the parser: either a single number or string,
+//  or a list of array elements, each of which holds a string or a repeated number.
+func defaultValue(value []interface{}) string {
+	if len(value) == 1 {
+		if _, ok := value[0].([]interface{}); !ok {
+			switch val := value[0].(type) {
+			case float64:
+				str := strconv.FormatFloat(val, 'f', -1, 64)
+				if !strings.Contains(str, ".") {
+					str += ".0"
+				}
+				return str
+			default:
+				return arrayElement(val)
+			}
+		}
+	}
+
+	var elems []string
+	for _, item := range value {
+		repeated, _ := item.([]interface{})
+		switch len(repeated) {
+		case 0:
+		case 1:
+			elems = append(elems, arrayElement(repeated[0]))
+		default:
+			elems = append(elems, fmt.Sprintf("%s * %d", arrayElement(repeated[0]), len(repeated)))
+		}
+	}
+
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+func arrayElement(value interface{}) string {
+	switch val := value.(type) {
+	case string:
+		return strconv.Quote(val)
+	case *string:
+		return strconv.Quote(*val)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return fmt.Sprint(val)
+	}
+}
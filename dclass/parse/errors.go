@@ -0,0 +1,63 @@
+package parse
+
+import (
+	"fmt"
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	"strings"
+)
+
+// Error is a problem found at a specific position while parsing or traversing a DC file.
+type Error struct {
+	Pos     lexer.Position
+	Message string
+}
+
+func (e Error) Error() string {
+	return lexer.FormatError(e.Pos, e.Message)
+}
+
+// ErrorList holds every problem found in a set of DC files, in the order they were found.
+type ErrorList []Error
+
+func (l ErrorList) Error() string {
+	var lines []string
+	for _, err := range l {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (l *ErrorList) add(err error, pos lexer.Position) {
+	switch err := err.(type) {
+	case Error:
+		*l = append(*l, err)
+	case ErrorList:
+		*l = append(*l, err...)
+	case participle.Error:
+		*l = append(*l, Error{Pos: err.Token().Pos, Message: err.Message()})
+	default:
+		*l = append(*l, Error{Pos: pos, Message: err.Error()})
+	}
+}
+
+// collect runs a traversal step, recording the error it fails with instead of letting it propagate;
+//  anything else that panics is attributed to the given position.
+func (l *ErrorList) collect(pos lexer.Position, step func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok {
+				l.add(err, pos)
+			} else {
+				l.add(fmt.Errorf("%v", r), pos)
+			}
+		}
+	}()
+
+	step()
+}
+
+// fail aborts the current traversal step with an error at the given position.
+func fail(pos lexer.Position, format string, args ...interface{}) {
+	panic(Error{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
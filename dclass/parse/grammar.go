@@ -4,12 +4,12 @@ import "github.com/alecthomas/participle/lexer"
 
 type KeywordType struct {
 	Pos  lexer.Position
-	Name string `@Ident`
+	Name string `@Ident { @"-" @Ident }`
 }
 
 type KeywordList struct {
 	Pos      lexer.Position
-	Keywords []string `{ @Ident }`
+	Keywords []*KeywordType `{ @@ }`
 }
 
 type Number struct {
@@ -56,6 +56,7 @@ type DefaultValue struct {
 type CharParameter struct {
 	Pos         lexer.Position
 	Type        string         `@"char"`
+	Constraint  *Range         `[ @@ ]`
 	ArrayPrefix []*ArrayBounds `[ @@ { @@ } ]`
 	Identifier  *string        `[ @Ident ]`
 	ArraySuffix []*ArrayBounds `[ @@ { @@ } ]`
@@ -81,7 +82,7 @@ type IntParameter struct {
 
 type FloatParameter struct {
 	Pos         lexer.Position
-	Type        string          `@"float64"`
+	Type        string          `@( "float32" | "float64" )`
 	Transforms  []*IntTransform `[ @@ { @@ } ]`
 	Constraint  *Range          `[ @@ ]`
 	ArrayPrefix []*ArrayBounds  `[ { @@ } ]`
@@ -100,6 +101,17 @@ type SizedParameter struct {
 	Default     *DefaultValue  `[ '=' @@ ]`
 }
 
+type LegacyArrayParameter struct {
+	Pos         lexer.Position
+	Type        string          `@( "int8array" | "int16array" | "int32array" | "uint8array" | "uint16array" | "uint32array" | "uint32uint8array" | "blob32" )`
+	Transforms  []*IntTransform `[ { @@ } ]`
+	Constraint  *Range          `[ @@ ]`
+	ArrayPrefix []*ArrayBounds  `[ { @@ } ]`
+	Identifier  *string         `[ @Ident ]`
+	ArraySuffix []*ArrayBounds  `[ { @@ } ]`
+	Default     *DefaultValue   `[ '=' @@ ]`
+}
+
 type AmbiguousParameter struct {
 	Pos             lexer.Position
 	Type            string         `@Ident`
@@ -109,12 +121,13 @@ type AmbiguousParameter struct {
 }
 
 type Parameter struct {
-	Pos   lexer.Position
-	Char  *CharParameter      `@@`
-	Int   *IntParameter       `| @@`
-	Float *FloatParameter     `| @@`
-	Sized *SizedParameter     `| @@`
-	Typed *AmbiguousParameter `| @@`
+	Pos    lexer.Position
+	Char   *CharParameter        `@@`
+	Int    *IntParameter         `| @@`
+	Float  *FloatParameter       `| @@`
+	Sized  *SizedParameter       `| @@`
+	Legacy *LegacyArrayParameter `| @@`
+	Typed  *AmbiguousParameter   `| @@`
 }
 
 type MethodField struct {
@@ -136,9 +149,31 @@ type AtomicField struct {
 	Keywords  *KeywordList `[ @@ ]`
 }
 
+type SwitchValue struct {
+	Pos    lexer.Position
+	String *string `@String`
+	Number *Number `| @@`
+}
+
+type SwitchItem struct {
+	Pos     lexer.Position
+	Case    *SwitchValue `( "case" @@ ':'`
+	Default bool         `| ( @"default" ) ':'`
+	Break   bool         `| @"break" ';'`
+	Field   *AtomicField `| @@ ';' )`
+}
+
+type SwitchType struct {
+	Pos   lexer.Position
+	Name  *string       `"switch" [ @Ident ]`
+	Key   *Parameter    `'(' @@ ')'`
+	Items []*SwitchItem `'{' { @@ } '}'`
+}
+
 type FieldDecl struct {
 	Pos       lexer.Position
-	Method    *MethodField    `@@`
+	Switch    *SwitchType     `@@`
+	Method    *MethodField    `| @@`
 	Molecular *MolecularField `| @@`
 	Atomic    *AtomicField    `| @@`
 }
@@ -173,15 +208,16 @@ type Typedef struct {
 type Import struct {
 	Path              []string `"from" @Ident { '.' @Ident }`
 	PathDenominators  []string `[ { '/' @Ident } ]`
-	Class             string   `"import" ( @Ident | '*' )`
+	Class             string   `"import" @( Ident | "*" )`
 	ClassDenominators []string `[ { '/' @Ident } ]`
 }
 
 type TypeDecl struct {
 	Pos     lexer.Position
-	Keyword *KeywordType `"keyword" @@`
+	Keyword *KeywordType `"keyword" @@ [ ';' ]`
 	Import  *Import      `| @@`
 	Typedef *Typedef     `| @@`
+	Switch  *SwitchType  `| @@ [ ';' ]`
 	Struct  *StructType  `| @@`
 	Class   *ClassType   `| @@`
 }
@@ -1,23 +1,31 @@
 package parse
 
 import (
+	"astrongo/dclass/dc"
 	"github.com/alecthomas/participle"
-	"io/ioutil"
+	"github.com/alecthomas/participle/lexer"
+	"os"
 )
 
+func newParser() (*participle.Parser, error) {
+	return participle.Build(&DCFile{}, participle.UseLookahead(16))
+}
+
 func ParseFile(file string) (ok *DCFile, err error) {
-	parser, err := participle.Build(&DCFile{}, participle.UseLookahead(16))
+	parser, err := newParser()
 	if err != nil {
 		return nil, err
 	}
 
-	b, err := ioutil.ReadFile(file)
+	// Parsing from the file itself ensures that every position records the filename
+	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
 	dc := &DCFile{}
-	err = parser.ParseString(string(b), dc)
+	err = parser.Parse(f, dc)
 	if err != nil {
 		return nil, err
 	}
@@ -26,7 +34,7 @@ func ParseFile(file string) (ok *DCFile, err error) {
 }
 
 func ParseString(conf string) (ok *DCFile, err error) {
-	parser, err := participle.Build(&DCFile{}, participle.UseLookahead(16))
+	parser, err := newParser()
 	if err != nil {
 		return nil, err
 	}
@@ -39,3 +47,27 @@ func ParseString(conf string) (ok *DCFile, err error) {
 
 	return dc, nil
 }
+
+// ParseFiles parses each DC file separately and traverses them, in order, into a single dc.File.
+//  Files which fail to parse are skipped so that the remaining ones can still be checked; if any
+//  problems were found, they are all returned as an ErrorList.
+func ParseFiles(files ...string) (*dc.File, error) {
+	var errs ErrorList
+	file := dc.NewFile()
+
+	for _, filename := range files {
+		dctree, err := ParseFile(filename)
+		if err != nil {
+			errs.add(err, lexer.Position{Filename: filename})
+			continue
+		}
+
+		errs = append(errs, dctree.TraverseInto(file)...)
+	}
+
+	if len(errs) != 0 {
+		return nil, errs
+	}
+
+	return file, nil
+}
@@ -3,7 +3,9 @@ package parse
 import (
 	"astrongo/dclass/dc"
 	"fmt"
+	"github.com/alecthomas/participle/lexer"
 	"math"
+	"strings"
 )
 
 func (node Number) consume() int64 {
@@ -32,7 +34,16 @@ func (node IntTransform) apply(n *dc.NumericType) {
 	return
 
 fail:
-	panic(fmt.Sprintf("invalid integer transformation at line %d, column %d", node.Pos.Line, node.Pos.Column))
+	fail(node.Pos, "invalid integer transformation")
+}
+
+// applyElements applies a transformation to the elements of a built-in array, e.g. int16array/100.
+func (node IntTransform) applyElements(array *dc.ArrayType) {
+	if num, ok := array.ElementType().(*dc.NumericType); ok {
+		node.apply(num)
+	} else {
+		fail(node.Pos, "invalid integer transformation")
+	}
 }
 
 func (node ArrayBounds) consume(n dc.BaseType) dc.BaseType {
@@ -64,6 +75,10 @@ func (node ArrayRange) consume() dc.NumericRange {
 		hi = math.Inf(1)
 	}
 
+	if lo > hi {
+		fail(node.Pos, "invalid range %v-%v: the minimum is greater than the maximum", lo, hi)
+	}
+
 	return dc.NumericRange{Type: dc.INT,
 		Min: dc.Number{Integer: int64(lo), Uinteger: uint64(lo), Float: lo},
 		Max: dc.Number{Integer: int64(hi), Uinteger: uint64(hi), Float: hi}}
@@ -100,6 +115,14 @@ func (node Range) consume(dtype dc.Type) dc.NumericRange {
 		hi = math.Inf(1)
 	}
 
+	if lo > hi {
+		fail(node.Pos, "invalid range %v-%v: the minimum is greater than the maximum", lo, hi)
+	}
+
+	if ntype == dc.UINT && lo < 0 && node.Lo != nil {
+		fail(node.Pos, "invalid range %v-%v: unsigned types cannot be negative", lo, hi)
+	}
+
 	return dc.NumericRange{Type: ntype,
 		Min: dc.Number{Integer: int64(lo), Uinteger: uint64(lo), Float: lo},
 		Max: dc.Number{Integer: int64(hi), Uinteger: uint64(hi), Float: hi}}
@@ -177,6 +200,20 @@ func (node TypeCapture) consume(d *dc.File) dc.BaseType {
 		node.Constraint = &Range{}
 	}
 
+	if dc.IsLegacyArray(node.Name) {
+		array, _ := dc.NewLegacyArray(node.Name, node.Constraint.consume(dc.T_UINT32))
+		for _, trans := range node.Transforms {
+			trans.applyElements(array)
+		}
+
+		builtType = array
+		for _, bounds := range node.Bounds {
+			builtType = bounds.consume(builtType)
+		}
+
+		return builtType
+	}
+
 	nodeType := dc.StringToType(node.Name)
 	switch nodeType {
 	case dc.T_INT8, dc.T_INT16, dc.T_INT32, dc.T_INT64, dc.T_UINT8, dc.T_UINT16, dc.T_UINT32,
@@ -198,10 +235,10 @@ func (node TypeCapture) consume(d *dc.File) dc.BaseType {
 		if ntype, ok := d.TypeByName(node.Name); ok {
 			builtType = *ntype
 			if _, ok := builtType.(*dc.Method); ok {
-				panic(fmt.Sprintf("ambiguous type cannot be a method at line %d", node.Pos.Line))
+				fail(node.Pos, "ambiguous type cannot be a method")
 			}
 		} else {
-			panic(fmt.Sprintf("type '%s' has not been declared at line %d", node.Name, node.Pos.Line))
+			fail(node.Pos, "type '%s' has not been declared", node.Name)
 		}
 	}
 
@@ -220,9 +257,11 @@ func (node Typedef) traverse(d *dc.File) {
 		base = bounds.consume(base)
 	}
 
+	// The base may be the type of another typedef, which keeps its own alias
+	base = dc.CopyType(base)
 	base.SetAlias(node.Type.Name)
 	if err := d.AddTypedef(node.Type.Name, base); err != nil {
-		panic(fmt.Sprintf("cannot add typedef '%s' at line %d as a type was already declared with that name", node.Type.Name, node.Pos.Line))
+		fail(node.Pos, "cannot add typedef '%s' as a type was already declared with that name", node.Type.Name)
 	}
 }
 
@@ -241,7 +280,7 @@ func (node IntParameter) consume() dc.BaseType {
 
 	numType.SetRange(node.Constraint.consume(nodeType))
 	if node.ArrayPrefix != nil && node.ArraySuffix != nil {
-		panic(fmt.Sprintf("invalid syntax at line %d", node.Pos.Line))
+		fail(node.Pos, "invalid syntax")
 	}
 
 	builtType = dc.BaseType(numType)
@@ -271,7 +310,7 @@ func (node FloatParameter) consume() dc.BaseType {
 
 	numType.SetRange(node.Constraint.consume(nodeType))
 	if node.ArrayPrefix != nil && node.ArraySuffix != nil {
-		panic(fmt.Sprintf("invalid syntax at line %d", node.Pos.Line))
+		fail(node.Pos, "invalid syntax")
 	}
 
 	builtType = dc.BaseType(numType)
@@ -290,8 +329,12 @@ func (node CharParameter) consume() dc.BaseType {
 	var builtType dc.BaseType
 	charType := dc.NewNumber(dc.T_CHAR)
 
+	if node.Constraint != nil {
+		charType.SetRange(node.Constraint.consume(dc.T_CHAR))
+	}
+
 	if node.ArrayPrefix != nil && node.ArraySuffix != nil {
-		panic(fmt.Sprintf("invalid syntax at line %d", node.Pos.Line))
+		fail(node.Pos, "invalid syntax")
 	}
 
 	builtType = dc.BaseType(charType)
@@ -326,7 +369,7 @@ func (node SizedParameter) consume() dc.BaseType {
 	sizedType := dc.NewArray(elemType, node.Constraint.consume(nodeType))
 
 	if node.ArrayPrefix != nil && node.ArraySuffix != nil {
-		panic(fmt.Sprintf("invalid syntax at line %d", node.Pos.Line))
+		fail(node.Pos, "invalid syntax")
 	}
 
 	builtType = dc.BaseType(sizedType)
@@ -341,17 +384,45 @@ func (node SizedParameter) consume() dc.BaseType {
 	return dc.BaseType(builtType)
 }
 
+func (node LegacyArrayParameter) consume() dc.BaseType {
+	var builtType dc.BaseType
+
+	if node.Constraint == nil {
+		node.Constraint = &Range{}
+	}
+
+	array, _ := dc.NewLegacyArray(node.Type, node.Constraint.consume(dc.T_UINT32))
+	for _, trans := range node.Transforms {
+		trans.applyElements(array)
+	}
+
+	if node.ArrayPrefix != nil && node.ArraySuffix != nil {
+		fail(node.Pos, "invalid syntax")
+	}
+
+	builtType = dc.BaseType(array)
+	for _, bounds := range node.ArraySuffix {
+		builtType = bounds.consume(builtType)
+	}
+
+	for _, bounds := range node.ArrayPrefix {
+		builtType = bounds.consume(builtType)
+	}
+
+	return dc.BaseType(builtType)
+}
+
 func (node AmbiguousParameter) consume(d *dc.File) dc.BaseType {
 	var builtType dc.BaseType
 
 	if ntype, ok := d.TypeByName(node.Type); ok {
 		builtType = *ntype
 	} else {
-		panic(fmt.Sprintf("type '%s' has not been declared at line %d", node.Type, node.Pos.Line))
+		fail(node.Pos, "type '%s' has not been declared", node.Type)
 	}
 
 	if _, ok := builtType.(*dc.Method); ok {
-		panic(fmt.Sprintf("ambiguous type cannot be a method at line %d", node.Pos.Line))
+		fail(node.Pos, "ambiguous type cannot be a method")
 	}
 
 	builtType = dc.BaseType(builtType)
@@ -374,6 +445,8 @@ func (node Parameter) consume(d *dc.File) dc.BaseType {
 		builtType = node.Int.consume()
 	case node.Sized != nil:
 		builtType = node.Sized.consume()
+	case node.Legacy != nil:
+		builtType = node.Legacy.consume()
 	case node.Typed != nil:
 		builtType = node.Typed.consume(d)
 	}
@@ -393,6 +466,8 @@ func (node Parameter) name() string {
 		str = node.Int.Identifier
 	case node.Sized != nil:
 		str = node.Sized.Identifier
+	case node.Legacy != nil:
+		str = node.Legacy.Identifier
 	case node.Typed != nil:
 		str = node.Typed.Identifier
 	}
@@ -404,23 +479,102 @@ func (node Parameter) name() string {
 	}
 }
 
-func (node Parameter) defaultValue(d *dc.File) []interface{} {
-	var defaultValue []interface{}
+func (node Parameter) defaultValue(dtype dc.BaseType) []interface{} {
+	var def *DefaultValue
+	var elemType dc.Type
 
 	switch {
-	case node.Float != nil && node.Float.Default != nil:
-		defaultValue = node.Float.Default.consume(dc.StringToType(node.Float.Type))
-	case node.Char != nil && node.Char.Default != nil:
-		defaultValue = node.Char.Default.consume(dc.StringToType(node.Char.Type))
-	case node.Int != nil && node.Int.Default != nil:
-		defaultValue = node.Int.Default.consume(dc.StringToType(node.Int.Type))
-	case node.Sized != nil && node.Sized.Default != nil:
-		defaultValue = node.Sized.Default.consume(dc.StringToType(node.Sized.Type))
-	case node.Typed != nil && node.Typed.Default != nil:
-		defaultValue = node.Typed.Default.consume(node.Typed.consume(d).Type())
+	case node.Float != nil:
+		def, elemType = node.Float.Default, dc.StringToType(node.Float.Type)
+	case node.Char != nil:
+		def, elemType = node.Char.Default, dc.StringToType(node.Char.Type)
+	case node.Int != nil:
+		def, elemType = node.Int.Default, dc.StringToType(node.Int.Type)
+	case node.Sized != nil:
+		def, elemType = node.Sized.Default, dc.StringToType(node.Sized.Type)
+	case node.Legacy != nil:
+		def = node.Legacy.Default
+		if def != nil {
+			elemType = node.Legacy.consume().(*dc.ArrayType).ElementType().Type()
+		}
+	case node.Typed != nil:
+		def, elemType = node.Typed.Default, dtype.Type()
 	}
 
-	return defaultValue
+	if def == nil {
+		return nil
+	}
+
+	def.check(dtype)
+	return def.consume(elemType)
+}
+
+// check rejects default values which could never be packed into the parameter's type.
+func (node DefaultValue) check(dtype dc.BaseType) {
+	num, numeric := dtype.(*dc.NumericType)
+
+	switch {
+	case node.Array:
+		if _, ok := dtype.(*dc.ArrayType); !ok {
+			fail(node.Pos, "array default value given for a non-array type")
+		}
+	case node.String != nil:
+		if !numeric {
+			break
+		}
+
+		// A char may be given as a string of one character
+		if num.Type() != dc.T_CHAR {
+			fail(node.Pos, "string default value given for a numeric type")
+		}
+		if len(*node.String) != 1 {
+			fail(node.Pos, "char default value \"%s\" is not a single character", *node.String)
+		}
+		checkRange(node.Pos, num, float64((*node.String)[0]))
+	default:
+		if !numeric {
+			fail(node.Pos, "numeric default value given for a non-numeric type")
+		}
+
+		var val float64
+		if node.Integer != nil {
+			val = float64(*node.Integer)
+		} else {
+			val = *node.Float
+			switch num.Type() {
+			case dc.T_FLOAT32, dc.T_FLOAT64:
+			default:
+				if num.Divisor == 1 {
+					fail(node.Pos, "floating-point default value given for an integer type")
+				}
+			}
+		}
+		if node.Negative {
+			val = -val
+		}
+
+		checkRange(node.Pos, num, val)
+	}
+}
+
+func checkRange(pos lexer.Position, num *dc.NumericType, val float64) {
+	if num.HasRange() && (val < num.Range.Min.Float || val > num.Range.Max.Float) {
+		fail(pos, "default value %v is outside of the range %v-%v", val, num.Range.Min.Float, num.Range.Max.Float)
+	}
+}
+
+func (node *KeywordList) apply(d *dc.File, field *dc.AtomicField) {
+	if node == nil {
+		return
+	}
+
+	for _, keyword := range node.Keywords {
+		if !d.HasKeyword(keyword.Name) {
+			fail(keyword.Pos, "keyword '%s' has not been declared", keyword.Name)
+		}
+
+		field.AddKeyword(keyword.Name)
+	}
 }
 
 func (node MethodField) consume(d *dc.File) dc.Field {
@@ -429,29 +583,24 @@ func (node MethodField) consume(d *dc.File) dc.Field {
 	for _, p := range node.Parameters {
 		param := dc.NewParameter(method)
 		if err := param.SetName(p.name()); err != nil {
-			panic(fmt.Sprintf("%s at line %d column %d", err.Error(), p.Pos.Line, p.Pos.Column))
+			fail(p.Pos, "%s", err)
 		}
 
-		if err := param.SetType(p.consume(d)); err != nil {
-			panic(fmt.Sprintf("%s at line %d column %d", err.Error(), p.Pos.Line, p.Pos.Column))
+		dtype := p.consume(d)
+		if err := param.SetType(dtype); err != nil {
+			fail(p.Pos, "%s", err)
 		}
 
 		if err := method.AddParameter(param); err != nil {
-			panic(fmt.Sprintf("%s at line %d", err.Error(), p.Pos.Line))
+			fail(p.Pos, "%s", err)
 		}
 
-		defaultValue = append(defaultValue, p.defaultValue(d))
+		defaultValue = append(defaultValue, p.defaultValue(dtype))
 	}
 
 	field := dc.NewAtomicField(method, node.Name)
 	field.SetDefaultValue(defaultValue)
-
-	if node.Keywords != nil {
-		for _, keyword := range node.Keywords.Keywords {
-			field.(*dc.AtomicField).AddKeyword(keyword)
-		}
-	}
-
+	node.Keywords.apply(d, field.(*dc.AtomicField))
 	return field
 }
 
@@ -460,10 +609,10 @@ func (node MolecularField) consume(cls *dc.Class) dc.Field {
 	for _, child := range node.Fields {
 		if f, ok := cls.GetFieldByName(child); ok {
 			if err := field.AddField(f); err != nil {
-				panic(fmt.Sprintf("%s at line %d", err.Error(), node.Pos.Line))
+				fail(node.Pos, "%s", err)
 			}
 		} else {
-			panic(fmt.Sprintf("unknown molecular field %s at line %d", child, node.Pos.Line))
+			fail(node.Pos, "unknown molecular field %s", child)
 		}
 	}
 
@@ -471,22 +620,69 @@ func (node MolecularField) consume(cls *dc.Class) dc.Field {
 }
 
 func (node AtomicField) consume(d *dc.File) dc.Field {
-	field := dc.NewAtomicField(node.Parameter.consume(d), node.Parameter.name())
-	field.SetDefaultValue(node.Parameter.defaultValue(d))
+	dtype := node.Parameter.consume(d)
+	field := dc.NewAtomicField(dtype, node.Parameter.name())
+	field.SetDefaultValue(node.Parameter.defaultValue(dtype))
+	node.Keywords.apply(d, field.(*dc.AtomicField))
+	return field
+}
+
+func (node SwitchValue) consume() interface{} {
+	if node.String != nil {
+		return *node.String
+	}
+
+	return node.Number.consume()
+}
+
+func (node SwitchType) consume(d *dc.File) *dc.SwitchType {
+	var name string
+	if node.Name != nil {
+		name = *node.Name
+	}
 
-	if node.Keywords != nil {
-		for _, keyword := range node.Keywords.Keywords {
-			field.(*dc.AtomicField).AddKeyword(keyword)
+	sw, err := dc.NewSwitch(name, node.Key.consume(d))
+	if err != nil {
+		fail(node.Key.Pos, "%s", err)
+	}
+
+	for _, item := range node.Items {
+		switch {
+		case item.Case != nil:
+			err = sw.AddCase(item.Case.consume())
+		case item.Default:
+			err = sw.AddDefault()
+		case item.Break:
+			err = sw.AddBreak()
+		case item.Field != nil:
+			err = sw.AddField(item.Field.consume(d))
+		}
+
+		if err != nil {
+			fail(item.Pos, "%s", err)
 		}
 	}
 
-	return field
+	return sw
+}
+
+func (node SwitchType) traverse(d *dc.File) {
+	if node.Name == nil {
+		fail(node.Pos, "top-level switches must be named")
+	}
+
+	if err := d.AddTypedef(*node.Name, node.consume(d)); err != nil {
+		fail(node.Pos, "cannot add switch '%s' as a type was already declared with that name", *node.Name)
+	}
 }
 
 func (node FieldDecl) consume(d *dc.File, cls *dc.Class) dc.Field {
 	var builtType dc.Field
 
 	switch true {
+	case node.Switch != nil:
+		sw := node.Switch.consume(d)
+		builtType = dc.NewAtomicField(sw, sw.Name())
 	case node.Method != nil:
 		builtType = node.Method.consume(d)
 	case node.Molecular != nil:
@@ -498,61 +694,84 @@ func (node FieldDecl) consume(d *dc.File, cls *dc.Class) dc.Field {
 	return builtType
 }
 
-func (node ClassType) traverse(d *dc.File) {
+func (node ClassType) traverse(d *dc.File, errs *ErrorList) {
 	class := dc.NewClass(node.Name, d)
 	for _, parent := range node.Parents {
 		if parentClass, ok := d.ClassByName(parent); ok {
 			class.AddParent(*parentClass)
 		} else {
-			panic(fmt.Sprintf("parent class '%s' has not been declared at line %d", parent, node.Pos.Line))
+			errs.add(Error{node.Pos, fmt.Sprintf("parent class '%s' has not been declared", parent)}, node.Pos)
 		}
 	}
 
 	for _, field := range node.Declarations {
-		if err := class.AddField(field.consume(d, class)); err != nil {
-			panic(fmt.Sprintf("%s at line %d", err.Error(), field.Pos.Line))
-		}
+		errs.collect(field.Pos, func() {
+			if err := class.AddField(field.consume(d, class)); err != nil {
+				fail(field.Pos, "%s", err)
+			}
+		})
 	}
 
 	if err := d.AddClass(class); err != nil {
-		panic(fmt.Sprintf("cannot add class '%s' at line %d as a type was already declared with that name", node.Name, node.Pos.Line))
+		fail(node.Pos, "cannot add class '%s' as a type was already declared with that name", node.Name)
 	}
 }
 
-func (node StructType) traverse(d *dc.File) {
+func (node StructType) traverse(d *dc.File, errs *ErrorList) {
 	strct := dc.NewStruct(node.Name, d)
 	for _, field := range node.Declarations {
-		if err := strct.AddField(field.consume(d, nil)); err != nil {
-			panic(fmt.Sprintf("%s at line %d", err.Error(), field.Pos.Line))
-		}
+		errs.collect(field.Pos, func() {
+			if err := strct.AddField(field.consume(d, nil)); err != nil {
+				fail(field.Pos, "%s", err)
+			}
+		})
 	}
 
 	if err := d.AddStruct(strct); err != nil {
-		panic(fmt.Sprintf("cannot add struct '%s' at line %d as a type was already declared with that name", node.Name, node.Pos.Line))
+		fail(node.Pos, "cannot add struct '%s' as a type was already declared with that name", node.Name)
 	}
 }
 
-func (node TypeDecl) traverse(d *dc.File) {
+func (node TypeDecl) traverse(d *dc.File, errs *ErrorList) {
 	switch {
 	case node.Keyword != nil:
 		d.AddKeyword(node.Keyword.Name)
 	case node.Import != nil:
+		d.AddImport(dc.NewImport(strings.Join(node.Import.Path, "."), node.Import.PathDenominators,
+			node.Import.Class, node.Import.ClassDenominators))
 	case node.Typedef != nil:
 		node.Typedef.traverse(d)
+	case node.Switch != nil:
+		node.Switch.traverse(d)
 	case node.Struct != nil:
-		node.Struct.traverse(d)
+		node.Struct.traverse(d, errs)
 	case node.Class != nil:
-		node.Class.traverse(d)
+		node.Class.traverse(d, errs)
 	default:
-		panic(fmt.Sprintf("malformed declaration at line %d", node.Pos.Line))
+		fail(node.Pos, "malformed declaration")
 	}
 }
 
+// TraverseInto adds every declaration of the parsed DC file to an existing file, which allows a set
+//  of DC files to be parsed separately while sharing their types. Traversal continues past invalid
+//  declarations and fields, and every problem found is returned.
+func (d DCFile) TraverseInto(file *dc.File) ErrorList {
+	var errs ErrorList
+	for _, declaration := range d.Declarations {
+		errs.collect(declaration.Pos, func() {
+			declaration.traverse(file, &errs)
+		})
+	}
+
+	return errs
+}
+
+// Traverse builds a new dc.File from the parsed DC file; it panics with an ErrorList if the file
+//  is invalid. Use ParseFiles to have every problem returned instead.
 func (d DCFile) Traverse() *dc.File {
 	file := dc.NewFile()
-
-	for _, declaration := range d.Declarations {
-		declaration.traverse(file)
+	if errs := d.TraverseInto(file); len(errs) != 0 {
+		panic(errs)
 	}
 
 	return file
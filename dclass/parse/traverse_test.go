@@ -2,6 +2,11 @@ package parse
 
 import (
 	"astrongo/dclass/dc"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -21,3 +26,352 @@ func TestTraverse(t *testing.T) {
 		t.Fatalf("test dclass dc mismatch: 0x%x", hash)
 	}
 }
+
+func TestTraverse_LegacyTypes(t *testing.T) {
+	dct, err := ParseString(`
+typedef uint32uint8array Pairs;
+
+dclass Legacy {
+	setArrays(int8array, int16array/10, int32array, uint8array, uint16array(0-4), uint32array, blob32);
+	setPairs(Pairs pairs);
+	setFloat(float32 f);
+	setChar(char(65-90) c);
+};`)
+	if err != nil {
+		t.Fatalf("legacy dclass parse failed: %s", err)
+	}
+
+	dcf := dct.Traverse()
+	cls, _ := dcf.ClassByName("Legacy")
+
+	field, _ := cls.GetFieldByName("setArrays")
+	method := field.FieldType().(*dc.Method)
+	elements := []dc.Type{dc.T_INT8, dc.T_INT16, dc.T_INT32, dc.T_UINT8, dc.T_UINT16, dc.T_UINT32, dc.T_UINT8}
+	for n, elem := range elements {
+		array, ok := method.GetParameter(n).Type().(*dc.ArrayType)
+		if !ok || array.ElementType().Type() != elem || array.HasFixedSize() {
+			t.Fatalf("parameter %d of setArrays is not a variable-length array of type %d", n, elem)
+		}
+	}
+
+	if divisor := method.GetParameter(1).Type().(*dc.ArrayType).ElementType().(*dc.NumericType).Divisor; divisor != 10 {
+		t.Fatalf("int16array divisor mismatch: %d", divisor)
+	}
+
+	field, _ = cls.GetFieldByName("setPairs")
+	pairs := field.FieldType().(*dc.Method).GetParameter(0).Type().(*dc.ArrayType)
+	if pairs.Type() != dc.T_VARARRAY || pairs.ElementType().Size() != 5 {
+		t.Fatalf("uint32uint8array element mismatch")
+	}
+
+	field, _ = cls.GetFieldByName("setFloat")
+	if tp := field.FieldType().(*dc.Method).GetParameter(0).Type(); tp.Type() != dc.T_FLOAT32 || tp.Size() != 4 {
+		t.Fatalf("float32 type mismatch")
+	}
+}
+
+func TestTraverse_Imports(t *testing.T) {
+	dct, err := ParseString(`
+from game.toon/AI import DistributedToon/AI/OV/UD
+from game.world import *
+
+dclass DistributedToon {
+	setName(string);
+};
+
+dclass DistributedWorld {
+};`)
+	if err != nil {
+		t.Fatalf("import dclass parse failed: %s", err)
+	}
+
+	dcf := dct.Traverse()
+	if len(dcf.Imports()) != 2 {
+		t.Fatalf("import count mismatch: %d", len(dcf.Imports()))
+	}
+	for n, symbol := range []string{"DistributedToon", "*"} {
+		if imp := dcf.Imports()[n]; imp.Symbol() != symbol {
+			t.Fatalf("import symbol mismatch: expected %q, got %q", symbol, imp.Symbol())
+		}
+	}
+
+	// Star imports do not name a symbol, so classes are never resolved through them
+	for _, symbol := range []string{"*", ""} {
+		if _, ok := dcf.ImportBySymbol(symbol); ok {
+			t.Fatalf("star import was indexed under %q", symbol)
+		}
+	}
+	world, _ := dcf.ClassByName("DistributedWorld")
+	if module, ok := world.Module(); ok {
+		t.Fatalf("class resolved through a star import: %s", module)
+	}
+
+	cls, _ := dcf.ClassByName("DistributedToon")
+	if module, _ := cls.Module(); module != "game.toon" {
+		t.Fatalf("class module mismatch: %s", module)
+	}
+
+	views := map[string][2]string{
+		dc.SUFFIX_CLIENT: {"game.toon", "DistributedToon"},
+		dc.SUFFIX_AI:     {"game.toonAI", "DistributedToonAI"},
+		dc.SUFFIX_OV:     {"game.toon", "DistributedToonOV"},
+		dc.SUFFIX_UD:     {"game.toonAI", "DistributedToonUD"},
+	}
+	for suffix, view := range views {
+		module, symbol, ok := cls.Implementation(suffix)
+		if !ok || module != view[0] || symbol != view[1] {
+			t.Fatalf("implementation mismatch for %q: %s.%s", suffix, module, symbol)
+		}
+	}
+}
+
+func TestTraverse_Keywords(t *testing.T) {
+	dct, err := ParseString(`
+keyword ownrecv-always;
+keyword db-readonly;
+
+dclass DistributedToon {
+	setName(string) required broadcast db db-readonly;
+	setHp(int16) ram ownrecv-always;
+};`)
+	if err != nil {
+		t.Fatalf("keyword dclass parse failed: %s", err)
+	}
+
+	dcf := dct.Traverse()
+	if !dcf.HasKeyword("db-readonly") || !dcf.HasKeyword("required") {
+		t.Fatalf("declared keywords are missing")
+	}
+
+	cls, _ := dcf.ClassByName("DistributedToon")
+	field, _ := cls.GetFieldByName("setHp")
+	if !field.HasKeyword("ownrecv-always") || !field.HasKeyword("ram") {
+		t.Fatalf("field keywords are missing")
+	}
+
+	dct, err = ParseString(`
+dclass DistributedToon {
+	setName(string) required db-readonly;
+};`)
+	if err != nil {
+		t.Fatalf("keyword dclass parse failed: %s", err)
+	}
+
+	errs := dct.TraverseInto(dc.NewFile())
+	if len(errs) != 1 || errs.Error() != "3:27: keyword 'db-readonly' has not been declared" {
+		t.Fatalf("undeclared keyword was not rejected: %v", errs)
+	}
+}
+
+func TestTraverse_Errors(t *testing.T) {
+	dct, err := ParseString(`
+struct Bad {
+	uint8(10-5) count;
+	int16 hp = "full";
+};
+
+dclass DistributedToon : Missing {
+	setName(string = 5) required;
+	setHp(int16(0-100) = 150) required;
+	setPos(int16, int16) broadcast;
+	setInitial(char = "a", char(97-122) = "z") broadcast;
+	setGrade(char = "A+") broadcast;
+	setLetter(char(97-122) = "A") broadcast;
+};`)
+	if err != nil {
+		t.Fatalf("dclass parse failed: %s", err)
+	}
+
+	errs := dct.TraverseInto(dc.NewFile())
+	expected := []string{
+		"3:7: invalid range 10-5: the minimum is greater than the maximum",
+		"4:13: string default value given for a numeric type",
+		"7:1: parent class 'Missing' has not been declared",
+		"8:19: numeric default value given for a non-numeric type",
+		"9:23: default value 150 is outside of the range 0-100",
+		"12:18: char default value \"A+\" is not a single character",
+		"13:27: default value 65 is outside of the range 97-122",
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("error count mismatch: %v", errs)
+	}
+	for n, err := range errs {
+		if err.Error() != expected[n] {
+			t.Fatalf("error mismatch: expected %q, got %q", expected[n], err.Error())
+		}
+	}
+}
+
+func TestParseFiles_Errors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dclass")
+	if err != nil {
+		t.Fatalf("temporary directory creation failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "first.dc")
+	second := filepath.Join(dir, "second.dc")
+	files := map[string]string{
+		first: `
+dclass DistributedToon : Missing {
+	setHp(int16(0-100) = 150) required;
+};`,
+		second: `
+dclass DistributedPet {
+	setName(string name) required
+};`,
+	}
+	for file, contents := range files {
+		if err := ioutil.WriteFile(file, []byte(contents), 0644); err != nil {
+			t.Fatalf("%s write failed: %s", file, err)
+		}
+	}
+
+	// Every file is parsed, so that the errors of all of them are reported at once
+	_, err = ParseFiles(first, second)
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected an error list, got %v", err)
+	}
+
+	expected := []string{
+		first + ":2:1: parent class 'Missing' has not been declared",
+		first + ":3:23: default value 150 is outside of the range 0-100",
+		second + ":3:2: unexpected token \"setName\" (expected \"}\")",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("error count mismatch: %v", errs)
+	}
+	for n, err := range errs {
+		if err.Error() != expected[n] {
+			t.Fatalf("error mismatch: expected %q, got %q", expected[n], err.Error())
+		}
+	}
+}
+
+func TestTraverse_Write(t *testing.T) {
+	dct, err := ParseString(`
+keyword ownrecv-always;
+from game.toon/AI import DistributedToon/AI/OV
+from game.world import *
+
+typedef uint8(0-1) bool;
+typedef bool flag;
+typedef string(0-32) Name;
+typedef int16/10 Coords[3];
+
+struct Pair {
+	uint32uint8array items;
+	int16array/100(0-4) offsets;
+	switch (string(2)) {
+		case "ab":
+		case "cd":
+			char(97-122) letter;
+			break;
+		default:
+			break;
+	};
+};
+
+switch Pet (int8) {
+	case -1:
+		break;
+	case 2:
+		Name name = "Rex";
+		float64%360/10 heading = 1.5;
+		break;
+};
+
+dclass DistributedToon {
+	DistributedToon(uint16 id);
+	setName(Name name = "Toon") required broadcast db;
+	setFlags(flag flags[2] = [1, 0 * 1], blob, char[4] code, bool) ram ownrecv-always;
+	setPet(Pet pet) required broadcast db;
+	setPair(Pair pair) broadcast;
+	setMol : setName, setPet;
+};
+
+dclass DistributedPlayer : DistributedToon {
+	setPos(Coords pos, uint64 timestamp = 5) broadcast;
+	int32(-10-10) level db;
+};`)
+	if err != nil {
+		t.Fatalf("dclass parse failed: %s", err)
+	}
+
+	testWrite(t, dct)
+
+	var out bytes.Buffer
+	if err := dct.Traverse().Write(&out); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+	if !strings.Contains(out.String(), "from game.world import *\n") {
+		t.Fatalf("star import was not written:\n%s", out.String())
+	}
+
+	for _, file := range []string{"dclass/parse/test.dc", "util/test.dc"} {
+		dct, err := ParseFile(file)
+		if err != nil {
+			t.Fatalf("%s parse failed: %s", file, err)
+		}
+
+		testWrite(t, dct)
+	}
+}
+
+func TestTraverse_WriteTypedefs(t *testing.T) {
+	dct, err := ParseString(`
+typedef uint8 Byte;
+typedef Byte Octet;
+typedef Octet Bits[8];
+
+dclass DistributedThing {
+	setBytes(Byte b, Byte c[], Octet o, Bits bits) broadcast;
+};`)
+	if err != nil {
+		t.Fatalf("dclass parse failed: %s", err)
+	}
+
+	var out bytes.Buffer
+	if err := dct.Traverse().Write(&out); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+	if !strings.Contains(out.String(), "setBytes(Byte b, Byte c[], Octet o, Bits bits) broadcast;") {
+		t.Fatalf("typedefs were not preserved:\n%s", out.String())
+	}
+
+	testWrite(t, dct)
+}
+
+// testWrite checks that writing out a DC file yields one with the same hash, which is written out
+//  identically.
+func testWrite(t *testing.T, dct *DCFile) {
+	dcf := dct.Traverse()
+	var out bytes.Buffer
+	if err := dcf.Write(&out); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+
+	written, err := ParseString(out.String())
+	if err != nil {
+		t.Fatalf("written dclass parse failed: %s\n%s", err, out.String())
+	}
+
+	rewritten := written.Traverse()
+	if fileHash(rewritten) != fileHash(dcf) {
+		t.Fatalf("hash mismatch: expected %x, got %x\n%s", fileHash(dcf), fileHash(rewritten), out.String())
+	}
+
+	var again bytes.Buffer
+	rewritten.Write(&again)
+	if again.String() != out.String() {
+		t.Fatalf("written dclass is not canonical:\n%s\n%s", out.String(), again.String())
+	}
+}
+
+func fileHash(dcf *dc.File) uint32 {
+	hashgen := dc.NewHashGenerator()
+	dcf.GenerateHash(hashgen)
+	return hashgen.Hash()
+}
@@ -0,0 +1,495 @@
+package dissect
+
+import (
+	"astrongo/clientagent"
+	"astrongo/dclass/dc"
+	. "astrongo/util"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Value is a named part of a dissected payload, such as the DOID of an object or the value of one
+//  of its fields.
+type Value struct {
+	Name  string
+	Value interface{}
+}
+
+// Message is a datagram broken down into its header and payload. The payload of message types
+//  which the dissector does not know is left in Remainder.
+type Message struct {
+	Client     bool
+	Recipients []Channel_t
+	Sender     Channel_t
+	MsgType    uint16
+
+	// Everything in the payload before the fields, e.g. a context, DOID or location
+	Arguments []Value
+
+	// The class of the object whose fields are carried, if the DC file was given. Updates do not carry
+	//  the class of their object; they are given the class which declares their first field instead.
+	Dclass string
+
+	// Field values, decoded as described by dc.Unpack
+	Fields []Value
+
+	// The part of the payload which was not decoded
+	Remainder []byte
+
+	// Why decoding stopped before the end of the datagram, if it did
+	Err error
+}
+
+// The required fields which are sent along with an object depend on who they are sent to.
+type RequiredFields int
+
+const (
+	REQUIRED_ALL RequiredFields = iota
+	REQUIRED_CLIENT
+	REQUIRED_OWNER
+)
+
+// Dissect decodes a server datagram, as routed by the MD. Fields are decoded with the given DC file;
+//  without one, the payload of field-bearing messages is only decoded up to the first field.
+func Dissect(file *dc.File, data []byte) Message {
+	d := newDissector(file, data, false)
+	d.run(func() {
+		count := d.dgi.ReadUint8()
+		for n := 0; n < int(count); n++ {
+			d.msg.Recipients = append(d.msg.Recipients, d.dgi.ReadChannel())
+		}
+
+		if count == 1 && d.msg.Recipients[0] == CONTROL_MESSAGE {
+			d.msg.MsgType = d.dgi.ReadUint16()
+			d.mark()
+			d.control()
+			return
+		}
+
+		d.msg.Sender = d.dgi.ReadChannel()
+		d.msg.MsgType = d.dgi.ReadUint16()
+		d.mark()
+		d.server()
+	})
+	return *d.msg
+}
+
+// DissectClient decodes a datagram sent between a client and a client agent, without the length
+//  prefix which frames it on the wire.
+func DissectClient(file *dc.File, data []byte) Message {
+	d := newDissector(file, data, true)
+	d.run(func() {
+		d.msg.MsgType = d.dgi.ReadUint16()
+		d.mark()
+		d.client()
+	})
+	return *d.msg
+}
+
+// Name returns the name of the message type, e.g. "STATESERVER_OBJECT_SET_FIELD".
+func (m Message) Name() string {
+	if m.Client {
+		return ClientMsgTypeName(m.MsgType)
+	}
+	return MsgTypeName(m.MsgType)
+}
+
+// String lays the message out over several lines, one for each part of it. Field values are
+//  written as JSON.
+func (m Message) String() string {
+	buf := new(bytes.Buffer)
+	m.write(buf, "")
+	return buf.String()
+}
+
+func (m Message) write(buf *bytes.Buffer, indent string) {
+	if !m.Client {
+		recipients := make([]string, len(m.Recipients))
+		for n, channel := range m.Recipients {
+			recipients[n] = fmt.Sprint(channel)
+		}
+		fmt.Fprintf(buf, "%srecipients: %s\n", indent, strings.Join(recipients, ", "))
+		if len(m.Recipients) != 1 || m.Recipients[0] != CONTROL_MESSAGE {
+			fmt.Fprintf(buf, "%ssender:     %d\n", indent, m.Sender)
+		}
+	}
+	fmt.Fprintf(buf, "%smsgtype:    %s (%d)\n", indent, m.Name(), m.MsgType)
+
+	for _, arg := range m.Arguments {
+		if nested, ok := arg.Value.(Message); ok {
+			fmt.Fprintf(buf, "%s%s:\n", indent, arg.Name)
+			nested.write(buf, indent+"  ")
+			continue
+		}
+		fmt.Fprintf(buf, "%s%-11s %v\n", indent, arg.Name+":", arg.Value)
+	}
+
+	if m.Dclass != "" {
+		fmt.Fprintf(buf, "%sdclass:     %s\n", indent, m.Dclass)
+	}
+	for _, field := range m.Fields {
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			value = []byte(fmt.Sprint(field.Value))
+		}
+		fmt.Fprintf(buf, "%s  %s: %s\n", indent, field.Name, value)
+	}
+
+	if len(m.Remainder) != 0 {
+		fmt.Fprintf(buf, "%s%d byte(s) not decoded: % x\n", indent, len(m.Remainder), m.Remainder)
+	}
+	if m.Err != nil {
+		fmt.Fprintf(buf, "%serror:      %s\n", indent, m.Err)
+	}
+}
+
+type dissector struct {
+	file *dc.File
+	data []byte
+	dgi  *DatagramIterator
+	msg  *Message
+
+	// The end of the last part of the datagram which was decoded entirely
+	decoded Dgsize_t
+
+	// Set once the whole payload of the message type is known to have been read
+	complete bool
+}
+
+func newDissector(file *dc.File, data []byte, client bool) *dissector {
+	dg := NewDatagram()
+	dg.Write(data)
+	return &dissector{file: file, data: data, dgi: NewDatagramIterator(&dg), msg: &Message{Client: client}}
+}
+
+// run decodes the datagram, stopping at the first part which cannot be read. Whatever was left is
+//  kept as the remainder of the message.
+func (d *dissector) run(decode func()) {
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				switch err := r.(type) {
+				case DatagramIteratorEOF:
+					d.msg.Err = errors.New("truncated datagram")
+				case error:
+					d.msg.Err = err
+				default:
+					d.msg.Err = errors.New(fmt.Sprint(r))
+				}
+			}
+		}()
+
+		decode()
+	}()
+
+	if int(d.decoded) < len(d.data) {
+		d.msg.Remainder = d.data[d.decoded:]
+		if d.complete && d.msg.Err == nil {
+			d.msg.Err = errors.New(fmt.Sprintf("%d unexpected byte(s) after the payload", len(d.msg.Remainder)))
+		}
+	}
+}
+
+func (d *dissector) mark() {
+	d.decoded = d.dgi.Tell()
+}
+
+func (d *dissector) fail(format string, args ...interface{}) {
+	panic(errors.New(fmt.Sprintf(format, args...)))
+}
+
+func (d *dissector) arg(name string, value interface{}) {
+	d.msg.Arguments = append(d.msg.Arguments, Value{name, value})
+	d.mark()
+}
+
+func (d *dissector) do()       { d.arg("do", d.dgi.ReadDoid()) }
+func (d *dissector) context()  { d.arg("context", d.dgi.ReadUint32()) }
+func (d *dissector) channel()  { d.arg("channel", d.dgi.ReadChannel()) }
+func (d *dissector) location() { d.arg("parent", d.dgi.ReadDoid()); d.arg("zone", d.dgi.ReadZone()) }
+
+// needDC stops decoding before the fields of a message when there is no DC file to decode them with.
+//  This is not an error; the fields are left as the remainder.
+func (d *dissector) needDC() bool {
+	if d.file == nil {
+		d.complete = false
+		return false
+	}
+	return true
+}
+
+func (d *dissector) field(field dc.Field) {
+	d.msg.Fields = append(d.msg.Fields, Value{field.Name(), d.dgi.UnpackValue(field)})
+	d.mark()
+}
+
+// fieldById finds a field of the class being decoded, or of any class if it is not known.
+func (d *dissector) fieldById(cls *dc.Class, id uint16) dc.Field {
+	if cls != nil {
+		if field, ok := cls.GetFieldById(uint(id)); ok {
+			return field
+		}
+		d.fail("class %s has no field %d", cls.Name(), id)
+	}
+
+	field, ok := d.file.Field(int(id))
+	if !ok {
+		d.fail("unknown field %d", id)
+	}
+
+	if d.msg.Dclass == "" {
+		d.msg.Dclass = d.declaringClass(*field)
+	}
+	return *field
+}
+
+// declaringClass names the class which declares a field. Classes are declared after the classes they
+//  inherit from, so this is the first class which has the field.
+func (d *dissector) declaringClass(field dc.Field) string {
+	for n := 0; n < d.file.GetNumDeclarations(); n++ {
+		if cls, ok := d.file.Class(n); ok {
+			if found, ok := cls.GetFieldById(field.Id()); ok && found == field {
+				return cls.Name()
+			}
+		}
+	}
+	return ""
+}
+
+// dclass reads the ID of a class, along with the DOID and location which precede it.
+func (d *dissector) dclass() *dc.Class {
+	d.do()
+	d.location()
+
+	id := d.dgi.ReadUint16()
+	d.arg("dclass_id", id)
+	if d.file == nil {
+		return nil
+	}
+
+	cls, ok := d.file.Class(int(id))
+	if !ok {
+		d.fail("unknown dclass %d", id)
+	}
+	d.msg.Dclass = cls.Name()
+	return cls
+}
+
+// object decodes an object along with its required fields, which are sent in the order they are
+//  declared, followed by its other fields if the message carries them.
+func (d *dissector) object(required RequiredFields, other bool) {
+	d.complete = true
+	cls := d.dclass()
+	if !d.needDC() {
+		return
+	}
+
+	for n := 0; n < cls.GetNumFields(); n++ {
+		field := cls.GetField(n)
+		if _, ok := field.(*dc.MolecularField); ok || !field.HasKeyword("required") {
+			continue
+		}
+
+		visible := field.HasKeyword("broadcast") || field.HasKeyword("clrecv") ||
+			(required == REQUIRED_OWNER && field.HasKeyword("ownrecv"))
+		if required == REQUIRED_ALL || visible {
+			d.field(field)
+		}
+	}
+
+	if other {
+		d.fields(cls, d.dgi.ReadUint16())
+	}
+}
+
+// fields decodes a list of field IDs, each followed by a value.
+func (d *dissector) fields(cls *dc.Class, count uint16) {
+	d.mark()
+	for n := 0; n < int(count); n++ {
+		d.field(d.fieldById(cls, d.dgi.ReadUint16()))
+	}
+}
+
+// setField decodes an update to one or more fields of an object.
+func (d *dissector) setField(multiple bool) {
+	d.complete = true
+	d.do()
+	if !d.needDC() {
+		return
+	}
+
+	if multiple {
+		d.fields(nil, d.dgi.ReadUint16())
+	} else {
+		d.fields(nil, 1)
+	}
+}
+
+func (d *dissector) fieldNames(count uint16) {
+	var names []string
+	for n := 0; n < int(count); n++ {
+		id := d.dgi.ReadUint16()
+		if d.file == nil {
+			names = append(names, fmt.Sprint(id))
+		} else {
+			names = append(names, d.fieldById(nil, id).Name())
+		}
+	}
+	d.arg("fields", strings.Join(names, ", "))
+}
+
+func (d *dissector) control() {
+	d.complete = true
+	switch d.msg.MsgType {
+	case CONTROL_ADD_CHANNEL, CONTROL_REMOVE_CHANNEL, CONTROL_CLEAR_POST_REMOVES:
+		d.channel()
+	case CONTROL_ADD_RANGE, CONTROL_REMOVE_RANGE:
+		d.arg("low", d.dgi.ReadChannel())
+		d.arg("high", d.dgi.ReadChannel())
+	case CONTROL_ADD_POST_REMOVE:
+		d.channel()
+		d.arg("datagram", Dissect(d.file, d.dgi.ReadBlob()))
+	case CONTROL_SET_CON_NAME:
+		d.arg("name", d.dgi.ReadString())
+	case CONTROL_SET_CON_URL:
+		d.arg("url", d.dgi.ReadString())
+	default:
+		d.complete = false
+	}
+}
+
+func (d *dissector) server() {
+	d.complete = true
+	switch d.msg.MsgType {
+	case STATESERVER_CREATE_OBJECT_WITH_REQUIRED:
+		d.object(REQUIRED_ALL, false)
+	case STATESERVER_CREATE_OBJECT_WITH_REQUIRED_OTHER:
+		d.object(REQUIRED_ALL, true)
+	case STATESERVER_OBJECT_ENTER_AI_WITH_REQUIRED:
+		d.object(REQUIRED_ALL, false)
+	case STATESERVER_OBJECT_ENTER_AI_WITH_REQUIRED_OTHER:
+		d.object(REQUIRED_ALL, true)
+	case STATESERVER_OBJECT_ENTER_LOCATION_WITH_REQUIRED:
+		d.object(REQUIRED_CLIENT, false)
+	case STATESERVER_OBJECT_ENTER_LOCATION_WITH_REQUIRED_OTHER:
+		d.object(REQUIRED_CLIENT, true)
+	case STATESERVER_OBJECT_ENTER_INTEREST_WITH_REQUIRED:
+		d.context()
+		d.object(REQUIRED_CLIENT, false)
+	case STATESERVER_OBJECT_ENTER_INTEREST_WITH_REQUIRED_OTHER:
+		d.context()
+		d.object(REQUIRED_CLIENT, true)
+	case STATESERVER_OBJECT_ENTER_OWNER_WITH_REQUIRED:
+		d.object(REQUIRED_OWNER, false)
+	case STATESERVER_OBJECT_ENTER_OWNER_WITH_REQUIRED_OTHER:
+		d.object(REQUIRED_OWNER, true)
+	case STATESERVER_OBJECT_GET_ALL_RESP:
+		d.context()
+		d.object(REQUIRED_ALL, true)
+	case STATESERVER_OBJECT_SET_FIELD, DBSERVER_OBJECT_SET_FIELD:
+		d.setField(false)
+	case STATESERVER_OBJECT_SET_FIELDS, DBSERVER_OBJECT_SET_FIELDS:
+		d.setField(true)
+	case STATESERVER_OBJECT_GET_FIELD:
+		d.context()
+		d.do()
+		d.fieldNames(1)
+	case STATESERVER_OBJECT_GET_FIELDS:
+		d.context()
+		d.do()
+		d.fieldNames(d.dgi.ReadUint16())
+	case STATESERVER_OBJECT_GET_FIELD_RESP, STATESERVER_OBJECT_GET_FIELDS_RESP:
+		d.context()
+		success := d.dgi.ReadBool()
+		d.arg("success", success)
+		if !success || !d.needDC() {
+			return
+		}
+
+		if d.msg.MsgType == STATESERVER_OBJECT_GET_FIELDS_RESP {
+			d.fields(nil, d.dgi.ReadUint16())
+		} else {
+			d.fields(nil, 1)
+		}
+	case STATESERVER_OBJECT_GET_ALL, STATESERVER_OBJECT_GET_AI:
+		d.context()
+		if d.msg.MsgType == STATESERVER_OBJECT_GET_ALL {
+			d.do()
+		}
+	case STATESERVER_OBJECT_GET_LOCATION:
+		d.context()
+	case STATESERVER_OBJECT_GET_LOCATION_RESP:
+		d.context()
+		d.do()
+		d.location()
+	case STATESERVER_OBJECT_GET_AI_RESP:
+		d.context()
+		d.do()
+		d.channel()
+	case STATESERVER_OBJECT_SET_LOCATION, STATESERVER_OBJECT_LOCATION_ACK:
+		d.location()
+	case STATESERVER_OBJECT_CHANGING_LOCATION:
+		d.do()
+		d.arg("new_parent", d.dgi.ReadDoid())
+		d.arg("new_zone", d.dgi.ReadZone())
+		d.arg("old_parent", d.dgi.ReadDoid())
+		d.arg("old_zone", d.dgi.ReadZone())
+	case STATESERVER_OBJECT_SET_AI, STATESERVER_OBJECT_SET_OWNER, STATESERVER_DELETE_AI_OBJECTS:
+		d.channel()
+	case STATESERVER_OBJECT_DELETE_RAM, STATESERVER_OBJECT_DELETE_CHILDREN:
+		d.do()
+	default:
+		d.complete = false
+	}
+}
+
+func (d *dissector) client() {
+	d.complete = true
+	switch d.msg.MsgType {
+	case clientagent.CLIENT_HELLO:
+		d.arg("dc_hash", fmt.Sprintf("0x%08x", d.dgi.ReadUint32()))
+		d.arg("version", d.dgi.ReadString())
+	case clientagent.CLIENT_HELLO_RESP, clientagent.CLIENT_DISCONNECT, clientagent.CLIENT_HEARTBEAT:
+	case clientagent.CLIENT_EJECT:
+		d.arg("reason_code", d.dgi.ReadUint16())
+		d.arg("reason", d.dgi.ReadString())
+	case clientagent.CLIENT_OBJECT_SET_FIELD:
+		d.setField(false)
+	case clientagent.CLIENT_OBJECT_SET_FIELDS:
+		d.setField(true)
+	case clientagent.CLIENT_OBJECT_LEAVING, clientagent.CLIENT_OBJECT_LEAVING_OWNER:
+		d.do()
+	case clientagent.CLIENT_OBJECT_LOCATION:
+		d.do()
+		d.location()
+	case clientagent.CLIENT_ENTER_OBJECT_REQUIRED:
+		d.object(REQUIRED_CLIENT, false)
+	case clientagent.CLIENT_ENTER_OBJECT_REQUIRED_OTHER:
+		d.object(REQUIRED_CLIENT, true)
+	case clientagent.CLIENT_ENTER_OBJECT_REQUIRED_OWNER:
+		d.object(REQUIRED_OWNER, false)
+	case clientagent.CLIENT_ENTER_OBJECT_REQUIRED_OTHER_OWNER:
+		d.object(REQUIRED_OWNER, true)
+	case clientagent.CLIENT_ADD_INTEREST:
+		d.context()
+		d.arg("interest", d.dgi.ReadUint16())
+		d.location()
+	case clientagent.CLIENT_ADD_INTEREST_MULTIPLE:
+		d.context()
+		d.arg("interest", d.dgi.ReadUint16())
+		d.arg("parent", d.dgi.ReadDoid())
+		zones := make([]Zone_t, d.dgi.ReadUint16())
+		for n := range zones {
+			zones[n] = d.dgi.ReadZone()
+		}
+		d.arg("zones", zones)
+	case clientagent.CLIENT_REMOVE_INTEREST, clientagent.CLIENT_DONE_INTEREST_RESP:
+		d.context()
+		d.arg("interest", d.dgi.ReadUint16())
+	default:
+		d.complete = false
+	}
+}
@@ -0,0 +1,166 @@
+package dissect
+
+import (
+	"astrongo/clientagent"
+	"astrongo/dclass/dc"
+	"astrongo/dclass/parse"
+	. "astrongo/util"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func loadDC(t *testing.T) *dc.File {
+	file, err := parse.ParseFiles("dclass/parse/test.dc")
+	if err != nil {
+		t.Fatalf("test dclass parse failed: %s", err)
+	}
+	return file
+}
+
+func addField(t *testing.T, dg *Datagram, cls *dc.Class, name string, value interface{}) {
+	field, ok := cls.GetFieldByName(name)
+	require.True(t, ok, name)
+	dg.AddUint16(uint16(field.Id()))
+	require.NoError(t, dg.AddValue(field, value))
+}
+
+func TestDissect_SetField(t *testing.T) {
+	file := loadDC(t)
+	cls, _ := file.ClassByName("DistributedTestObject3")
+	field, _ := cls.GetFieldByName("setRequired1")
+
+	dg := NewDatagram()
+	dg.AddMultipleServerHeader([]Channel_t{1000, LocationAsChannel(1000, 5)}, 42, STATESERVER_OBJECT_SET_FIELD)
+	dg.AddDoid(1000)
+	addField(t, &dg, cls, "setRequired1", []interface{}{uint32(78)})
+
+	msg := Dissect(file, dg.Bytes())
+	require.NoError(t, msg.Err)
+	require.Equal(t, []Channel_t{1000, LocationAsChannel(1000, 5)}, msg.Recipients)
+	require.EqualValues(t, 42, msg.Sender)
+	require.Equal(t, "STATESERVER_OBJECT_SET_FIELD", msg.Name())
+	require.Equal(t, []Value{{"do", Doid_t(1000)}}, msg.Arguments)
+	// Inherited fields are named after the class which declares them
+	require.Equal(t, "DistributedTestObject1", msg.Dclass)
+	require.Equal(t, []Value{{field.Name(), []interface{}{uint64(78)}}}, msg.Fields)
+	require.Empty(t, msg.Remainder)
+	require.Contains(t, msg.String(), "  setRequired1: [78]\n")
+
+	// Without the DC file, decoding stops at the fields
+	msg = Dissect(nil, dg.Bytes())
+	require.NoError(t, msg.Err)
+	require.Equal(t, "", msg.Dclass)
+	require.Len(t, msg.Remainder, 2+4)
+
+	// An update cut short is reported, and the value is left undecoded
+	msg = Dissect(file, dg.Bytes()[:dg.Len()-1])
+	require.Error(t, msg.Err)
+	require.Empty(t, msg.Fields)
+	require.Len(t, msg.Remainder, 2+3)
+}
+
+func TestDissect_EnterObject(t *testing.T) {
+	file := loadDC(t)
+	cls, _ := file.ClassByName("DistributedClientTestObject")
+	name, _ := cls.GetFieldByName("setName")
+	color, _ := cls.GetFieldByName("setColor")
+
+	// The AI is sent every required field, in the order they are declared
+	dg := NewDatagram()
+	dg.AddServerHeader(5000, 1000, STATESERVER_OBJECT_ENTER_AI_WITH_REQUIRED)
+	dg.AddDoid(1000)
+	dg.AddLocation(100, 5)
+	dg.AddUint16(uint16(cls.ClassId()))
+	require.NoError(t, dg.AddValue(name, []interface{}{"Alice"}))
+	require.NoError(t, dg.AddValue(color, []interface{}{1, 2, 3}))
+
+	msg := Dissect(file, dg.Bytes())
+	require.NoError(t, msg.Err)
+	require.Equal(t, "DistributedClientTestObject", msg.Dclass)
+	require.Equal(t, []Value{{"do", Doid_t(1000)}, {"parent", Doid_t(100)}, {"zone", Zone_t(5)},
+		{"dclass_id", uint16(cls.ClassId())}}, msg.Arguments)
+	require.Equal(t, []Value{{"setName", []interface{}{"Alice"}}, {"setColor", []interface{}{uint64(1), uint64(2), uint64(3)}}},
+		msg.Fields)
+
+	// Clients only see broadcast and clrecv fields, followed here by the other fields
+	chunk, _ := file.ClassByName("DistributedChunk")
+	dg = NewDatagram()
+	dg.AddUint16(clientagent.CLIENT_ENTER_OBJECT_REQUIRED_OTHER)
+	dg.AddDoid(2000)
+	dg.AddLocation(100, 5)
+	dg.AddUint16(uint16(chunk.ClassId()))
+	blocks, _ := chunk.GetFieldByName("blockList")
+	require.NoError(t, dg.AddValue(blocks, []interface{}{[]interface{}{[]interface{}{1, 2, 3}}}))
+	dg.AddUint16(1)
+	addField(t, &dg, chunk, "lastBlock", []interface{}{[]interface{}{4, 5, 6}})
+
+	msg = DissectClient(file, dg.Bytes())
+	require.NoError(t, msg.Err)
+	require.True(t, msg.Client)
+	require.Equal(t, "CLIENT_ENTER_OBJECT_REQUIRED_OTHER", msg.Name())
+	require.Equal(t, "DistributedChunk", msg.Dclass)
+	require.Len(t, msg.Fields, 2)
+	require.Equal(t, "lastBlock", msg.Fields[1].Name)
+	require.Contains(t, msg.String(), "  blockList: [[[1,2,3]]]\n")
+
+	// Bytes left over after a message which was decoded entirely are an error
+	dg.AddUint8(0)
+	msg = DissectClient(file, dg.Bytes())
+	require.Error(t, msg.Err)
+	require.Equal(t, []byte{0}, msg.Remainder)
+}
+
+func TestDissect_Control(t *testing.T) {
+	postRemove := NewDatagram()
+	postRemove.AddServerHeader(1000, 42, STATESERVER_OBJECT_DELETE_RAM)
+	postRemove.AddDoid(1000)
+
+	dg := NewDatagram()
+	dg.AddControlHeader(CONTROL_ADD_POST_REMOVE)
+	dg.AddChannel(42)
+	dg.AddBlob(&postRemove)
+
+	msg := Dissect(nil, dg.Bytes())
+	require.NoError(t, msg.Err)
+	require.Equal(t, "CONTROL_ADD_POST_REMOVE", msg.Name())
+	require.Len(t, msg.Arguments, 2)
+	nested := msg.Arguments[1].Value.(Message)
+	require.Equal(t, "STATESERVER_OBJECT_DELETE_RAM", nested.Name())
+	require.Equal(t, []Value{{"do", Doid_t(1000)}}, nested.Arguments)
+	require.True(t, strings.Contains(msg.String(), "  msgtype:    STATESERVER_OBJECT_DELETE_RAM (2032)\n"))
+
+	// Unknown message types are named by number, and their payload is kept as is
+	dg = NewDatagram()
+	dg.AddServerHeader(1000, 42, 4242)
+	dg.AddUint32(7)
+	msg = Dissect(nil, dg.Bytes())
+	require.NoError(t, msg.Err)
+	require.Equal(t, "<unknown msgtype 4242>", msg.Name())
+	require.Equal(t, []byte{7, 0, 0, 0}, msg.Remainder)
+}
+
+func TestDissect_Client(t *testing.T) {
+	dg := NewDatagram()
+	dg.AddUint16(clientagent.CLIENT_ADD_INTEREST_MULTIPLE)
+	dg.AddUint32(9)
+	dg.AddUint16(1)
+	dg.AddDoid(100)
+	dg.AddUint16(2)
+	dg.AddZone(5)
+	dg.AddZone(6)
+
+	msg := DissectClient(nil, dg.Bytes())
+	require.NoError(t, msg.Err)
+	require.Equal(t, []Value{{"context", uint32(9)}, {"interest", uint16(1)}, {"parent", Doid_t(100)},
+		{"zones", []Zone_t{5, 6}}}, msg.Arguments)
+
+	dg = NewDatagram()
+	dg.AddUint16(clientagent.CLIENT_EJECT)
+	dg.AddUint16(clientagent.CLIENT_DISCONNECT_NO_HEARTBEAT)
+	dg.AddString("Server timed out while waiting for heartbeat.")
+	msg = DissectClient(nil, dg.Bytes())
+	require.NoError(t, msg.Err)
+	require.Equal(t, "CLIENT_EJECT", msg.Name())
+	require.Equal(t, Value{"reason_code", uint16(clientagent.CLIENT_DISCONNECT_NO_HEARTBEAT)}, msg.Arguments[0])
+}
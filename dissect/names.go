@@ -0,0 +1,155 @@
+package dissect
+
+import (
+	"astrongo/clientagent"
+	. "astrongo/util"
+	"fmt"
+)
+
+// The names of server message types, as declared in util/msgtypes.go.
+var msgTypeNames = map[uint16]string{
+	CONTROL_ADD_CHANNEL:                                   "CONTROL_ADD_CHANNEL",
+	CONTROL_REMOVE_CHANNEL:                                "CONTROL_REMOVE_CHANNEL",
+	CONTROL_ADD_RANGE:                                     "CONTROL_ADD_RANGE",
+	CONTROL_REMOVE_RANGE:                                  "CONTROL_REMOVE_RANGE",
+	CONTROL_ADD_POST_REMOVE:                               "CONTROL_ADD_POST_REMOVE",
+	CONTROL_CLEAR_POST_REMOVES:                            "CONTROL_CLEAR_POST_REMOVES",
+	CONTROL_SET_CON_NAME:                                  "CONTROL_SET_CON_NAME",
+	CONTROL_SET_CON_URL:                                   "CONTROL_SET_CON_URL",
+	CONTROL_LOG_MESSAGE:                                   "CONTROL_LOG_MESSAGE",
+	CLIENTAGENT_SET_STATE:                                 "CLIENTAGENT_SET_STATE",
+	CLIENTAGENT_SET_CLIENT_ID:                             "CLIENTAGENT_SET_CLIENT_ID",
+	CLIENTAGENT_SEND_DATAGRAM:                             "CLIENTAGENT_SEND_DATAGRAM",
+	CLIENTAGENT_EJECT:                                     "CLIENTAGENT_EJECT",
+	CLIENTAGENT_DROP:                                      "CLIENTAGENT_DROP",
+	CLIENTAGENT_GET_NETWORK_ADDRESS:                       "CLIENTAGENT_GET_NETWORK_ADDRESS",
+	CLIENTAGENT_GET_NETWORK_ADDRESS_RESP:                  "CLIENTAGENT_GET_NETWORK_ADDRESS_RESP",
+	CLIENTAGENT_DECLARE_OBJECT:                            "CLIENTAGENT_DECLARE_OBJECT",
+	CLIENTAGENT_UNDECLARE_OBJECT:                          "CLIENTAGENT_UNDECLARE_OBJECT",
+	CLIENTAGENT_ADD_SESSION_OBJECT:                        "CLIENTAGENT_ADD_SESSION_OBJECT",
+	CLIENTAGENT_REMOVE_SESSION_OBJECT:                     "CLIENTAGENT_REMOVE_SESSION_OBJECT",
+	CLIENTAGENT_SET_FIELDS_SENDABLE:                       "CLIENTAGENT_SET_FIELDS_SENDABLE",
+	CLIENTAGENT_GET_TLVS:                                  "CLIENTAGENT_GET_TLVS",
+	CLIENTAGENT_GET_TLVS_RESP:                             "CLIENTAGENT_GET_TLVS_RESP",
+	CLIENTAGENT_OPEN_CHANNEL:                              "CLIENTAGENT_OPEN_CHANNEL",
+	CLIENTAGENT_CLOSE_CHANNEL:                             "CLIENTAGENT_CLOSE_CHANNEL",
+	CLIENTAGENT_ADD_POST_REMOVE:                           "CLIENTAGENT_ADD_POST_REMOVE",
+	CLIENTAGENT_CLEAR_POST_REMOVES:                        "CLIENTAGENT_CLEAR_POST_REMOVES",
+	CLIENTAGENT_ADD_INTEREST:                              "CLIENTAGENT_ADD_INTEREST",
+	CLIENTAGENT_ADD_INTEREST_MULTIPLE:                     "CLIENTAGENT_ADD_INTEREST_MULTIPLE",
+	CLIENTAGENT_REMOVE_INTEREST:                           "CLIENTAGENT_REMOVE_INTEREST",
+	CLIENTAGENT_DONE_INTEREST_RESP:                        "CLIENTAGENT_DONE_INTEREST_RESP",
+	STATESERVER_CREATE_OBJECT_WITH_REQUIRED:               "STATESERVER_CREATE_OBJECT_WITH_REQUIRED",
+	STATESERVER_CREATE_OBJECT_WITH_REQUIRED_OTHER:         "STATESERVER_CREATE_OBJECT_WITH_REQUIRED_OTHER",
+	STATESERVER_DELETE_AI_OBJECTS:                         "STATESERVER_DELETE_AI_OBJECTS",
+	STATESERVER_OBJECT_GET_FIELD:                          "STATESERVER_OBJECT_GET_FIELD",
+	STATESERVER_OBJECT_GET_FIELD_RESP:                     "STATESERVER_OBJECT_GET_FIELD_RESP",
+	STATESERVER_OBJECT_GET_FIELDS:                         "STATESERVER_OBJECT_GET_FIELDS",
+	STATESERVER_OBJECT_GET_FIELDS_RESP:                    "STATESERVER_OBJECT_GET_FIELDS_RESP",
+	STATESERVER_OBJECT_GET_ALL:                            "STATESERVER_OBJECT_GET_ALL",
+	STATESERVER_OBJECT_GET_ALL_RESP:                       "STATESERVER_OBJECT_GET_ALL_RESP",
+	STATESERVER_OBJECT_SET_FIELD:                          "STATESERVER_OBJECT_SET_FIELD",
+	STATESERVER_OBJECT_SET_FIELDS:                         "STATESERVER_OBJECT_SET_FIELDS",
+	STATESERVER_OBJECT_DELETE_FIELD_RAM:                   "STATESERVER_OBJECT_DELETE_FIELD_RAM",
+	STATESERVER_OBJECT_DELETE_FIELDS_RAM:                  "STATESERVER_OBJECT_DELETE_FIELDS_RAM",
+	STATESERVER_OBJECT_DELETE_RAM:                         "STATESERVER_OBJECT_DELETE_RAM",
+	STATESERVER_OBJECT_SET_LOCATION:                       "STATESERVER_OBJECT_SET_LOCATION",
+	STATESERVER_OBJECT_CHANGING_LOCATION:                  "STATESERVER_OBJECT_CHANGING_LOCATION",
+	STATESERVER_OBJECT_ENTER_LOCATION_WITH_REQUIRED:       "STATESERVER_OBJECT_ENTER_LOCATION_WITH_REQUIRED",
+	STATESERVER_OBJECT_ENTER_LOCATION_WITH_REQUIRED_OTHER: "STATESERVER_OBJECT_ENTER_LOCATION_WITH_REQUIRED_OTHER",
+	STATESERVER_OBJECT_GET_LOCATION:                       "STATESERVER_OBJECT_GET_LOCATION",
+	STATESERVER_OBJECT_GET_LOCATION_RESP:                  "STATESERVER_OBJECT_GET_LOCATION_RESP",
+	STATESERVER_OBJECT_LOCATION_ACK:                       "STATESERVER_OBJECT_LOCATION_ACK",
+	STATESERVER_OBJECT_SET_AI:                             "STATESERVER_OBJECT_SET_AI",
+	STATESERVER_OBJECT_CHANGING_AI:                        "STATESERVER_OBJECT_CHANGING_AI",
+	STATESERVER_OBJECT_ENTER_AI_WITH_REQUIRED:             "STATESERVER_OBJECT_ENTER_AI_WITH_REQUIRED",
+	STATESERVER_OBJECT_ENTER_AI_WITH_REQUIRED_OTHER:       "STATESERVER_OBJECT_ENTER_AI_WITH_REQUIRED_OTHER",
+	STATESERVER_OBJECT_GET_AI:                             "STATESERVER_OBJECT_GET_AI",
+	STATESERVER_OBJECT_GET_AI_RESP:                        "STATESERVER_OBJECT_GET_AI_RESP",
+	STATESERVER_OBJECT_SET_OWNER:                          "STATESERVER_OBJECT_SET_OWNER",
+	STATESERVER_OBJECT_CHANGING_OWNER:                     "STATESERVER_OBJECT_CHANGING_OWNER",
+	STATESERVER_OBJECT_ENTER_OWNER_WITH_REQUIRED:          "STATESERVER_OBJECT_ENTER_OWNER_WITH_REQUIRED",
+	STATESERVER_OBJECT_ENTER_OWNER_WITH_REQUIRED_OTHER:    "STATESERVER_OBJECT_ENTER_OWNER_WITH_REQUIRED_OTHER",
+	STATESERVER_OBJECT_GET_OWNER:                          "STATESERVER_OBJECT_GET_OWNER",
+	STATESERVER_OBJECT_GET_OWNER_RESP:                     "STATESERVER_OBJECT_GET_OWNER_RESP",
+	STATESERVER_OBJECT_ENTER_INTEREST_WITH_REQUIRED:       "STATESERVER_OBJECT_ENTER_INTEREST_WITH_REQUIRED",
+	STATESERVER_OBJECT_ENTER_INTEREST_WITH_REQUIRED_OTHER: "STATESERVER_OBJECT_ENTER_INTEREST_WITH_REQUIRED_OTHER",
+	STATESERVER_OBJECT_GET_ZONE_OBJECTS:                   "STATESERVER_OBJECT_GET_ZONE_OBJECTS",
+	STATESERVER_OBJECT_GET_ZONES_OBJECTS:                  "STATESERVER_OBJECT_GET_ZONES_OBJECTS",
+	STATESERVER_OBJECT_GET_CHILDREN:                       "STATESERVER_OBJECT_GET_CHILDREN",
+	STATESERVER_OBJECT_GET_ZONE_COUNT:                     "STATESERVER_OBJECT_GET_ZONE_COUNT",
+	STATESERVER_OBJECT_GET_ZONE_COUNT_RESP:                "STATESERVER_OBJECT_GET_ZONE_COUNT_RESP",
+	STATESERVER_OBJECT_GET_ZONES_COUNT:                    "STATESERVER_OBJECT_GET_ZONES_COUNT",
+	STATESERVER_OBJECT_GET_ZONES_COUNT_RESP:               "STATESERVER_OBJECT_GET_ZONES_COUNT_RESP",
+	STATESERVER_OBJECT_GET_CHILD_COUNT:                    "STATESERVER_OBJECT_GET_CHILD_COUNT",
+	STATESERVER_OBJECT_GET_CHILD_COUNT_RESP:               "STATESERVER_OBJECT_GET_CHILD_COUNT_RESP",
+	STATESERVER_OBJECT_DELETE_ZONE:                        "STATESERVER_OBJECT_DELETE_ZONE",
+	STATESERVER_OBJECT_DELETE_ZONES:                       "STATESERVER_OBJECT_DELETE_ZONES",
+	STATESERVER_OBJECT_DELETE_CHILDREN:                    "STATESERVER_OBJECT_DELETE_CHILDREN",
+	STATESERVER_GET_ACTIVE_ZONES:                          "STATESERVER_GET_ACTIVE_ZONES",
+	STATESERVER_GET_ACTIVE_ZONES_RESP:                     "STATESERVER_GET_ACTIVE_ZONES_RESP",
+	DBSS_OBJECT_ACTIVATE_WITH_DEFAULTS:                    "DBSS_OBJECT_ACTIVATE_WITH_DEFAULTS",
+	DBSS_OBJECT_ACTIVATE_WITH_DEFAULTS_OTHER:              "DBSS_OBJECT_ACTIVATE_WITH_DEFAULTS_OTHER",
+	DBSS_OBJECT_GET_ACTIVATED:                             "DBSS_OBJECT_GET_ACTIVATED",
+	DBSS_OBJECT_GET_ACTIVATED_RESP:                        "DBSS_OBJECT_GET_ACTIVATED_RESP",
+	DBSS_OBJECT_DELETE_FIELD_RAM:                          "DBSS_OBJECT_DELETE_FIELD_RAM",
+	DBSS_OBJECT_DELETE_FIELDS_RAM:                         "DBSS_OBJECT_DELETE_FIELDS_RAM",
+	DBSS_OBJECT_DELETE_DISK:                               "DBSS_OBJECT_DELETE_DISK",
+	DBSERVER_CREATE_OBJECT:                                "DBSERVER_CREATE_OBJECT",
+	DBSERVER_CREATE_OBJECT_RESP:                           "DBSERVER_CREATE_OBJECT_RESP",
+	DBSERVER_OBJECT_GET_FIELD:                             "DBSERVER_OBJECT_GET_FIELD",
+	DBSERVER_OBJECT_GET_FIELD_RESP:                        "DBSERVER_OBJECT_GET_FIELD_RESP",
+	DBSERVER_OBJECT_GET_FIELDS:                            "DBSERVER_OBJECT_GET_FIELDS",
+	DBSERVER_OBJECT_GET_FIELDS_RESP:                       "DBSERVER_OBJECT_GET_FIELDS_RESP",
+	DBSERVER_OBJECT_GET_ALL:                               "DBSERVER_OBJECT_GET_ALL",
+	DBSERVER_OBJECT_GET_ALL_RESP:                          "DBSERVER_OBJECT_GET_ALL_RESP",
+	DBSERVER_OBJECT_SET_FIELD:                             "DBSERVER_OBJECT_SET_FIELD",
+	DBSERVER_OBJECT_SET_FIELDS:                            "DBSERVER_OBJECT_SET_FIELDS",
+	DBSERVER_OBJECT_SET_FIELD_IF_EQUALS:                   "DBSERVER_OBJECT_SET_FIELD_IF_EQUALS",
+	DBSERVER_OBJECT_SET_FIELD_IF_EQUALS_RESP:              "DBSERVER_OBJECT_SET_FIELD_IF_EQUALS_RESP",
+	DBSERVER_OBJECT_SET_FIELDS_IF_EQUALS:                  "DBSERVER_OBJECT_SET_FIELDS_IF_EQUALS",
+	DBSERVER_OBJECT_SET_FIELDS_IF_EQUALS_RESP:             "DBSERVER_OBJECT_SET_FIELDS_IF_EQUALS_RESP",
+	DBSERVER_OBJECT_SET_FIELD_IF_EMPTY:                    "DBSERVER_OBJECT_SET_FIELD_IF_EMPTY",
+	DBSERVER_OBJECT_SET_FIELD_IF_EMPTY_RESP:               "DBSERVER_OBJECT_SET_FIELD_IF_EMPTY_RESP",
+	DBSERVER_OBJECT_DELETE_FIELD:                          "DBSERVER_OBJECT_DELETE_FIELD",
+	DBSERVER_OBJECT_DELETE_FIELDS:                         "DBSERVER_OBJECT_DELETE_FIELDS",
+	DBSERVER_OBJECT_DELETE:                                "DBSERVER_OBJECT_DELETE",
+}
+
+// The names of client message types, as declared in clientagent/messages.go.
+var clientMsgTypeNames = map[uint16]string{
+	clientagent.CLIENT_HELLO:                             "CLIENT_HELLO",
+	clientagent.CLIENT_HELLO_RESP:                        "CLIENT_HELLO_RESP",
+	clientagent.CLIENT_DISCONNECT:                        "CLIENT_DISCONNECT",
+	clientagent.CLIENT_EJECT:                             "CLIENT_EJECT",
+	clientagent.CLIENT_HEARTBEAT:                         "CLIENT_HEARTBEAT",
+	clientagent.CLIENT_OBJECT_SET_FIELD:                  "CLIENT_OBJECT_SET_FIELD",
+	clientagent.CLIENT_OBJECT_SET_FIELDS:                 "CLIENT_OBJECT_SET_FIELDS",
+	clientagent.CLIENT_OBJECT_LEAVING:                    "CLIENT_OBJECT_LEAVING",
+	clientagent.CLIENT_OBJECT_LEAVING_OWNER:              "CLIENT_OBJECT_LEAVING_OWNER",
+	clientagent.CLIENT_OBJECT_LOCATION:                   "CLIENT_OBJECT_LOCATION",
+	clientagent.CLIENT_ENTER_OBJECT_REQUIRED:             "CLIENT_ENTER_OBJECT_REQUIRED",
+	clientagent.CLIENT_ENTER_OBJECT_REQUIRED_OTHER:       "CLIENT_ENTER_OBJECT_REQUIRED_OTHER",
+	clientagent.CLIENT_ENTER_OBJECT_REQUIRED_OWNER:       "CLIENT_ENTER_OBJECT_REQUIRED_OWNER",
+	clientagent.CLIENT_ENTER_OBJECT_REQUIRED_OTHER_OWNER: "CLIENT_ENTER_OBJECT_REQUIRED_OTHER_OWNER",
+	clientagent.CLIENT_DONE_INTEREST_RESP:                "CLIENT_DONE_INTEREST_RESP",
+	clientagent.CLIENT_ADD_INTEREST:                      "CLIENT_ADD_INTEREST",
+	clientagent.CLIENT_ADD_INTEREST_MULTIPLE:             "CLIENT_ADD_INTEREST_MULTIPLE",
+	clientagent.CLIENT_REMOVE_INTEREST:                   "CLIENT_REMOVE_INTEREST",
+}
+
+// MsgTypeName names a server message type, e.g. "STATESERVER_OBJECT_SET_FIELD".
+func MsgTypeName(msgType uint16) string {
+	if name, ok := msgTypeNames[msgType]; ok {
+		return name
+	}
+	return fmt.Sprintf("<unknown msgtype %d>", msgType)
+}
+
+// ClientMsgTypeName names a client message type, e.g. "CLIENT_ENTER_OBJECT_REQUIRED".
+func ClientMsgTypeName(msgType uint16) string {
+	if name, ok := clientMsgTypeNames[msgType]; ok {
+		return name
+	}
+	return fmt.Sprintf("<unknown msgtype %d>", msgType)
+}
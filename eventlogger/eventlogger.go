@@ -2,21 +2,40 @@ package eventlogger
 
 import (
 	"astrongo/core"
+	"astrongo/metrics"
+	"astrongo/util"
 	"encoding/json"
+	"fmt"
 	"github.com/apex/log"
 	"github.com/jehiah/go-strftime"
 	"github.com/vmihailenco/msgpack"
 	"net"
 	"os"
-	"os/signal"
-	"syscall"
+	"sync"
 	"time"
 )
 
+const (
+	DEFAULT_BIND   = "0.0.0.0:7197"
+	DEFAULT_OUTPUT = "events-%Y%m%d-%H%M%S.log"
+
+	MAX_PACKET_SIZE = 65535
+)
+
 var EventLoggerLog *log.Entry
 
 var logfile *os.File
+var logPath string
+var logSize int64
+var logOpened time.Time
+var logLock sync.Mutex
 var server *net.UDPConn
+var stopRotation chan bool
+
+var writeErrors = metrics.NewCounter("astron_eventlogger_write_errors_total",
+	"Number of events that could not be written to the event log.", "")
+var malformedPackets = metrics.NewCounter("astron_eventlogger_malformed_packets_total",
+	"Number of packets that could not be decoded as events.", "")
 
 type LoggedEvent struct {
 	keys map[string]interface{}
@@ -33,28 +52,59 @@ func (l LoggedEvent) Add(key string, val string) {
 	l.keys[key] = val
 }
 
+// The typed Add methods keep numbers and booleans as such in the event log, rather than as text.
+func (l LoggedEvent) AddInt(key string, val int64)   { l.keys[key] = val }
+func (l LoggedEvent) AddUint(key string, val uint64) { l.keys[key] = val }
+func (l LoggedEvent) AddBool(key string, val bool)   { l.keys[key] = val }
+
+func (l LoggedEvent) AddChannel(key string, val util.Channel_t) { l.keys[key] = uint64(val) }
+func (l LoggedEvent) AddDoid(key string, val util.Doid_t)       { l.keys[key] = uint32(val) }
+func (l LoggedEvent) AddZone(key string, val util.Zone_t)       { l.keys[key] = uint32(val) }
+
+// AddMap nests a map of values under a key. The values should be strings, numbers, booleans or
+//  nested maps, as anything else is logged however msgpack and JSON happen to encode it.
+func (l LoggedEvent) AddMap(key string, val map[string]interface{}) {
+	l.keys[key] = val
+}
+
+// Send logs the event, or ships it to the remote event logger if events are being forwarded.
 func (l LoggedEvent) Send() {
 	msg, err := msgpack.Marshal(l.keys)
 	if err != nil {
 		EventLoggerLog.Warnf("failed to marshal %s event: %s", l.keys["type"], err)
+		return
+	}
+
+	if forward(msg) {
+		return
 	}
 
 	processPacket(msg, &net.UDPAddr{IP: []byte{0, 0, 0, 0}})
 }
 
+// StartEventLogger starts logging events locally, listening on the bind address of the eventlogger
+//  configuration.
 func StartEventLogger() {
-	if core.Config.Eventlogger.Bind == "" {
-		core.Config.Eventlogger.Bind = "0.0.0.0:7197"
-	}
+	ApplyDefaults(core.Config)
+	start(core.Config.Eventlogger.Bind)
+}
 
-	if core.Config.Eventlogger.Output == "" {
-		core.Config.Eventlogger.Output = "events-%Y%m%d-%H%M%S.log"
+// StartEventLoggerRole starts logging events locally for an eventlogger role, which listens on its
+//  own bind address if it has one. Every other setting is taken from the eventlogger configuration.
+func StartEventLoggerRole(role core.Role) {
+	ApplyDefaults(core.Config)
+	if role.Bind == "" {
+		role.Bind = core.Config.Eventlogger.Bind
 	}
+	start(role.Bind)
+}
 
+func start(bind string) {
 	createLog()
+	OpenSinks()
 
-	EventLoggerLog.Info("Opening UDP socket...")
-	addr, err := net.ResolveUDPAddr("udp", core.Config.Eventlogger.Bind)
+	EventLoggerLog.Infof("Opening UDP socket on %s...", bind)
+	addr, err := net.ResolveUDPAddr("udp", bind)
 	if err != nil {
 		EventLoggerLog.Fatalf("Unable to open socket: %s", err)
 	}
@@ -64,61 +114,171 @@ func StartEventLogger() {
 		EventLoggerLog.Fatalf("Unable to open socket: %s", err)
 	}
 
-	event := NewLoggedEvent("log-opened", "EventLogger")
+	event := NewLoggedEvent(EVENT_LOG_OPENED, "EventLogger")
 	event.Add("msg", "Log opened upon Event Logger startup.")
 	event.Send()
 
-	handleInterrupts()
+	stopRotation = make(chan bool)
 	go listen()
+	go watchRotation(stopRotation)
+}
+
+// ApplyDefaults fills in the event logger settings which were left out of a configuration.
+func ApplyDefaults(conf *core.ServerConfig) {
+	if conf.Eventlogger.Bind == "" {
+		conf.Eventlogger.Bind = DEFAULT_BIND
+	}
+
+	if conf.Eventlogger.Output == "" {
+		conf.Eventlogger.Output = DEFAULT_OUTPUT
+	}
 }
 
 func createLog() {
-	var err error
+	path := strftime.Format(core.Current().Config.Eventlogger.Output, time.Now())
+	file, err := openLog(path)
+	if err != nil {
+		EventLoggerLog.Fatalf("failed to open logfile: %s", err)
+		return
+	}
+
+	logLock.Lock()
 	if logfile != nil {
 		logfile.Close()
 	}
+	setLog(file, path)
+	logLock.Unlock()
+}
 
-	t := time.Now()
-	logfile, err = os.OpenFile(strftime.Format(core.Config.Eventlogger.Output, t), os.O_RDWR|os.O_CREATE, 0600)
+func openLog(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
 	if err != nil {
-		EventLoggerLog.Fatalf("failed to open logfile: %s", err)
-		return
+		return nil, err
 	}
 
-	logfile.Truncate(0)
-	logfile.Seek(0, 0)
+	file.Truncate(0)
+	file.Seek(0, 0)
+	return file, nil
+}
+
+// setLog makes a newly opened file the event log. The caller must hold logLock.
+func setLog(file *os.File, path string) {
+	logfile = file
+	logPath = path
+	logSize = 0
+	logOpened = time.Now()
 }
 
-func handleInterrupts() {
-	c := make(chan os.Signal)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
+// Shutdown stops accepting events, flushes the event log to disk and gives the sinks a moment to
+//  write out the events queued for them. A daemon forwarding its events only stops forwarding them.
+func Shutdown() {
+	if stopForwarding() {
+		return
+	}
+
+	event := NewLoggedEvent(EVENT_LOG_CLOSED, "EventLogger")
+	event.Add("msg", "Log closed upon Event Logger shutdown.")
+	event.Send()
+
+	if server != nil {
 		server.Close()
+	}
+
+	if stopRotation != nil {
+		close(stopRotation)
+		stopRotation = nil
+	}
+
+	logLock.Lock()
+	if logfile != nil {
 		logfile.Sync()
 		logfile.Close()
-	}()
+		logfile = nil
+	}
+	closed := sinks
+	sinks = nil
+	logLock.Unlock()
+
+	closeSinks(closed)
 }
 
+// processPacket logs the events in a packet, which holds either a single event or an array of them.
+//  Packets which cannot be decoded are reported with a warning event naming their sender.
 func processPacket(data []byte, addr *net.UDPAddr) {
-	var out map[string]interface{}
-	err := msgpack.Unmarshal(data, &out)
-	if err != nil {
-		EventLoggerLog.Warnf("failed to unmarshal event from client %s: %s", addr.IP, err)
+	var packet interface{}
+	if err := msgpack.Unmarshal(data, &packet); err != nil {
+		malformedPacket(addr, err.Error())
 		return
 	}
 
+	var events []map[string]interface{}
+	switch packet := packet.(type) {
+	case map[string]interface{}:
+		events = append(events, packet)
+	case []interface{}:
+		for n, elem := range packet {
+			event, ok := elem.(map[string]interface{})
+			if !ok {
+				malformedPacket(addr, fmt.Sprintf("element %d of the batch is not a map of event keys", n))
+				return
+			}
+			events = append(events, event)
+		}
+	default:
+		malformedPacket(addr, "the packet is neither an event nor an array of events")
+		return
+	}
+
+	logLock.Lock()
+	defer logLock.Unlock()
+	for _, event := range events {
+		writeEvent(event)
+	}
+}
+
+func malformedPacket(addr *net.UDPAddr, reason string) {
+	EventLoggerLog.Warnf("discarded malformed packet from client %s: %s", addr, reason)
+	malformedPackets.Inc("")
+
+	logLock.Lock()
+	defer logLock.Unlock()
+	writeEvent(map[string]interface{}{
+		"type":    EVENT_MALFORMED_PACKET,
+		"sender":  "EventLogger",
+		"msg":     fmt.Sprintf("Discarded a malformed packet from %s: %s", addr, reason),
+		"address": addr.String(),
+	})
+}
+
+// writeEvent appends an event to the log and queues it for the sinks, rotating the log once it reaches
+//  the configured size. The caller must hold logLock.
+func writeEvent(out map[string]interface{}) {
 	out["_time"] = strftime.Format("%Y-%m-%d %H:%M:%S%z", time.Now())
 	final, _ := json.Marshal(out)
-	_, err = logfile.WriteString(string(final) + "\n")
+	line := append(final, '\n')
+
+	if logfile == nil {
+		return
+	}
+	dispatch(out, line)
+
+	n, err := logfile.Write(line)
+	logSize += int64(n)
 	if err != nil {
-		EventLoggerLog.Fatalf("failed to write to logfile: %s", err)
+		writeErrors.Inc("")
+		EventLoggerLog.Errorf("failed to write to logfile: %s", err)
+		return
 	}
 	logfile.Sync()
+
+	if size := core.Current().Config.Eventlogger.Rotate.Size; size > 0 && logSize >= int64(size)<<20 {
+		rotateLog("size")
+	}
 }
 
 func listen() {
-	buff := make([]byte, 1024)
+	// Large enough for any UDP datagram, so that events are never truncated
+	buff := make([]byte, MAX_PACKET_SIZE)
 	for {
 		n, addr, err := server.ReadFromUDP(buff)
 		if err != nil {
@@ -2,39 +2,95 @@ package eventlogger
 
 import (
 	"astrongo/core"
+	"astrongo/util"
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
 
-func testLog(t *testing.T, key string, val string) {
+// readEvents returns the events written to the log so far, then empties it.
+func readEvents(t *testing.T) []map[string]interface{} {
+	logLock.Lock()
+	defer logLock.Unlock()
+
 	logfile.Seek(0, 0)
-	buff := make([]byte, 1024)
-	n, _ := logfile.Read(buff)
-	out := make(map[string]interface{})
-	json.Unmarshal(buff[0:n], &out)
-	require.Equal(t, val, out[key])
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(logfile)
+	scanner.Buffer(nil, MAX_PACKET_SIZE*2)
+	for scanner.Scan() {
+		out := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &out))
+		events = append(events, out)
+	}
+	require.NoError(t, scanner.Err())
+
 	logfile.Truncate(0)
 	logfile.Seek(0, 0)
+	return events
 }
 
-func TestStartEventLogger(t *testing.T) {
+func TestMain(m *testing.M) {
+	// Every test shares the event logger, so that each can also be run on its own
+	core.Config = &core.ServerConfig{}
 	StartEventLogger()
+	logfile.Truncate(0)
+	logfile.Seek(0, 0)
+
+	os.Exit(m.Run())
+}
+
+func TestStartEventLogger(t *testing.T) {
 	if server == nil {
 		t.Fatal("could not start server")
 	}
-	logfile.Truncate(0)
-	logfile.Seek(0, 0)
+	require.NotNil(t, logfile)
 }
 
 func TestEventLogger_Process(t *testing.T) {
 	addr := &net.UDPAddr{IP: []byte{0, 0, 0, 0}, Port: 10001, Zone: ""}
 	processPacket([]byte("if the ev reads this, the test fails"), addr)
 	processPacket([]byte("\x82\xa3bar\xa3baz\xa4type\xa3foo"), addr)
-	time.Sleep(time.Millisecond * 100)
-	testLog(t, "bar", "baz")
+
+	events := readEvents(t)
+	require.Len(t, events, 2)
+	require.Equal(t, "malformed-packet", events[0]["type"])
+	require.Equal(t, "0.0.0.0:10001", events[0]["address"])
+	require.Equal(t, "baz", events[1]["bar"])
+}
+
+func TestEventLogger_Batch(t *testing.T) {
+	addr := &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 10001, Zone: ""}
+	batch, err := msgpack.Marshal([]map[string]interface{}{
+		{"type": "foo", "n": 1},
+		{"type": "bar", "n": 2},
+	})
+	require.NoError(t, err)
+	processPacket(batch, addr)
+
+	events := readEvents(t)
+	require.Len(t, events, 2)
+	require.Equal(t, "foo", events[0]["type"])
+	require.Equal(t, "bar", events[1]["type"])
+
+	// A batch is logged entirely or not at all
+	batch, err = msgpack.Marshal([]interface{}{map[string]interface{}{"type": "foo"}, "bar"})
+	require.NoError(t, err)
+	processPacket(batch, addr)
+
+	events = readEvents(t)
+	require.Len(t, events, 1)
+	require.Equal(t, "malformed-packet", events[0]["type"])
+	require.Equal(t, "127.0.0.1:10001", events[0]["address"])
 }
 
 func TestEventLogger_Listen(t *testing.T) {
@@ -45,11 +101,321 @@ func TestEventLogger_Listen(t *testing.T) {
 
 	conn.Write([]byte("if the ev reads this, the test fails"))
 	conn.Write([]byte("\x82\xa3bar\xa3baz\xa4type\xa3foo"))
+
+	// Events larger than a typical MTU arrive whole
+	large, err := msgpack.Marshal(map[string]interface{}{"type": "large", "msg": strings.Repeat("x", 60000)})
+	require.NoError(t, err)
+	_, err = conn.Write(large)
+	require.NoError(t, err)
 	time.Sleep(time.Millisecond * 100)
-	testLog(t, "bar", "baz")
 
+	events := readEvents(t)
+	require.Len(t, events, 3)
+	require.Equal(t, "malformed-packet", events[0]["type"])
+	require.Equal(t, conn.LocalAddr().String(), events[0]["address"])
+	require.Equal(t, "baz", events[1]["bar"])
+	require.Len(t, events[2]["msg"], 60000)
 }
 
-func init() {
-	core.Config = &core.ServerConfig{}
+func firstEvent(t *testing.T, path string) map[string]interface{} {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var reader = bufio.NewReader(file)
+	if filepath.Ext(path) == ".gz" {
+		gz, err := gzip.NewReader(file)
+		require.NoError(t, err)
+		reader = bufio.NewReader(gz)
+	}
+
+	line, err := reader.ReadBytes('\n')
+	require.NoError(t, err)
+
+	out := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(line, &out))
+	return out
+}
+
+func TestEventLogger_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventlogger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	output := core.Config.Eventlogger.Output
+	defer func() {
+		core.Config.Eventlogger.Output = output
+		core.Config.Eventlogger.Rotate.Size = 0
+		core.Config.Eventlogger.Rotate.Compress = false
+		core.Config.Eventlogger.Rotate.Max_Files = 0
+	}()
+
+	// The first rotation moves the log into the temporary directory
+	core.Config.Eventlogger.Output = filepath.Join(dir, "events.log")
+	Rotate("test")
+	require.Equal(t, "log-rotated", firstEvent(t, logPath)["type"])
+	require.Equal(t, "test", firstEvent(t, logPath)["reason"])
+
+	core.Config.Eventlogger.Rotate.Size = 1
+	core.Config.Eventlogger.Rotate.Compress = true
+	core.Config.Eventlogger.Rotate.Max_Files = 2
+
+	logLock.Lock()
+	logSize = 1<<20 - 1
+	logLock.Unlock()
+	processPacket([]byte("\x82\xa3bar\xa3baz\xa4type\xa3foo"), &net.UDPAddr{})
+	require.Equal(t, "size", firstEvent(t, logPath)["reason"])
+
+	Rotate("test")
+	Rotate("test")
+
+	var closed []string
+	for attempt := 0; attempt < 50; attempt++ {
+		time.Sleep(time.Millisecond * 20)
+		closed, _ = filepath.Glob(filepath.Join(dir, "events.log.*"))
+		if len(closed) == 2 && filepath.Ext(closed[0]) == ".gz" && filepath.Ext(closed[1]) == ".gz" {
+			break
+		}
+	}
+
+	require.Len(t, closed, 2)
+	for _, path := range closed {
+		require.Equal(t, ".gz", filepath.Ext(path))
+		require.Equal(t, "log-rotated", firstEvent(t, path)["type"])
+	}
+	require.Equal(t, filepath.Join(dir, "events.log"), logPath)
+}
+
+func TestEventLogger_Sinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventlogger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	path := filepath.Join(dir, "foo.log")
+	core.Config.Eventlogger.Sinks = []core.EventSink{
+		{Type: "file", Path: path, Types: []string{"foo"}},
+		{Type: "tcp", Address: listener.Addr().String()},
+	}
+	defer func() {
+		core.Config.Eventlogger.Sinks = nil
+		OpenSinks()
+	}()
+	OpenSinks()
+
+	addr := &net.UDPAddr{}
+	processPacket([]byte("\x82\xa3bar\xa3baz\xa4type\xa3foo"), addr)
+	processPacket([]byte("\x82\xa3bar\xa3qux\xa4type\xa3bar"), addr)
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	reader := bufio.NewReader(conn)
+	for _, tp := range []string{"foo", "bar"} {
+		line, err := reader.ReadBytes('\n')
+		require.NoError(t, err)
+		out := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal(line, &out))
+		require.Equal(t, tp, out["type"])
+	}
+
+	// Only events of the listed types reach the file
+	for attempt := 0; attempt < 50; attempt++ {
+		if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(data), "\n"))
+	require.Equal(t, "baz", firstEvent(t, path)["bar"])
+	readEvents(t)
+}
+
+func TestEventLogger_SinkOverflow(t *testing.T) {
+	// A sink which does not keep up drops events instead of holding up the event logger
+	s, err := newSink(core.EventSink{Type: "stdout", Buffer: 1})
+	require.NoError(t, err)
+
+	s.push([]byte("{}\n"))
+	s.push([]byte("{}\n"))
+	require.Equal(t, float64(1), droppedEvents.Value("stdout"))
+	require.Len(t, s.queue, 1)
+}
+
+func TestLoggedEvent_Typed(t *testing.T) {
+	event := NewLoggedEvent(EVENT_OBJECT_CREATED, "test")
+	event.AddInt("int", -5)
+	event.AddUint("uint", 1<<63)
+	event.AddBool("bool", true)
+	event.AddChannel("channel", util.Channel_t(1<<40))
+	event.AddDoid("doid", 100000)
+	event.AddMap("map", map[string]interface{}{"zone": 2, "name": "foo"})
+	event.Send()
+
+	logLock.Lock()
+	logfile.Seek(0, 0)
+	line, err := bufio.NewReader(logfile).ReadBytes('\n')
+	logLock.Unlock()
+	require.NoError(t, err)
+
+	// Numbers are logged exactly rather than as strings
+	out := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	require.NoError(t, decoder.Decode(&out))
+	require.Equal(t, json.Number("-5"), out["int"])
+	require.Equal(t, json.Number("9223372036854775808"), out["uint"])
+	require.Equal(t, true, out["bool"])
+	require.Equal(t, json.Number("1099511627776"), out["channel"])
+	require.Equal(t, json.Number("100000"), out["doid"])
+	require.Equal(t, map[string]interface{}{"zone": json.Number("2"), "name": "foo"}, out["map"])
+	readEvents(t)
+
+	tp, ok := LookupEventType(EVENT_FIELD_VIOLATION)
+	require.True(t, ok)
+	require.Contains(t, tp.Keys, "reason")
+	_, ok = LookupEventType("foo")
+	require.False(t, ok)
+}
+
+func TestEventLogger_Forward(t *testing.T) {
+	remote, err := net.ListenUDP("udp", &net.UDPAddr{IP: []byte{127, 0, 0, 1}})
+	require.NoError(t, err)
+	defer remote.Close()
+
+	require.NoError(t, StartForwarding(remote.LocalAddr().String()))
+	event := NewLoggedEvent("foo", "test")
+	event.AddDoid("doid", 100000)
+	event.Send()
+	require.True(t, stopForwarding())
+
+	remote.SetReadDeadline(time.Now().Add(time.Second))
+	buff := make([]byte, MAX_PACKET_SIZE)
+	n, err := remote.Read(buff)
+	require.NoError(t, err)
+
+	out := make(map[string]interface{})
+	require.NoError(t, msgpack.Unmarshal(buff[:n], &out))
+	require.Equal(t, "foo", out["type"])
+	require.EqualValues(t, 100000, out["doid"])
+
+	// Forwarded events are not logged locally
+	require.Empty(t, readEvents(t))
+	require.False(t, stopForwarding())
+}
+
+func TestEventLogger_Filter(t *testing.T) {
+	event, err := DecodeEvent([]byte(`{"_time":"2026-10-19 10:00:00+0000","type":"client-connected",` +
+		`"sender":"Client: 1000001","doid":"100000","remote_address":"10.0.0.5:4242"}` + "\n"))
+	require.NoError(t, err)
+
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	for _, filter := range []Filter{
+		{},
+		{Since: at, Until: at.Add(time.Second)},
+		{Types: []string{"client-lost", "client-connected"}},
+		{Sender: "Client: *"},
+		{Doid: 100000},
+		{Address: "10.0.0.5"},
+		{Address: "10.0.0.5:4242"},
+	} {
+		require.True(t, filter.Match(event), "%+v", filter)
+	}
+
+	for _, filter := range []Filter{
+		{Since: at.Add(time.Second)},
+		{Until: at},
+		{Types: []string{"client-lost"}},
+		{Sender: "StateServer*"},
+		{Doid: 100001},
+		{Address: "10.0.0.6"},
+	} {
+		require.False(t, filter.Match(event), "%+v", filter)
+	}
+}
+
+func TestEventLogger_LogFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventlogger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	line := `{"type":"foo"}` + "\n"
+	closed := filepath.Join(dir, "events-20261018.log.gz")
+	file, err := os.Create(closed)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(file)
+	gz.Write([]byte(line))
+	gz.Close()
+	file.Close()
+	os.Chtimes(closed, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+
+	current := filepath.Join(dir, "events-20261019.log")
+	require.NoError(t, ioutil.WriteFile(current, []byte(line), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.log"), []byte(line), 0600))
+
+	logs, err := LogFiles(dir, "events-%Y%m%d.log")
+	require.NoError(t, err)
+	require.Equal(t, []string{closed, current}, logs)
+
+	// Compressed logs read the same as the others
+	for _, path := range logs {
+		log, err := OpenLog(path)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(log)
+		log.Close()
+		require.NoError(t, err)
+		require.Equal(t, line, string(data))
+	}
+}
+
+func TestEventLogger_OutputPattern(t *testing.T) {
+	require.Equal(t, "events-*-*.log", outputPattern("events-%Y%m%d-%H%M%S.log"))
+	require.Equal(t, "100%-*", outputPattern("100%%-%s"))
+}
+
+func TestEventLogger_OutputMatcher(t *testing.T) {
+	matcher := outputMatcher("events-%Y%m%d.log")
+	for _, name := range []string{"events-20261019.log", "events-20261019.log.1", "events-20261019.log.gz",
+		"events-20261019.log.20261019-120000", "events-20261019.log.20261019-120000.2.gz.1"} {
+		require.True(t, matcher.MatchString(name), name)
+	}
+	for _, name := range []string{"events-notes.log", "events-20261019.log.bak", "other.log", "events-20261019.logs"} {
+		require.False(t, matcher.MatchString(name), name)
+	}
+}
+
+func TestEventLogger_PruneLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventlogger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Listed from newest to oldest
+	names := []string{"events-20261005.log", "events-20261004.log", "events-20261003.log.20261003-120000.gz",
+		"events-20261002.log.gz", "events-20261001.log", "events-notes.log", "events-20261001.log.bak"}
+	for n, name := range names {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte("{}\n"), 0600))
+		modTime := time.Now().Add(-time.Duration(n) * time.Hour)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	// Only logs written with the output format are pruned, and never the file of a sink
+	sink := filepath.Join(dir, "events-20261004.log")
+	pruneLogs(filepath.Join(dir, "events-%Y%m%d.log"), []string{sink}, 2, 0)
+
+	var left []string
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			left = append(left, name)
+		}
+	}
+	require.Equal(t, []string{"events-20261005.log", "events-20261004.log", "events-20261003.log.20261003-120000.gz",
+		"events-notes.log", "events-20261001.log.bak"}, left)
 }
@@ -0,0 +1,65 @@
+package eventlogger
+
+// Types of the events logged by the daemon itself. Roles may log events of other types as well.
+const (
+	EVENT_LOG_OPENED       = "log-opened"
+	EVENT_LOG_CLOSED       = "log-closed"
+	EVENT_LOG_ROTATED      = "log-rotated"
+	EVENT_MALFORMED_PACKET = "malformed-packet"
+
+	EVENT_CLIENT_CONNECTED        = "client-connected"
+	EVENT_CLIENT_DISCONNECTED     = "client-disconnected"
+	EVENT_CLIENT_LOST             = "client-lost"
+	EVENT_CLIENT_EJECTED          = "client-ejected"
+	EVENT_CLIENT_EJECTED_SECURITY = "client-ejected-security"
+
+	EVENT_OBJECT_CREATED  = "object-created"
+	EVENT_OBJECT_DELETED  = "object-deleted"
+	EVENT_FIELD_VIOLATION = "field-violation"
+)
+
+// EventType documents an event type: when it is logged, and the keys it carries besides type, sender
+//  and _time.
+type EventType struct {
+	Name        string
+	Description string
+	Keys        []string
+}
+
+// EventTypes lists the events logged by the daemon itself.
+var EventTypes = []EventType{
+	{EVENT_LOG_OPENED, "The event logger started.", []string{"msg"}},
+	{EVENT_LOG_CLOSED, "The event logger shut down.", []string{"msg"}},
+	{EVENT_LOG_ROTATED, "The event log was closed and continued in a new file.",
+		[]string{"msg", "reason", "previous"}},
+	{EVENT_MALFORMED_PACKET, "A packet sent to the event logger could not be decoded.",
+		[]string{"msg", "address"}},
+
+	{EVENT_CLIENT_CONNECTED, "A client connected to a client agent.",
+		[]string{"channel", "remote_address", "local_address"}},
+	{EVENT_CLIENT_DISCONNECTED, "A client disconnected by sending CLIENT_DISCONNECT.",
+		[]string{"channel", "remote_address"}},
+	{EVENT_CLIENT_LOST, "A client connection closed without a CLIENT_DISCONNECT.",
+		[]string{"channel", "remote_address", "local_address", "reason"}},
+	{EVENT_CLIENT_EJECTED, "A client was disconnected by the server.",
+		[]string{"channel", "reason_code", "reason_msg"}},
+	{EVENT_CLIENT_EJECTED_SECURITY, "A client was disconnected for behaviour which may be malicious.",
+		[]string{"channel", "reason_code", "reason_msg"}},
+
+	{EVENT_OBJECT_CREATED, "A state server created an object.",
+		[]string{"doid", "dclass", "parent", "zone"}},
+	{EVENT_OBJECT_DELETED, "A state server deleted an object.",
+		[]string{"doid", "dclass", "deleted_by"}},
+	{EVENT_FIELD_VIOLATION, "A field value did not match its DC definition. Keys which are unknown where " +
+		"the violation was found are left out.", []string{"doid", "dclass", "field", "from", "channel", "reason"}},
+}
+
+// LookupEventType finds the documentation of an event type logged by the daemon.
+func LookupEventType(name string) (EventType, bool) {
+	for _, tp := range EventTypes {
+		if tp.Name == name {
+			return tp, true
+		}
+	}
+	return EventType{}, false
+}
@@ -0,0 +1,68 @@
+package eventlogger
+
+import (
+	"astrongo/metrics"
+	"net"
+	"sync"
+)
+
+// The connection to the remote event logger which events are forwarded to, if any.
+var forwarder *net.UDPConn
+var forwardLock sync.RWMutex
+
+var forwardErrors = metrics.NewCounter("astron_eventlogger_forward_errors_total",
+	"Number of events which could not be sent to the remote event logger.", "")
+
+// StartForwarding sends the events of this daemon to the event logger at the given address, for
+//  daemons which do not run an event logger of their own.
+func StartForwarding(addr string) error {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return err
+	}
+
+	EventLoggerLog.Infof("Forwarding events to the event logger at %s", addr)
+
+	forwardLock.Lock()
+	defer forwardLock.Unlock()
+	if forwarder != nil {
+		forwarder.Close()
+	}
+	forwarder = conn
+	return nil
+}
+
+// forward sends a packed event to the remote event logger, returning false if events are not being
+//  forwarded. Events are sent on their own, so that a single lost datagram costs a single event.
+func forward(msg []byte) bool {
+	forwardLock.RLock()
+	defer forwardLock.RUnlock()
+	if forwarder == nil {
+		return false
+	}
+
+	if _, err := forwarder.Write(msg); err != nil {
+		forwardErrors.Inc("")
+		EventLoggerLog.Warnf("failed to forward event: %s", err)
+	}
+	return true
+}
+
+// stopForwarding closes the connection to the remote event logger, returning false if events were not
+//  being forwarded.
+func stopForwarding() bool {
+	forwardLock.Lock()
+	defer forwardLock.Unlock()
+	if forwarder == nil {
+		return false
+	}
+
+	forwarder.Close()
+	forwarder = nil
+	return true
+}
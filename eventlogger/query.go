@@ -0,0 +1,197 @@
+package eventlogger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The layout of the _time key of logged events.
+const TIME_LAYOUT = "2006-01-02 15:04:05-0700"
+
+// Event is an event read back from an event log, along with the line it was read from.
+type Event struct {
+	Keys map[string]interface{}
+	Line []byte
+}
+
+// DecodeEvent decodes a line of an event log. Numbers are kept as json.Number, so that DOIDs and
+//  channels are not rounded.
+func DecodeEvent(line []byte) (Event, error) {
+	event := Event{Keys: make(map[string]interface{}), Line: bytes.TrimRight(line, "\r\n")}
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&event.Keys); err != nil {
+		return Event{}, err
+	}
+
+	return event, nil
+}
+
+func (e Event) Type() string {
+	tp, _ := e.Keys["type"].(string)
+	return tp
+}
+
+func (e Event) Sender() string {
+	sender, _ := e.Keys["sender"].(string)
+	return sender
+}
+
+// Time returns the time at which the event was logged, if it has a valid _time key.
+func (e Event) Time() (time.Time, bool) {
+	str, _ := e.Keys["_time"].(string)
+	t, err := time.Parse(TIME_LAYOUT, str)
+	return t, err == nil
+}
+
+// Filter selects events by their keys. Criteria left at their zero value match every event.
+type Filter struct {
+	Since time.Time
+	Until time.Time
+	Types []string
+
+	// A pattern as accepted by path.Match, e.g. "Client: *"
+	Sender string
+
+	// Matches the doid or avatar key of an event
+	Doid uint64
+
+	// Matches the remote_address or address key of an event, either exactly or by host alone
+	Address string
+}
+
+func (f Filter) Match(e Event) bool {
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		t, ok := e.Time()
+		if !ok || (!f.Since.IsZero() && t.Before(f.Since)) || (!f.Until.IsZero() && !t.Before(f.Until)) {
+			return false
+		}
+	}
+
+	if len(f.Types) != 0 {
+		found := false
+		for _, tp := range f.Types {
+			found = found || tp == e.Type()
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.Sender != "" {
+		if matched, _ := path.Match(f.Sender, e.Sender()); !matched {
+			return false
+		}
+	}
+
+	if f.Doid != 0 && !matchNumber(e.Keys["doid"], f.Doid) && !matchNumber(e.Keys["avatar"], f.Doid) {
+		return false
+	}
+
+	if f.Address != "" && !matchAddress(e.Keys["remote_address"], f.Address) &&
+		!matchAddress(e.Keys["address"], f.Address) {
+		return false
+	}
+
+	return true
+}
+
+func matchNumber(value interface{}, n uint64) bool {
+	var str string
+	switch v := value.(type) {
+	case json.Number:
+		str = v.String()
+	case string:
+		str = v
+	default:
+		return false
+	}
+
+	parsed, err := strconv.ParseUint(str, 10, 64)
+	return err == nil && parsed == n
+}
+
+func matchAddress(value interface{}, address string) bool {
+	str, ok := value.(string)
+	if !ok {
+		return false
+	}
+
+	if str == address {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(str)
+	return err == nil && host == address
+}
+
+// OpenLog opens an event log for reading, decompressing it if it was compressed by rotation.
+func OpenLog(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(file)
+	if magic, _ := reader.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{gz, file}, nil
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, file}, nil
+}
+
+// LogFiles finds the event logs in a directory which were written with the given output format,
+//  including the ones closed by rotation, from oldest to newest.
+func LogFiles(dir string, output string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, outputPattern(filepath.Base(output))+"*"))
+	if err != nil {
+		return nil, err
+	}
+
+	type logFile struct {
+		path    string
+		modTime time.Time
+	}
+
+	matcher := outputMatcher(filepath.Base(output))
+	var logs []logFile
+	for _, match := range matches {
+		if !matcher.MatchString(filepath.Base(match)) {
+			continue
+		}
+		if info, err := os.Stat(match); err == nil && !info.IsDir() {
+			logs = append(logs, logFile{match, info.ModTime()})
+		}
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].modTime.Before(logs[j].modTime)
+	})
+
+	paths := make([]string, len(logs))
+	for n, log := range logs {
+		paths[n] = log.path
+	}
+	return paths, nil
+}
@@ -0,0 +1,269 @@
+package eventlogger
+
+import (
+	"astrongo/core"
+	"compress/gzip"
+	"fmt"
+	"github.com/jehiah/go-strftime"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Closed logs are compressed and pruned one rotation at a time.
+var finishLock sync.Mutex
+
+// Conversions of the output format which always produce digits.
+const NUMERIC_CONVERSIONS = "dHIjLmMSUwWyYf"
+
+// Rotate closes the current event log and continues in a new one, named by the configured output
+//  format. This happens on its own once the log reaches the configured size or age, and whenever the
+//  configuration is reloaded.
+func Rotate(reason string) {
+	logLock.Lock()
+	defer logLock.Unlock()
+	rotateLog(reason)
+}
+
+// rotateLog switches to a new event log, which starts with a log-rotated event naming the closed one.
+//  The closed log is then compressed and old logs are deleted in the background, as configured. If
+//  the new log cannot be opened, the current one is kept. The caller must hold logLock.
+func rotateLog(reason string) {
+	if logfile == nil {
+		return
+	}
+
+	conf := core.Current().Config.Eventlogger
+	now := time.Now()
+	path := strftime.Format(conf.Output, now)
+	closed := logPath
+
+	// An output format without a timestamp (or one too coarse) yields the same name again, in which
+	//  case the current log is moved out of the way. Its file stays open until the new one is ready.
+	renamed := path == logPath
+	if renamed {
+		closed = uniquePath(logPath + "." + now.Format("20060102-150405"))
+		if err := os.Rename(logPath, closed); err != nil {
+			EventLoggerLog.Errorf("failed to rotate logfile: %s", err)
+			return
+		}
+	} else {
+		path = uniquePath(path)
+	}
+
+	file, err := openLog(path)
+	if err != nil {
+		EventLoggerLog.Errorf("failed to rotate logfile: %s", err)
+		if renamed {
+			os.Rename(closed, logPath)
+		}
+		return
+	}
+
+	logfile.Sync()
+	logfile.Close()
+	setLog(file, path)
+
+	writeEvent(map[string]interface{}{
+		"type":     EVENT_LOG_ROTATED,
+		"sender":   "EventLogger",
+		"msg":      fmt.Sprintf("Log rotated upon %s.", reason),
+		"reason":   reason,
+		"previous": closed,
+	})
+
+	var sinks []string
+	for _, sink := range conf.Sinks {
+		if sink.Type == "file" {
+			sinks = append(sinks, sink.Path)
+		}
+	}
+
+	rotate := conf.Rotate
+	go finishLog(closed, conf.Output, sinks, rotate.Compress, rotate.Max_Files, rotate.Max_Age)
+}
+
+// uniquePath appends a number to a path if a file already exists there.
+func uniquePath(path string) string {
+	unique := path
+	for n := 1; ; n++ {
+		if _, err := os.Stat(unique); os.IsNotExist(err) {
+			return unique
+		}
+		unique = fmt.Sprintf("%s.%d", path, n)
+	}
+}
+
+// watchRotation rotates the log once it has been open for the configured interval. The interval is
+//  checked every second, so that a reload can change it.
+func watchRotation(stop chan bool) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			logLock.Lock()
+			interval := time.Duration(core.Current().Config.Eventlogger.Rotate.Interval) * time.Second
+			if interval > 0 && time.Since(logOpened) >= interval {
+				rotateLog("interval")
+			}
+			logLock.Unlock()
+		}
+	}
+}
+
+func finishLog(path string, output string, sinks []string, compress bool, maxFiles int, maxAge int) {
+	finishLock.Lock()
+	defer finishLock.Unlock()
+
+	if compress {
+		if err := compressLog(path); err != nil {
+			EventLoggerLog.Errorf("failed to compress logfile %s: %s", path, err)
+		}
+	}
+
+	if maxFiles > 0 || maxAge > 0 {
+		pruneLogs(output, sinks, maxFiles, time.Duration(maxAge)*time.Hour)
+	}
+}
+
+// compressLog replaces a closed log with a gzipped copy.
+func compressLog(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(uniquePath(path+".gz"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(out)
+	_, err = io.Copy(writer, in)
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+
+	in.Close()
+	return os.Remove(path)
+}
+
+// pruneLogs deletes closed logs beyond the newest maxFiles, or older than maxAge. Logs are found by
+//  matching file names against the output format, with any conversion matching anything; the
+//  suffixes added by rotation and compression are matched as well.
+func pruneLogs(output string, sinks []string, maxFiles int, maxAge time.Duration) {
+	matches, err := filepath.Glob(outputPattern(output) + "*")
+	if err != nil {
+		EventLoggerLog.Errorf("failed to find old logfiles: %s", err)
+		return
+	}
+
+	// Sinks may write to files which happen to match the output format
+	keep := make(map[string]bool)
+	for _, sink := range sinks {
+		if path, err := filepath.Abs(sink); err == nil {
+			keep[path] = true
+		}
+	}
+	matcher := outputMatcher(filepath.Base(output))
+
+	logLock.Lock()
+	current := logPath
+	logLock.Unlock()
+
+	type closedLog struct {
+		path    string
+		modTime time.Time
+	}
+
+	var logs []closedLog
+	for _, match := range matches {
+		if !matcher.MatchString(filepath.Base(match)) {
+			continue
+		}
+		if path, err := filepath.Abs(match); err != nil || keep[path] {
+			continue
+		}
+
+		info, err := os.Stat(match)
+		if err != nil || info.IsDir() || match == current {
+			continue
+		}
+		logs = append(logs, closedLog{match, info.ModTime()})
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].modTime.After(logs[j].modTime)
+	})
+
+	for n, old := range logs {
+		if (maxFiles > 0 && n >= maxFiles) || (maxAge > 0 && time.Since(old.modTime) > maxAge) {
+			if err := os.Remove(old.path); err != nil {
+				EventLoggerLog.Errorf("failed to delete old logfile: %s", err)
+			}
+		}
+	}
+}
+
+// outputPattern turns an output format into a glob pattern, e.g. events-%Y%m%d.log into events-*.log.
+func outputPattern(output string) string {
+	var pattern strings.Builder
+	for n := 0; n < len(output); n++ {
+		switch {
+		case output[n] != '%' || n == len(output)-1:
+			pattern.WriteByte(output[n])
+		case output[n+1] == '%':
+			pattern.WriteByte('%')
+			n++
+		default:
+			if !strings.HasSuffix(pattern.String(), "*") {
+				pattern.WriteByte('*')
+			}
+			n++
+		}
+	}
+	return pattern.String()
+}
+
+// outputMatcher matches the names of the logs written for an output format, which are the format
+//  itself followed by the suffixes added when a log is moved aside on rotation, given a unique name
+//  or compressed. The output format must not contain a directory.
+func outputMatcher(output string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for n := 0; n < len(output); n++ {
+		switch {
+		case output[n] != '%' || n == len(output)-1:
+			expr.WriteString(regexp.QuoteMeta(output[n : n+1]))
+		case output[n+1] == '%':
+			expr.WriteString("%")
+			n++
+		case strings.IndexByte(NUMERIC_CONVERSIONS, output[n+1]) >= 0:
+			expr.WriteString(`\d+`)
+			n++
+		default:
+			expr.WriteString(".+?")
+			n++
+		}
+	}
+	expr.WriteString(`(\.\d{8}-\d{6})?(\.\d+)?(\.gz(\.\d+)?)?$`)
+	return regexp.MustCompile(expr.String())
+}
@@ -0,0 +1,205 @@
+package eventlogger
+
+import (
+	"astrongo/core"
+	"astrongo/metrics"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	DEFAULT_SINK_BUFFER = 1024
+
+	sinkRetryDelay   = 5 * time.Second
+	sinkWriteTimeout = 5 * time.Second
+)
+
+// The running sinks, guarded by logLock.
+var sinks []*sink
+
+var droppedEvents = metrics.NewCounter("astron_eventlogger_sink_dropped_total",
+	"Number of events dropped because the buffer of a sink was full.", "sink")
+var sinkErrors = metrics.NewCounter("astron_eventlogger_sink_errors_total",
+	"Number of failed connections and writes to sinks.", "sink")
+
+// A sink receives every logged event of the types it accepts as a line of JSON. Events are queued
+//  and written by the sink's own goroutine; once the queue is full, further events are dropped, so
+//  that a slow or unreachable sink never holds up the event logger.
+type sink struct {
+	name  string
+	types map[string]bool
+	queue chan []byte
+	stop  chan bool
+	done  chan bool
+
+	open    func() (io.Writer, error)
+	out     io.Writer
+	failing bool
+}
+
+func newSink(conf core.EventSink) (*sink, error) {
+	s := &sink{name: conf.Type, types: make(map[string]bool), stop: make(chan bool), done: make(chan bool)}
+
+	switch conf.Type {
+	case "stdout":
+		s.open = func() (io.Writer, error) { return os.Stdout, nil }
+	case "file":
+		if conf.Path == "" {
+			return nil, errors.New("missing path")
+		}
+		s.name = "file:" + conf.Path
+		s.open = func() (io.Writer, error) {
+			return os.OpenFile(conf.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		}
+	case "tcp", "unix":
+		if conf.Address == "" {
+			return nil, errors.New("missing address")
+		}
+		s.name = conf.Type + ":" + conf.Address
+		s.open = func() (io.Writer, error) {
+			return net.DialTimeout(conf.Type, conf.Address, sinkWriteTimeout)
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown sink type %q", conf.Type))
+	}
+
+	for _, tp := range conf.Types {
+		s.types[tp] = true
+	}
+
+	buffer := conf.Buffer
+	if buffer <= 0 {
+		buffer = DEFAULT_SINK_BUFFER
+	}
+	s.queue = make(chan []byte, buffer)
+
+	return s, nil
+}
+
+// OpenSinks replaces the running sinks with the ones in the configuration. Events already queued for
+//  the old sinks are still written, unless a sink cannot keep up before the write timeout.
+func OpenSinks() {
+	var opened []*sink
+	for n, conf := range core.Current().Config.Eventlogger.Sinks {
+		s, err := newSink(conf)
+		if err != nil {
+			EventLoggerLog.Errorf("eventlogger.sinks[%d]: %s", n, err)
+			continue
+		}
+
+		go s.run()
+		opened = append(opened, s)
+	}
+
+	logLock.Lock()
+	if logfile == nil {
+		// The event logger is not running
+		logLock.Unlock()
+		go closeSinks(opened)
+		return
+	}
+	closed := sinks
+	sinks = opened
+	logLock.Unlock()
+
+	go closeSinks(closed)
+}
+
+// closeSinks lets sinks write out their queues and stops them, giving up on the ones which are not
+//  done after the write timeout.
+func closeSinks(closed []*sink) {
+	for _, s := range closed {
+		close(s.queue)
+	}
+
+	timeout := time.After(sinkWriteTimeout)
+	for _, s := range closed {
+		select {
+		case <-s.done:
+		case <-timeout:
+			close(s.stop)
+			<-s.done
+		}
+	}
+}
+
+// dispatch queues an event for every sink which accepts its type. The caller must hold logLock.
+func dispatch(event map[string]interface{}, line []byte) {
+	tp, _ := event["type"].(string)
+	for _, s := range sinks {
+		if len(s.types) == 0 || s.types[tp] {
+			s.push(line)
+		}
+	}
+}
+
+func (s *sink) push(line []byte) {
+	select {
+	case s.queue <- line:
+	default:
+		droppedEvents.Inc(s.name)
+	}
+}
+
+func (s *sink) run() {
+	defer close(s.done)
+	defer s.disconnect()
+
+	for line := range s.queue {
+		for !s.write(line) {
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(sinkRetryDelay):
+			}
+		}
+	}
+}
+
+// write sends a line to the sink, connecting to it first if needed. Failures are only logged once
+//  until the sink recovers, since a missing collector would otherwise flood the console.
+func (s *sink) write(line []byte) bool {
+	if s.out == nil {
+		out, err := s.open()
+		if err != nil {
+			s.fail(err)
+			return false
+		}
+		s.out = out
+	}
+
+	if conn, ok := s.out.(net.Conn); ok {
+		conn.SetWriteDeadline(time.Now().Add(sinkWriteTimeout))
+	}
+
+	if _, err := s.out.Write(line); err != nil {
+		s.fail(err)
+		s.disconnect()
+		return false
+	}
+
+	if s.failing {
+		EventLoggerLog.Infof("Sink %s recovered", s.name)
+		s.failing = false
+	}
+	return true
+}
+
+func (s *sink) fail(err error) {
+	sinkErrors.Inc(s.name)
+	if !s.failing {
+		EventLoggerLog.Errorf("failed to write to sink %s: %s", s.name, err)
+		s.failing = true
+	}
+}
+
+func (s *sink) disconnect() {
+	if closer, ok := s.out.(io.Closer); ok && s.out != os.Stdout {
+		closer.Close()
+	}
+	s.out = nil
+}
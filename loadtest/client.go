@@ -0,0 +1,366 @@
+package loadtest
+
+import (
+	"astrongo/clientagent"
+	. "astrongo/util"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	gonet "net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Datagrams from the client agent larger than this end the connection.
+const MAX_DATAGRAM_SIZE = 1 << 24
+
+// connection is one connection of a simulated client to the client agent. Unlike net.Client, it
+//  reads datagrams in order on a single goroutine, which keeps thousands of connections cheap and
+//  ensures that objects are entered before the interest which they belong to is done.
+type connection struct {
+	conn      gonet.Conn
+	writeLock sync.Mutex
+	stats     *stats
+
+	hello   chan bool
+	closed  chan bool
+	closing int32 // Set once the connection is expected to close
+
+	lock    sync.Mutex
+	pending map[uint32]chan bool
+}
+
+func dial(address string, stats *stats) (*connection, error) {
+	conn, err := gonet.DialTimeout("tcp", address, DEFAULT_CONNECT_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &connection{
+		conn:    conn,
+		stats:   stats,
+		hello:   make(chan bool),
+		closed:  make(chan bool),
+		pending: make(map[uint32]chan bool),
+	}
+	go c.read()
+	return c, nil
+}
+
+func (c *connection) send(dg Datagram) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	frame := NewDatagram()
+	frame.AddSize(Dgsize_t(dg.Len()))
+	frame.AddDatagram(&dg)
+
+	c.conn.SetWriteDeadline(time.Now().Add(DEFAULT_CONNECT_TIMEOUT))
+	_, err := c.conn.Write(frame.Bytes())
+	return err
+}
+
+// close ends the connection; a connection closed this way is not counted as lost.
+func (c *connection) close() {
+	atomic.StoreInt32(&c.closing, 1)
+	c.conn.Close()
+	<-c.closed
+}
+
+// expect registers a context for which a CLIENT_DONE_INTEREST_RESP is awaited.
+func (c *connection) expect(context uint32) chan bool {
+	done := make(chan bool)
+	c.lock.Lock()
+	c.pending[context] = done
+	c.lock.Unlock()
+	return done
+}
+
+func (c *connection) forget(context uint32) {
+	c.lock.Lock()
+	delete(c.pending, context)
+	c.lock.Unlock()
+}
+
+func (c *connection) read() {
+	defer close(c.closed)
+	defer c.conn.Close()
+
+	reader := bufio.NewReader(c.conn)
+	size := make([]byte, Dgsize)
+	helloDone := false
+	for {
+		if _, err := io.ReadFull(reader, size); err != nil {
+			c.lost()
+			return
+		}
+
+		length := binary.LittleEndian.Uint32(size)
+		if length > MAX_DATAGRAM_SIZE {
+			c.lost()
+			return
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			c.lost()
+			return
+		}
+
+		if !c.handle(data, &helloDone) {
+			return
+		}
+	}
+}
+
+// handle counts a datagram received from the client agent, returning false once the connection
+//  should be closed.
+func (c *connection) handle(data []byte, helloDone *bool) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			// Datagrams cut short are ignored; the client agent is not under test here
+			ok = true
+		}
+	}()
+
+	dg := NewDatagram()
+	dg.Write(data)
+	dgi := NewDatagramIterator(&dg)
+	switch dgi.ReadUint16() {
+	case clientagent.CLIENT_HELLO_RESP:
+		if !*helloDone {
+			*helloDone = true
+			close(c.hello)
+		}
+	case clientagent.CLIENT_EJECT:
+		atomic.StoreInt32(&c.closing, 1)
+		c.stats.ejected(dgi.ReadUint16())
+		return false
+	case clientagent.CLIENT_ENTER_OBJECT_REQUIRED, clientagent.CLIENT_ENTER_OBJECT_REQUIRED_OTHER,
+		clientagent.CLIENT_ENTER_OBJECT_REQUIRED_OWNER, clientagent.CLIENT_ENTER_OBJECT_REQUIRED_OTHER_OWNER:
+		atomic.AddInt64(&c.stats.objectsEntered, 1)
+	case clientagent.CLIENT_OBJECT_LEAVING, clientagent.CLIENT_OBJECT_LEAVING_OWNER:
+		atomic.AddInt64(&c.stats.objectsLeft, 1)
+	case clientagent.CLIENT_OBJECT_SET_FIELD:
+		atomic.AddInt64(&c.stats.fieldsReceived, 1)
+	case clientagent.CLIENT_OBJECT_SET_FIELDS:
+		dgi.ReadDoid()
+		atomic.AddInt64(&c.stats.fieldsReceived, int64(dgi.ReadUint16()))
+	case clientagent.CLIENT_DONE_INTEREST_RESP:
+		context := dgi.ReadUint32()
+		c.lock.Lock()
+		if done, ok := c.pending[context]; ok {
+			delete(c.pending, context)
+			close(done)
+		}
+		c.lock.Unlock()
+	}
+	return true
+}
+
+func (c *connection) lost() {
+	if atomic.LoadInt32(&c.closing) == 0 {
+		atomic.AddInt64(&c.stats.lost, 1)
+	}
+}
+
+// bot is a simulated client, which runs the steps of its behaviour over one connection at a time.
+type bot struct {
+	test      *LoadTest
+	behaviour behaviour
+	rand      *rand.Rand
+
+	conn    *connection
+	context uint32
+}
+
+var errStopped = errors.New("load test stopped")
+
+func (b *bot) run() {
+	defer b.test.wg.Done()
+	defer b.disconnect(false)
+
+	for {
+		for _, st := range b.behaviour.steps {
+			if b.conn == nil {
+				if err := b.connect(); err != nil {
+					return
+				}
+			}
+
+			if err := b.step(st); err != nil {
+				return
+			}
+		}
+
+		if !b.behaviour.loop {
+			break
+		}
+	}
+
+	if b.conn == nil {
+		return
+	}
+
+	select {
+	case <-b.test.stop:
+	case <-b.conn.closed:
+	}
+}
+
+// connect opens a connection and introduces the client with CLIENT_HELLO.
+func (b *bot) connect() error {
+	start := time.Now()
+	conn, err := dial(b.test.script.Address, b.test.stats)
+	if err != nil {
+		atomic.AddInt64(&b.test.stats.failed, 1)
+		return err
+	}
+
+	hello := NewDatagram()
+	hello.AddUint16(clientagent.CLIENT_HELLO)
+	hello.AddUint32(b.test.hash)
+	hello.AddString(b.test.script.Version)
+	if err := conn.send(hello); err != nil {
+		conn.close()
+		atomic.AddInt64(&b.test.stats.failed, 1)
+		return err
+	}
+
+	select {
+	case <-conn.hello:
+	case <-conn.closed:
+		atomic.AddInt64(&b.test.stats.failed, 1)
+		return errors.New("connection closed before CLIENT_HELLO_RESP")
+	case <-time.After(DEFAULT_CONNECT_TIMEOUT):
+		conn.close()
+		atomic.AddInt64(&b.test.stats.failed, 1)
+		return errors.New("no CLIENT_HELLO_RESP")
+	case <-b.test.stop:
+		conn.close()
+		return errStopped
+	}
+
+	b.test.stats.helloDone(time.Since(start))
+	atomic.AddInt64(&b.test.stats.connections, 1)
+	atomic.AddInt64(&b.test.stats.connected, 1)
+	b.conn = conn
+	go b.heartbeat(conn)
+	return nil
+}
+
+func (b *bot) heartbeat(conn *connection) {
+	ticker := time.NewTicker(b.test.script.Heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			dg := NewDatagram()
+			dg.AddUint16(clientagent.CLIENT_HEARTBEAT)
+			if conn.send(dg) != nil {
+				return
+			}
+			atomic.AddInt64(&b.test.stats.heartbeats, 1)
+		case <-conn.closed:
+			return
+		}
+	}
+}
+
+// disconnect closes the current connection, first sending CLIENT_DISCONNECT if asked to.
+func (b *bot) disconnect(clean bool) {
+	if b.conn == nil {
+		return
+	}
+
+	if clean {
+		dg := NewDatagram()
+		dg.AddUint16(clientagent.CLIENT_DISCONNECT)
+		b.conn.send(dg)
+		atomic.AddInt64(&b.test.stats.disconnects, 1)
+	}
+
+	b.conn.close()
+	b.conn = nil
+	atomic.AddInt64(&b.test.stats.connected, -1)
+}
+
+// step takes one step of the behaviour, returning an error if the client should stop.
+func (b *bot) step(st step) error {
+	switch st.Action {
+	case ACTION_ADD_INTEREST:
+		b.context++
+		context := b.context
+		dg := NewDatagram()
+		if len(st.Zones) == 1 {
+			dg.AddUint16(clientagent.CLIENT_ADD_INTEREST)
+		} else {
+			dg.AddUint16(clientagent.CLIENT_ADD_INTEREST_MULTIPLE)
+		}
+		dg.AddUint32(context)
+		dg.AddUint16(st.Interest)
+		dg.AddDoid(Doid_t(st.Parent))
+		if len(st.Zones) != 1 {
+			dg.AddUint16(uint16(len(st.Zones)))
+		}
+		for _, zone := range st.Zones {
+			dg.AddZone(Zone_t(zone))
+		}
+
+		done := b.conn.expect(context)
+		start := time.Now()
+		if err := b.conn.send(dg); err != nil {
+			return err
+		}
+
+		select {
+		case <-done:
+			b.test.stats.interestDone(time.Since(start))
+		case <-time.After(b.test.script.Interest_Timeout):
+			b.conn.forget(context)
+			atomic.AddInt64(&b.test.stats.timeouts, 1)
+		case <-b.conn.closed:
+			return errors.New("connection closed")
+		case <-b.test.stop:
+			return errStopped
+		}
+	case ACTION_REMOVE_INTEREST:
+		b.context++
+		dg := NewDatagram()
+		dg.AddUint16(clientagent.CLIENT_REMOVE_INTEREST)
+		dg.AddUint32(b.context)
+		dg.AddUint16(st.Interest)
+		return b.conn.send(dg)
+	case ACTION_SET_FIELD:
+		dg := NewDatagram()
+		dg.AddUint16(clientagent.CLIENT_OBJECT_SET_FIELD)
+		dg.AddDoid(Doid_t(st.Do))
+		dg.AddUint16(uint16(st.field.Id()))
+		dg.AddData(st.value)
+		if err := b.conn.send(dg); err != nil {
+			return err
+		}
+		atomic.AddInt64(&b.test.stats.fieldsSent, 1)
+	case ACTION_WAIT:
+		wait := st.Duration
+		if st.Jitter > 0 {
+			wait += time.Duration(b.rand.Int63n(int64(st.Jitter)))
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-b.conn.closed:
+			return errors.New("connection closed")
+		case <-b.test.stop:
+			return errStopped
+		}
+	case ACTION_DISCONNECT:
+		b.disconnect(true)
+	}
+
+	return nil
+}
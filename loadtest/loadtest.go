@@ -0,0 +1,97 @@
+package loadtest
+
+import (
+	"astrongo/dclass/dc"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// LoadTest simulates many clients connecting to a client agent, each following a behaviour of its
+//  script, and measures how the cluster keeps up with them.
+type LoadTest struct {
+	script     Script
+	file       *dc.File
+	hash       uint32
+	behaviours []behaviour
+
+	stats    *stats
+	start    time.Time
+	stop     chan bool
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// New checks a script and prepares a load test from it. The elapsed time of reports counts from here,
+//  so Run is expected to follow right away.
+func New(script Script) (*LoadTest, error) {
+	file, hash, behaviours, err := script.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoadTest{
+		script:     script,
+		file:       file,
+		hash:       hash,
+		behaviours: behaviours,
+		stats:      newStats(),
+		start:      time.Now(),
+		stop:       make(chan bool),
+	}, nil
+}
+
+// Run connects the clients of the test, spread evenly over the ramp, and returns a report once the
+//  duration of the test has passed or Stop is called. A test can only be run once.
+func (l *LoadTest) Run() Report {
+	if l.script.Duration > 0 {
+		timer := time.AfterFunc(l.script.Duration, l.Stop)
+		defer timer.Stop()
+	}
+
+	interval := l.script.Ramp / time.Duration(l.script.Clients)
+	for n := 0; n < l.script.Clients && !l.stopped(); n++ {
+		if n > 0 && interval > 0 {
+			select {
+			case <-time.After(interval):
+			case <-l.stop:
+				continue
+			}
+		}
+
+		// Behaviours are dealt out in turn, so that each has its share of clients at every point
+		//  of the ramp.
+		l.wg.Add(1)
+		b := &bot{
+			test:      l,
+			behaviour: l.behaviours[n%len(l.behaviours)],
+			rand:      rand.New(rand.NewSource(int64(n))),
+		}
+		go b.run()
+	}
+
+	<-l.stop
+	l.wg.Wait()
+	return l.Report()
+}
+
+// Stop ends the test, disconnecting every client.
+func (l *LoadTest) Stop() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+}
+
+func (l *LoadTest) stopped() bool {
+	select {
+	case <-l.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Report returns the statistics of the test so far; it may be called while the test runs.
+func (l *LoadTest) Report() Report {
+	return l.stats.report(time.Since(l.start))
+}
@@ -0,0 +1,233 @@
+package loadtest
+
+import (
+	"astrongo/clientagent"
+	. "astrongo/util"
+	"bufio"
+	"encoding/binary"
+	"github.com/stretchr/testify/require"
+	"io"
+	gonet "net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClientAgent answers just enough of the client protocol for the load test: every interest
+//  is answered with one object per zone, followed by CLIENT_DONE_INTEREST_RESP.
+type fakeClientAgent struct {
+	listener gonet.Listener
+
+	lock   sync.Mutex
+	hellos []string
+	fields int64
+	beats  int64
+	eject  bool
+}
+
+func startFakeClientAgent(t *testing.T) *fakeClientAgent {
+	listener, err := gonet.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ca := &fakeClientAgent{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go ca.serve(conn)
+		}
+	}()
+	return ca
+}
+
+func (ca *fakeClientAgent) serve(conn gonet.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	send := func(dg Datagram) {
+		frame := NewDatagram()
+		frame.AddSize(Dgsize_t(dg.Len()))
+		frame.AddDatagram(&dg)
+		conn.Write(frame.Bytes())
+	}
+
+	for {
+		size := make([]byte, Dgsize)
+		if _, err := io.ReadFull(reader, size); err != nil {
+			return
+		}
+		data := make([]byte, binary.LittleEndian.Uint32(size))
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return
+		}
+
+		dg := NewDatagram()
+		dg.Write(data)
+		dgi := NewDatagramIterator(&dg)
+		resp := NewDatagram()
+		switch dgi.ReadUint16() {
+		case clientagent.CLIENT_HELLO:
+			hash := dgi.ReadUint32()
+			version := dgi.ReadString()
+			ca.lock.Lock()
+			ca.hellos = append(ca.hellos, version)
+			eject := ca.eject
+			ca.lock.Unlock()
+
+			if eject || hash == 0 {
+				resp.AddUint16(clientagent.CLIENT_EJECT)
+				resp.AddUint16(clientagent.CLIENT_DISCONNECT_BAD_DCHASH)
+				resp.AddString("Bad DC hash")
+				send(resp)
+				return
+			}
+			resp.AddUint16(clientagent.CLIENT_HELLO_RESP)
+			send(resp)
+		case clientagent.CLIENT_HEARTBEAT:
+			atomic.AddInt64(&ca.beats, 1)
+		case clientagent.CLIENT_OBJECT_SET_FIELD:
+			atomic.AddInt64(&ca.fields, 1)
+		case clientagent.CLIENT_ADD_INTEREST, clientagent.CLIENT_ADD_INTEREST_MULTIPLE:
+			multiple := dgi.Copy()
+			multiple.Seek(0)
+			context, id, parent := dgi.ReadUint32(), dgi.ReadUint16(), dgi.ReadDoid()
+			zones := 1
+			if multiple.ReadUint16() == clientagent.CLIENT_ADD_INTEREST_MULTIPLE {
+				zones = int(dgi.ReadUint16())
+			}
+
+			for n := 0; n < zones; n++ {
+				enter := NewDatagram()
+				enter.AddUint16(clientagent.CLIENT_ENTER_OBJECT_REQUIRED)
+				enter.AddDoid(Doid_t(1000 + n))
+				enter.AddLocation(parent, dgi.ReadZone())
+				enter.AddUint16(0)
+				send(enter)
+			}
+
+			resp.AddUint16(clientagent.CLIENT_DONE_INTEREST_RESP)
+			resp.AddUint32(context)
+			resp.AddUint16(id)
+			send(resp)
+		}
+	}
+}
+
+func TestLoadTest_Run(t *testing.T) {
+	ca := startFakeClientAgent(t)
+	defer ca.listener.Close()
+
+	script := Script{
+		Address:   ca.listener.Addr().String(),
+		Version:   "loadtest-v1",
+		DC_Files:  []string{"dclass/parse/test.dc"},
+		Clients:   20,
+		Ramp:      100 * time.Millisecond,
+		Duration:  600 * time.Millisecond,
+		Heartbeat: 50 * time.Millisecond,
+		Behaviours: []Behaviour{
+			{Name: "wanderer", Weight: 3, Loop: true, Steps: []Step{
+				{Action: ACTION_ADD_INTEREST, Interest: 1, Parent: 100, Zones: []uint32{1, 2}},
+				{Action: ACTION_SET_FIELD, Do: 1000, Field: "DistributedClientTestObject.setColor",
+					Value: []interface{}{1, 2, 3}},
+				{Action: ACTION_WAIT, Duration: 20 * time.Millisecond, Jitter: 10 * time.Millisecond},
+				{Action: ACTION_REMOVE_INTEREST, Interest: 1},
+			}},
+			{Name: "churner", Loop: true, Steps: []Step{
+				{Action: ACTION_ADD_INTEREST, Interest: 1, Parent: 100, Zones: []uint32{1}},
+				{Action: ACTION_DISCONNECT},
+				{Action: ACTION_WAIT, Duration: 50 * time.Millisecond},
+			}},
+		},
+	}
+
+	test, err := New(script)
+	require.NoError(t, err)
+	report := test.Run()
+
+	require.Zero(t, report.Connected)
+	require.Zero(t, report.Failed)
+	require.Zero(t, report.Lost)
+	require.Zero(t, report.Timeouts)
+	require.True(t, report.Disconnects > 0)
+	// A churner which disconnects just before the test ends may not have completed CLIENT_HELLO again
+	require.True(t, report.Connections >= 20 && report.Connections <= 20+report.Disconnects)
+	require.Equal(t, report.Connections, report.Hello.Count)
+	require.True(t, report.Interests.Count > 20)
+	require.True(t, report.Interests.P50 <= report.Interests.Max)
+	require.True(t, report.ObjectsEntered >= report.Interests.Count)
+	require.EqualValues(t, atomic.LoadInt64(&ca.fields), report.FieldsSent)
+	require.True(t, report.Heartbeats > 0)
+
+	ca.lock.Lock()
+	require.Len(t, ca.hellos, report.Connections)
+	require.Equal(t, "loadtest-v1", ca.hellos[0])
+	ca.lock.Unlock()
+}
+
+func TestLoadTest_Ejected(t *testing.T) {
+	ca := startFakeClientAgent(t)
+	defer ca.listener.Close()
+	ca.eject = true
+
+	test, err := New(Script{
+		Address:  ca.listener.Addr().String(),
+		Version:  "loadtest-v1",
+		Dc_Hash:  0x1234,
+		Clients:  5,
+		Duration: 200 * time.Millisecond,
+		Behaviours: []Behaviour{{Steps: []Step{
+			{Action: ACTION_WAIT, Duration: time.Second},
+		}}},
+	})
+	require.NoError(t, err)
+
+	report := test.Run()
+	require.Equal(t, 5, report.Failed)
+	require.Equal(t, map[uint16]int{clientagent.CLIENT_DISCONNECT_BAD_DCHASH: 5}, report.Ejections)
+	require.Zero(t, report.Connections)
+}
+
+func TestLoadTest_Script(t *testing.T) {
+	_, err := New(Script{Behaviours: []Behaviour{{Loop: true, Steps: []Step{
+		{Action: ACTION_SET_FIELD, Field: "setColor"},
+		{Action: "dance"},
+	}}}})
+	require.Error(t, err)
+	require.Equal(t, "address: no client agent address\n"+
+		"clients: must be at least 1\n"+
+		"behaviours[0].steps[0]: set_field needs dc_files\n"+
+		"behaviours[0].steps[1]: unknown action \"dance\"\n"+
+		"behaviours[0]: a looping behaviour needs a wait or add_interest step", err.Error())
+
+	path := os.TempDir() + "/astron-loadtest.yml"
+	require.NoError(t, os.WriteFile(path, []byte(`
+address: 127.0.0.1:6667
+dc_files: [dclass/parse/test.dc]
+clients: 100
+ramp: 10s
+interest_timeout: 2s
+behaviours:
+  - name: chatter
+    loop: true
+    steps:
+      - {action: set_field, do: 1000, field: DistributedClientTestObject.sendMessage, value: ["hi"]}
+      - {action: wait, duration: 1s}
+`), 0644))
+	defer os.Remove(path)
+
+	script, err := LoadScript(path)
+	require.NoError(t, err)
+	require.Equal(t, 100, script.Clients)
+	require.Equal(t, 10*time.Second, script.Ramp)
+	require.Equal(t, 2*time.Second, script.Interest_Timeout)
+	require.Len(t, script.Behaviours[0].Steps, 2)
+
+	test, err := New(*script)
+	require.NoError(t, err)
+	require.Equal(t, DEFAULT_HEARTBEAT, test.script.Heartbeat)
+	require.Equal(t, []byte{2, 0, 0, 0, 'h', 'i'}, test.behaviours[0].steps[0].value)
+}
@@ -0,0 +1,244 @@
+package loadtest
+
+import (
+	"astrongo/core"
+	"astrongo/dclass/dc"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_HEARTBEAT        = 5 * time.Second
+	DEFAULT_INTEREST_TIMEOUT = 10 * time.Second
+	DEFAULT_CONNECT_TIMEOUT  = 10 * time.Second
+)
+
+// Actions which a step of a behaviour may take.
+const (
+	ACTION_ADD_INTEREST    = "add_interest"
+	ACTION_REMOVE_INTEREST = "remove_interest"
+	ACTION_SET_FIELD       = "set_field"
+	ACTION_WAIT            = "wait"
+	ACTION_DISCONNECT      = "disconnect"
+)
+
+// Script describes a load test: where to connect, how many clients to simulate and what they do. It
+//  is read from YAML, with keys named after the fields in lower case, e.g.
+//
+//    address: 127.0.0.1:6667
+//    version: "my-game-v1"
+//    dc_files: [game.dc]
+//    clients: 2000
+//    ramp: 30s
+//    duration: 5m
+//    behaviours:
+//      - name: wanderer
+//        weight: 3
+//        loop: true
+//        steps:
+//          - {action: add_interest, interest: 1, parent: 10000, zones: [2000, 2001]}
+//          - {action: set_field, do: 10000, field: DistributedAvatar.setChat, value: ["hi"]}
+//          - {action: wait, duration: 2s, jitter: 1s}
+//          - {action: remove_interest, interest: 1}
+type Script struct {
+	Address string // Of the client agent
+	Version string // Sent in CLIENT_HELLO
+
+	// The DC files of the cluster, which give the hash sent in CLIENT_HELLO and the fields which
+	//  behaviours send. Dc_Hash overrides the hash if it is set.
+	DC_Files []string
+	Dc_Hash  uint32
+
+	Clients          int
+	Ramp             time.Duration // Over which clients are connected; all at once if zero
+	Duration         time.Duration // Of the whole test; until stopped if zero
+	Heartbeat        time.Duration // Between CLIENT_HEARTBEATs
+	Interest_Timeout time.Duration // After which an interest without a CLIENT_DONE_INTEREST_RESP is counted as timed out
+
+	Behaviours []Behaviour
+}
+
+// Behaviour is a sequence of steps taken by a share of the clients. Clients are assigned behaviours
+//  in proportion to their weight, which is 1 if left out.
+type Behaviour struct {
+	Name   string
+	Weight int
+	Loop   bool // Repeat the steps until the test ends, rather than idling after the last one
+	Steps  []Step
+}
+
+// Step is one action of a behaviour. Which keys are used depends on the action:
+//
+//    add_interest     interest, parent, zones; waits for CLIENT_DONE_INTEREST_RESP
+//    remove_interest  interest
+//    set_field        do, field (as Class.field), value (a list with one value per parameter)
+//    wait             duration, jitter (a random extra duration, up to the given one)
+//    disconnect       sends CLIENT_DISCONNECT; the client connects again for the next step
+type Step struct {
+	Action string
+
+	Interest uint16
+	Parent   uint32
+	Zones    []uint32
+
+	Do    uint32
+	Field string
+	Value interface{}
+
+	Duration time.Duration
+	Jitter   time.Duration
+}
+
+// LoadScript reads a script from a YAML file.
+func LoadScript(path string) (*Script, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, errors.New(fmt.Sprintf("Unable to load script: %v", err))
+	}
+
+	script := &Script{}
+	if err := v.Unmarshal(script); err != nil {
+		return nil, errors.New(fmt.Sprintf("Unable to decode script: %v", err))
+	}
+
+	return script, nil
+}
+
+// A behaviour resolved against the DC file, ready to be run by clients.
+type behaviour struct {
+	name  string
+	loop  bool
+	steps []step
+}
+
+type step struct {
+	Step
+	field dc.Field
+	value []byte
+}
+
+// compile checks a script, fills in its defaults and resolves the fields its behaviours send. Every
+//  problem found is reported, one per line.
+func (s *Script) compile() (file *dc.File, hash uint32, behaviours []behaviour, err error) {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if s.Address == "" {
+		problem("address: no client agent address")
+	}
+	if s.Clients <= 0 {
+		problem("clients: must be at least 1")
+	}
+	if s.Ramp < 0 || s.Duration < 0 || s.Heartbeat < 0 || s.Interest_Timeout < 0 {
+		problem("ramp, duration, heartbeat and interest_timeout must not be negative")
+	}
+	if s.Heartbeat == 0 {
+		s.Heartbeat = DEFAULT_HEARTBEAT
+	}
+	if s.Interest_Timeout == 0 {
+		s.Interest_Timeout = DEFAULT_INTEREST_TIMEOUT
+	}
+
+	if len(s.DC_Files) != 0 {
+		if file, err = core.ReadDC(s.DC_Files); err != nil {
+			problem("dc_files: %v", err)
+		} else {
+			hash = core.ComputeHash(file)
+		}
+	}
+	if s.Dc_Hash != 0 {
+		hash = s.Dc_Hash
+	}
+
+	if len(s.Behaviours) == 0 {
+		problem("behaviours: no behaviours")
+	}
+	for n, b := range s.Behaviours {
+		where := fmt.Sprintf("behaviours[%d]", n)
+		if b.Weight < 0 {
+			problem("%s: weight must not be negative", where)
+		}
+
+		compiled := behaviour{name: b.Name, loop: b.Loop}
+		if compiled.name == "" {
+			compiled.name = where
+		}
+
+		waits := false
+		for m, st := range b.Steps {
+			where := fmt.Sprintf("behaviours[%d].steps[%d]", n, m)
+			compiled.steps = append(compiled.steps, step{Step: st})
+			switch st.Action {
+			case ACTION_ADD_INTEREST:
+				waits = true
+				if len(st.Zones) == 0 {
+					problem("%s: add_interest needs at least one zone", where)
+				}
+			case ACTION_REMOVE_INTEREST, ACTION_DISCONNECT:
+			case ACTION_WAIT:
+				waits = waits || st.Duration > 0 || st.Jitter > 0
+				if st.Duration < 0 || st.Jitter < 0 {
+					problem("%s: duration and jitter must not be negative", where)
+				}
+			case ACTION_SET_FIELD:
+				field, value, err := resolveField(file, st)
+				if err != nil {
+					problem("%s: %v", where, err)
+				}
+				compiled.steps[m].field, compiled.steps[m].value = field, value
+			default:
+				problem("%s: unknown action %q", where, st.Action)
+			}
+		}
+
+		if b.Loop && !waits {
+			problem("%s: a looping behaviour needs a wait or add_interest step", where)
+		}
+		weight := b.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		for w := 0; w < weight; w++ {
+			behaviours = append(behaviours, compiled)
+		}
+	}
+
+	if len(problems) != 0 {
+		return nil, 0, nil, errors.New(strings.Join(problems, "\n"))
+	}
+	return file, hash, behaviours, nil
+}
+
+func resolveField(file *dc.File, st Step) (dc.Field, []byte, error) {
+	if file == nil {
+		return nil, nil, errors.New("set_field needs dc_files")
+	}
+
+	parts := strings.SplitN(st.Field, ".", 2)
+	if len(parts) != 2 {
+		return nil, nil, errors.New(fmt.Sprintf("field %q is not given as Class.field", st.Field))
+	}
+
+	cls, ok := file.ClassByName(parts[0])
+	if !ok {
+		return nil, nil, errors.New(fmt.Sprintf("unknown class %s", parts[0]))
+	}
+
+	field, ok := cls.GetFieldByName(parts[1])
+	if !ok {
+		return nil, nil, errors.New(fmt.Sprintf("class %s has no field %s", parts[0], parts[1]))
+	}
+
+	value, err := dc.Pack(field, st.Value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return field, value, nil
+}
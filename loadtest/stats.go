@@ -0,0 +1,184 @@
+package loadtest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stats are gathered by every client of a load test as it runs.
+type stats struct {
+	connected      int64
+	connections    int64
+	failed         int64
+	lost           int64
+	disconnects    int64
+	objectsEntered int64
+	objectsLeft    int64
+	fieldsSent     int64
+	fieldsReceived int64
+	timeouts       int64
+	heartbeats     int64
+
+	lock      sync.Mutex
+	hello     []time.Duration
+	interests []time.Duration
+	ejections map[uint16]int
+}
+
+func newStats() *stats {
+	return &stats{ejections: make(map[uint16]int)}
+}
+
+func (s *stats) helloDone(latency time.Duration) {
+	s.lock.Lock()
+	s.hello = append(s.hello, latency)
+	s.lock.Unlock()
+}
+
+func (s *stats) interestDone(latency time.Duration) {
+	s.lock.Lock()
+	s.interests = append(s.interests, latency)
+	s.lock.Unlock()
+}
+
+func (s *stats) ejected(reason uint16) {
+	s.lock.Lock()
+	s.ejections[reason]++
+	s.lock.Unlock()
+}
+
+// Latency summarizes a set of measured latencies.
+type Latency struct {
+	Count int
+	Min   time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+func summarize(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p int) time.Duration {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+
+	return Latency{
+		Count: len(sorted),
+		Min:   sorted[0],
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P99:   percentile(99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+func (l Latency) String() string {
+	if l.Count == 0 {
+		return "none"
+	}
+
+	round := func(d time.Duration) time.Duration { return d.Round(10 * time.Microsecond) }
+	return fmt.Sprintf("n=%d min=%s p50=%s p90=%s p99=%s max=%s", l.Count,
+		round(l.Min), round(l.P50), round(l.P90), round(l.P99), round(l.Max))
+}
+
+// Report is a snapshot of the statistics of a load test.
+type Report struct {
+	Elapsed time.Duration
+
+	Connected   int // Clients connected at the time of the report
+	Connections int // Connections which completed CLIENT_HELLO
+	Failed      int // Connections which could not connect or complete CLIENT_HELLO
+	Lost        int // Connections closed by the server without a CLIENT_EJECT
+	Disconnects int // Clients which disconnected as a step of their behaviour
+	Ejections   map[uint16]int
+
+	Hello     Latency // From connecting to CLIENT_HELLO_RESP
+	Interests Latency // From CLIENT_ADD_INTEREST to CLIENT_DONE_INTEREST_RESP
+	Timeouts  int     // Interests which were not done within the interest timeout
+
+	ObjectsEntered int
+	ObjectsLeft    int
+	FieldsSent     int
+	FieldsReceived int
+	Heartbeats     int
+}
+
+func (s *stats) report(elapsed time.Duration) Report {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := Report{
+		Elapsed:        elapsed,
+		Connected:      int(atomic.LoadInt64(&s.connected)),
+		Connections:    int(atomic.LoadInt64(&s.connections)),
+		Failed:         int(atomic.LoadInt64(&s.failed)),
+		Lost:           int(atomic.LoadInt64(&s.lost)),
+		Disconnects:    int(atomic.LoadInt64(&s.disconnects)),
+		Ejections:      make(map[uint16]int),
+		Hello:          summarize(s.hello),
+		Interests:      summarize(s.interests),
+		Timeouts:       int(atomic.LoadInt64(&s.timeouts)),
+		ObjectsEntered: int(atomic.LoadInt64(&s.objectsEntered)),
+		ObjectsLeft:    int(atomic.LoadInt64(&s.objectsLeft)),
+		FieldsSent:     int(atomic.LoadInt64(&s.fieldsSent)),
+		FieldsReceived: int(atomic.LoadInt64(&s.fieldsReceived)),
+		Heartbeats:     int(atomic.LoadInt64(&s.heartbeats)),
+	}
+	for reason, count := range s.ejections {
+		r.Ejections[reason] = count
+	}
+
+	return r
+}
+
+// Rate returns the number of events per second over the elapsed time of the report.
+func (r Report) Rate(count int) float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(count) / r.Elapsed.Seconds()
+}
+
+func (r Report) String() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "Elapsed:          %s\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(buf, "Clients:          %d connected; %d connection(s), %d failed, %d lost, %d disconnected\n",
+		r.Connected, r.Connections, r.Failed, r.Lost, r.Disconnects)
+
+	if len(r.Ejections) != 0 {
+		var reasons []int
+		for reason := range r.Ejections {
+			reasons = append(reasons, int(reason))
+		}
+		sort.Ints(reasons)
+
+		fmt.Fprintf(buf, "Ejections:        ")
+		for n, reason := range reasons {
+			if n > 0 {
+				fmt.Fprintf(buf, ", ")
+			}
+			fmt.Fprintf(buf, "%d x reason %d", r.Ejections[uint16(reason)], reason)
+		}
+		fmt.Fprintln(buf)
+	}
+
+	fmt.Fprintf(buf, "Hello latency:    %s\n", r.Hello)
+	fmt.Fprintf(buf, "Interest latency: %s\n", r.Interests)
+	fmt.Fprintf(buf, "Timeouts:         %d\n", r.Timeouts)
+	fmt.Fprintf(buf, "Objects entered:  %d (%.1f/s), left: %d\n", r.ObjectsEntered, r.Rate(r.ObjectsEntered), r.ObjectsLeft)
+	fmt.Fprintf(buf, "Fields:           %d sent (%.1f/s), %d received (%.1f/s)\n",
+		r.FieldsSent, r.Rate(r.FieldsSent), r.FieldsReceived, r.Rate(r.FieldsReceived))
+	fmt.Fprintf(buf, "Heartbeats:       %d\n", r.Heartbeats)
+	return buf.String()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Tools which are run as `astron COMMAND [args]...` instead of starting the daemon. Each returns the
+//  status which the process exits with.
+var commands = map[string]func(args []string) int{
+	"dc":       dcCommand,
+	"dissect":  dissectCommand,
+	"events":   eventsCommand,
+	"loadtest": loadtestCommand,
+	"replay":   replayCommand,
+}
+
+// runCommand runs the command named by the first argument, if there is one.
+func runCommand() {
+	if len(os.Args) < 2 {
+		return
+	}
+
+	if command, ok := commands[os.Args[1]]; ok {
+		os.Exit(command(os.Args[2:]))
+	}
+}
+
+func commandError(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	return 1
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"astrongo/core"
+	"astrongo/dclass/dc"
+	"astrongo/dclass/parse"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/spf13/pflag"
+	"io/ioutil"
+	"os"
+)
+
+const dcUsage = `Usage:    astron dc COMMAND [options]... [FILE]...
+
+      Tools for working with DC files. When several files are given, they
+      are read in order and may use the types declared by earlier ones.
+
+      fmt             Rewrite the files in their canonical form. Comments
+                        are not preserved.
+        -c, --check   List the files which are not formatted instead of
+                        rewriting them, and exit with status 1 if any are found.
+
+      compat          Compare two revisions of a set of DC files, listing
+                        each change as wire-compatible, db-compatible or
+                        breaking. Exits with status 2 if a change is less
+                        compatible than required.
+        --old         The DC files of the running revision.
+        --new         The DC files of the revision to be deployed.
+        --require     The least compatibility which is accepted: wire, db
+                        or breaking (default db).
+
+      gen-go          Generate a Go package with a typed value for each
+                        field of each class, which packs and unpacks itself
+                        with util.Datagram.
+        -p, --package The name of the generated package (default dclass).
+        -o, --output  The file to write to instead of standard output.
+`
+
+func dcCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Print(dcUsage)
+		return 1
+	}
+
+	switch args[0] {
+	case "fmt":
+		return dcFmt(args[1:])
+	case "compat":
+		return dcCompat(args[1:])
+	case "gen-go":
+		return dcGenGo(args[1:])
+	default:
+		fmt.Print(dcUsage)
+		return 1
+	}
+}
+
+// formatDCFiles parses and traverses DC files into a single file, writing out each one in its
+//  canonical form once it has been traversed.
+func formatDCFiles(files []string) (file *dc.File, formatted [][]byte, err error) {
+	file = dc.NewFile()
+	for _, filename := range files {
+		dctree, err := parse.ParseFile(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		mark := file.GetNumDeclarations()
+		if errs := dctree.TraverseInto(file); len(errs) != 0 {
+			return nil, nil, errs
+		}
+
+		var out bytes.Buffer
+		if err := file.WriteFrom(&out, mark); err != nil {
+			return nil, nil, err
+		}
+		formatted = append(formatted, out.Bytes())
+	}
+
+	return file, formatted, nil
+}
+
+// verifyFormat checks that the formatted files produce the same hash as the original ones.
+func verifyFormat(file *dc.File, formatted [][]byte) error {
+	reparsed := dc.NewFile()
+	for _, data := range formatted {
+		dctree, err := parse.ParseString(string(data))
+		if err != nil {
+			return err
+		}
+
+		if errs := dctree.TraverseInto(reparsed); len(errs) != 0 {
+			return errs
+		}
+	}
+
+	if hash, reformattedHash := core.ComputeHash(file), core.ComputeHash(reparsed); hash != reformattedHash {
+		return errors.New(fmt.Sprintf("formatting changed the DC hash from 0x%x to 0x%x", hash, reformattedHash))
+	}
+
+	return nil
+}
+
+func dcFmt(args []string) int {
+	flags := pflag.NewFlagSet("dc fmt", pflag.ContinueOnError)
+	check := flags.BoolP("check", "c", false, "List unformatted files instead of rewriting them.")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		fmt.Print(dcUsage)
+		return 1
+	}
+
+	files := flags.Args()
+	file, formatted, err := formatDCFiles(files)
+	if err != nil {
+		return commandError("%s", err)
+	}
+
+	// Nothing is rewritten unless the formatted files are known to be equivalent
+	if err := verifyFormat(file, formatted); err != nil {
+		return commandError("%s", err)
+	}
+
+	status := 0
+	for n, filename := range files {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return commandError("%s", err)
+		}
+
+		if bytes.Equal(data, formatted[n]) {
+			continue
+		}
+
+		if *check {
+			fmt.Println(filename)
+			status = 1
+			continue
+		}
+
+		info, err := os.Stat(filename)
+		if err != nil {
+			return commandError("%s", err)
+		}
+
+		if err := ioutil.WriteFile(filename, formatted[n], info.Mode()); err != nil {
+			return commandError("%s", err)
+		}
+	}
+
+	return status
+}
+
+var compatibilityLevels = map[string]dc.Compatibility{
+	"wire":     dc.WIRE_COMPATIBLE,
+	"db":       dc.DB_COMPATIBLE,
+	"breaking": dc.BREAKING,
+}
+
+func dcCompat(args []string) int {
+	flags := pflag.NewFlagSet("dc compat", pflag.ContinueOnError)
+	oldFiles := flags.StringSlice("old", nil, "The DC files of the running revision.")
+	newFiles := flags.StringSlice("new", nil, "The DC files of the revision to be deployed.")
+	require := flags.String("require", "db", "The least compatibility which is accepted.")
+	if err := flags.Parse(args); err != nil || len(*oldFiles) == 0 || len(*newFiles) == 0 {
+		fmt.Print(dcUsage)
+		return 1
+	}
+
+	required, ok := compatibilityLevels[*require]
+	if !ok {
+		return commandError("Unknown compatibility \"%s\"; expected wire, db or breaking.", *require)
+	}
+
+	before, err := core.ReadDC(*oldFiles)
+	if err != nil {
+		return commandError("%s", err)
+	}
+
+	after, err := core.ReadDC(*newFiles)
+	if err != nil {
+		return commandError("%s", err)
+	}
+
+	changes := dc.Diff(before, after)
+	for _, change := range changes {
+		fmt.Printf("%-16s %s\n", change.Compatibility, change)
+	}
+
+	hash, newHash := core.ComputeHash(before), core.ComputeHash(after)
+	if hash != newHash {
+		fmt.Printf("The DC hash changes from 0x%x to 0x%x; clients which are not updated will be "+
+			"disconnected with CLIENT_DISCONNECT_BAD_DCHASH.\n", hash, newHash)
+	}
+
+	overall := dc.Overall(changes)
+	fmt.Printf("%d change(s); the new revision is %s.\n", len(changes), overall)
+	if overall > required {
+		return 2
+	}
+
+	return 0
+}
+
+func dcGenGo(args []string) int {
+	flags := pflag.NewFlagSet("dc gen-go", pflag.ContinueOnError)
+	pkg := flags.StringP("package", "p", "dclass", "The name of the generated package.")
+	output := flags.StringP("output", "o", "", "The file to write to instead of standard output.")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		fmt.Print(dcUsage)
+		return 1
+	}
+
+	file, err := core.ReadDC(flags.Args())
+	if err != nil {
+		return commandError("%s", err)
+	}
+
+	var out bytes.Buffer
+	if err := file.WriteGo(&out, *pkg); err != nil {
+		return commandError("%s", err)
+	}
+
+	if *output == "" {
+		os.Stdout.Write(out.Bytes())
+		return 0
+	}
+
+	if err := ioutil.WriteFile(*output, out.Bytes(), 0644); err != nil {
+		return commandError("%s", err)
+	}
+
+	return 0
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"astrongo/core"
+	"astrongo/dclass/dc"
+	"astrongo/dissect"
+	"astrongo/messagedirector"
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"github.com/spf13/pflag"
+	"io"
+	"os"
+	"strings"
+)
+
+const dissectUsage = `Usage:    astron dissect [options]... [HEX]...
+
+      Decode datagrams, printing their recipients, sender and message type,
+      and the values of the fields they carry. Each argument is a datagram
+      written in hexadecimal; without arguments, one datagram is read from
+      each line of standard input.
+
+      --dc            A DC file to decode fields with; may be repeated.
+                        Without one, fields are left undecoded.
+      --client        The datagrams were sent between a client and a client
+                        agent, rather than routed by the MD.
+      --capture       Decode the datagrams of a capture file, as written by
+                        an MD with messagedirector.capture set.
+`
+
+func dissectCommand(args []string) int {
+	flags := pflag.NewFlagSet("dissect", pflag.ContinueOnError)
+	dcFiles := flags.StringSlice("dc", nil, "A DC file to decode fields with.")
+	client := flags.Bool("client", false, "The datagrams are client datagrams.")
+	capture := flags.String("capture", "", "Decode the datagrams of a capture file.")
+	if err := flags.Parse(args); err != nil || (*capture != "" && (flags.NArg() != 0 || *client)) {
+		fmt.Print(dissectUsage)
+		return 1
+	}
+
+	var file *dc.File
+	if len(*dcFiles) != 0 {
+		var err error
+		if file, err = core.ReadDC(*dcFiles); err != nil {
+			return commandError("%s", err)
+		}
+	}
+
+	decode := dissect.Dissect
+	if *client {
+		decode = dissect.DissectClient
+	}
+
+	if *capture != "" {
+		return dissectCapture(file, *capture)
+	}
+
+	status := 0
+	printDatagram := func(n int, str string) {
+		data, err := hex.DecodeString(strings.Join(strings.Fields(str), ""))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "datagram %d: %s\n", n, err)
+			status = 1
+			return
+		}
+
+		if n > 1 {
+			fmt.Println()
+		}
+		fmt.Print(decode(file, data))
+	}
+
+	if flags.NArg() != 0 {
+		for n, arg := range flags.Args() {
+			printDatagram(n+1, arg)
+		}
+		return status
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(nil, 1<<24)
+	for n := 1; scanner.Scan(); {
+		if strings.TrimSpace(scanner.Text()) != "" {
+			printDatagram(n, scanner.Text())
+			n++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return commandError("%s", err)
+	}
+
+	return status
+}
+
+// dissectCapture prints every record of a capture file, headed by the time it was routed and the
+//  participant which sent it.
+func dissectCapture(file *dc.File, path string) int {
+	in, err := os.Open(path)
+	if err != nil {
+		return commandError("%s", err)
+	}
+	defer in.Close()
+
+	capture, err := messagedirector.NewCaptureReader(bufio.NewReader(in))
+	if err != nil {
+		return commandError("%s: %s", path, err)
+	}
+
+	for n := 0; ; n++ {
+		record, err := capture.Next()
+		if err == io.EOF {
+			return 0
+		} else if err != nil {
+			return commandError("%s: %s", path, err)
+		}
+
+		if n > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("#%d  %s  from %s\n", n+1, record.Time.Format("2006-01-02 15:04:05.000000"), record.Sender)
+		fmt.Print(dissect.Dissect(file, record.Datagram.Bytes()))
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"astrongo/eventlogger"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/pflag"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const eventsUsage = `Usage:    astron events [options]... [FILE|DIR]...
+
+      Print the events of event logs, oldest first. Logs which were
+      compressed by rotation are read as well. Directories are searched
+      for the logs written with the output format; without arguments,
+      the current directory is searched.
+
+      --since         Only print events logged at or after this time.
+      --until         Only print events logged before this time. Times are
+                        given as 2006-01-02, 2006-01-02 15:04:05, RFC 3339
+                        or as a duration before now, such as 90m.
+      -t, --type      Only print events of this type; may be repeated.
+      -s, --sender    Only print events whose sender matches a pattern,
+                        such as "Client: *".
+      -d, --doid      Only print events about this object or avatar.
+      -a, --address   Only print events of this remote address or host.
+      -f, --follow    Keep printing events as they are added to the newest
+                        log, until interrupted.
+      --json          Print the events as lines of JSON instead of a table.
+      --output        The output format the logs were written with, as set
+                        by eventlogger.output in the configuration.
+`
+
+// How often a followed log is checked for new events.
+const followInterval = 250 * time.Millisecond
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+func eventsCommand(args []string) int {
+	flags := pflag.NewFlagSet("events", pflag.ContinueOnError)
+	since := flags.String("since", "", "Only print events logged at or after this time.")
+	until := flags.String("until", "", "Only print events logged before this time.")
+	types := flags.StringSliceP("type", "t", nil, "Only print events of this type.")
+	sender := flags.StringP("sender", "s", "", "Only print events whose sender matches a pattern.")
+	doid := flags.Uint64P("doid", "d", 0, "Only print events about this object or avatar.")
+	address := flags.StringP("address", "a", "", "Only print events of this remote address or host.")
+	follow := flags.BoolP("follow", "f", false, "Keep printing events as they are logged.")
+	asJSON := flags.Bool("json", false, "Print the events as lines of JSON.")
+	output := flags.String("output", eventlogger.DEFAULT_OUTPUT, "The output format the logs were written with.")
+	if err := flags.Parse(args); err != nil {
+		fmt.Print(eventsUsage)
+		return 1
+	}
+
+	filter := eventlogger.Filter{Types: *types, Sender: *sender, Doid: *doid, Address: *address}
+	var err error
+	if filter.Since, err = parseEventTime(*since); err != nil {
+		return commandError("--since: %s", err)
+	}
+	if filter.Until, err = parseEventTime(*until); err != nil {
+		return commandError("--until: %s", err)
+	}
+
+	files, latest, err := eventFiles(flags.Args(), *output)
+	if err != nil {
+		return commandError("%s", err)
+	}
+	if len(files) == 0 && !*follow {
+		return commandError("No event logs found.")
+	}
+
+	printer := &eventPrinter{filter: filter, json: *asJSON}
+	for n, path := range files {
+		if *follow && n == len(files)-1 {
+			break
+		}
+
+		if err := printer.printLog(path); err != nil {
+			return commandError("%s", err)
+		}
+	}
+
+	if *follow {
+		if err := printer.follow(latest); err != nil {
+			return commandError("%s", err)
+		}
+	}
+
+	return 0
+}
+
+// parseEventTime reads a time given on the command line, either as a point in time or as a duration
+//  before now. An empty string gives the zero time.
+func parseEventTime(str string) (time.Time, error) {
+	if str == "" {
+		return time.Time{}, nil
+	}
+
+	if ago, err := time.ParseDuration(str); err == nil {
+		return time.Now().Add(-ago), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, str, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New(fmt.Sprintf("cannot parse time \"%s\"", str))
+}
+
+// eventFiles lists the logs named on the command line, expanding directories into the logs they
+//  contain. It also returns a function which finds the log to follow: the newest log of the last
+//  directory, or the last file.
+func eventFiles(args []string, output string) ([]string, func() (string, error), error) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+
+		logs, err := eventlogger.LogFiles(arg, output)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, logs...)
+	}
+
+	last := args[len(args)-1]
+	latest := func() (string, error) { return last, nil }
+	if info, _ := os.Stat(last); info != nil && info.IsDir() {
+		latest = func() (string, error) {
+			logs, err := eventlogger.LogFiles(last, output)
+			if err != nil || len(logs) == 0 {
+				return "", err
+			}
+			return logs[len(logs)-1], nil
+		}
+	}
+
+	return files, latest, nil
+}
+
+type eventPrinter struct {
+	filter  eventlogger.Filter
+	json    bool
+	printed bool
+}
+
+func (p *eventPrinter) printLog(path string) error {
+	file, err := eventlogger.OpenLog(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := &lineReader{reader: bufio.NewReader(file), path: path}
+	for {
+		line, ok := reader.next(true)
+		if !ok {
+			return reader.err
+		}
+		p.printLine(reader, line)
+	}
+}
+
+// follow prints the events of the newest log as they are written. When the log is rotated, the rest
+//  of the closed log is printed before moving on to the new one.
+func (p *eventPrinter) follow(latest func() (string, error)) error {
+	var file *os.File
+	var reader *lineReader
+	for {
+		path, err := latest()
+		if err != nil {
+			return err
+		}
+
+		if reader != nil {
+			for {
+				line, ok := reader.next(false)
+				if !ok {
+					break
+				}
+				p.printLine(reader, line)
+			}
+			if reader.err != nil {
+				return reader.err
+			}
+		}
+
+		if path != "" && !sameFile(file, path) {
+			opened, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+
+			if file != nil {
+				file.Close()
+			}
+			file, reader = opened, &lineReader{reader: bufio.NewReader(opened), path: path}
+			continue
+		}
+
+		time.Sleep(followInterval)
+	}
+}
+
+// sameFile checks whether an open file is still the one found at a path.
+func sameFile(file *os.File, path string) bool {
+	if file == nil {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		// The log was moved away and its replacement is not there yet
+		return true
+	}
+
+	opened, err := file.Stat()
+	return err == nil && os.SameFile(info, opened)
+}
+
+func (p *eventPrinter) printLine(reader *lineReader, line []byte) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+
+	event, err := eventlogger.DecodeEvent(line)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s:%d: %s\n", reader.path, reader.line, err)
+		return
+	}
+
+	if !p.filter.Match(event) {
+		return
+	}
+
+	if p.json {
+		fmt.Printf("%s\n", event.Line)
+		return
+	}
+
+	if !p.printed {
+		fmt.Printf("%-24s  %-24s  %-20s  %s\n", "TIME", "TYPE", "SENDER", "DETAILS")
+		p.printed = true
+	}
+
+	logged, _ := event.Keys["_time"].(string)
+	fmt.Printf("%-24s  %-24s  %-20s  %s\n", logged, event.Type(), event.Sender(), eventDetails(event))
+}
+
+// eventDetails lists the keys of an event which have no column of their own, in alphabetical order.
+func eventDetails(event eventlogger.Event) string {
+	var keys []string
+	for key := range event.Keys {
+		if key != "_time" && key != "type" && key != "sender" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	details := make([]string, len(keys))
+	for n, key := range keys {
+		var value string
+		switch v := event.Keys[key].(type) {
+		case string:
+			value = v
+			if strings.ContainsAny(v, " \t\"=") {
+				value = fmt.Sprintf("%q", v)
+			}
+		case json.Number:
+			value = v.String()
+		default:
+			data, _ := json.Marshal(v)
+			value = string(data)
+		}
+		details[n] = key + "=" + value
+	}
+
+	return strings.Join(details, " ")
+}
+
+// lineReader reads the lines of a log which may still be written to. A line is only returned once
+//  it is complete, unless the end of the log is known to be final.
+type lineReader struct {
+	reader  *bufio.Reader
+	path    string
+	line    int
+	pending []byte
+	err     error
+}
+
+func (r *lineReader) next(final bool) ([]byte, bool) {
+	data, err := r.reader.ReadBytes('\n')
+	r.pending = append(r.pending, data...)
+	if err != nil {
+		if err != io.EOF {
+			r.err = err
+			return nil, false
+		}
+
+		if !final || len(r.pending) == 0 {
+			return nil, false
+		}
+	}
+
+	line := r.pending
+	r.pending = nil
+	r.line++
+	return line, true
+}
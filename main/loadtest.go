@@ -0,0 +1,92 @@
+package main
+
+import (
+	"astrongo/loadtest"
+	"fmt"
+	"github.com/spf13/pflag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const loadtestUsage = `Usage:    astron loadtest [options]... SCRIPT
+
+      Simulate many clients connecting to a client agent, each following
+      one of the behaviours of a YAML script, and report the latency of
+      CLIENT_HELLO and of interests, and the rate at which objects enter.
+      Interrupting the test stops it early and prints the report so far.
+
+      --address       The address of the client agent, overriding the script.
+      --clients       The number of clients, overriding the script.
+      --duration      How long to run for, overriding the script; 0 runs
+                        until interrupted.
+      --interval      How often to print progress (default 5s); 0 only
+                        prints the final report.
+`
+
+func loadtestCommand(args []string) int {
+	flags := pflag.NewFlagSet("loadtest", pflag.ContinueOnError)
+	address := flags.String("address", "", "The address of the client agent.")
+	clients := flags.Int("clients", 0, "The number of clients.")
+	duration := flags.Duration("duration", 0, "How long to run for.")
+	interval := flags.Duration("interval", 5*time.Second, "How often to print progress.")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 || *interval < 0 {
+		fmt.Print(loadtestUsage)
+		return 1
+	}
+
+	script, err := loadtest.LoadScript(flags.Arg(0))
+	if err != nil {
+		return commandError("%s", err)
+	}
+
+	if *address != "" {
+		script.Address = *address
+	}
+	if *clients != 0 {
+		script.Clients = *clients
+	}
+	if flags.Changed("duration") {
+		script.Duration = *duration
+	}
+
+	test, err := loadtest.New(*script)
+	if err != nil {
+		return commandError("%s", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		var ticker <-chan time.Time
+		if *interval > 0 {
+			t := time.NewTicker(*interval)
+			defer t.Stop()
+			ticker = t.C
+		}
+
+		for {
+			select {
+			case <-ticker:
+				r := test.Report()
+				fmt.Printf("[%s] %d connected, %d interest(s) done (p50 %s), %d object(s) entered, %d field(s) sent\n",
+					r.Elapsed.Round(time.Second), r.Connected, r.Interests.Count, r.Interests.P50.Round(time.Microsecond),
+					r.ObjectsEntered, r.FieldsSent)
+			case <-signals:
+				test.Stop()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	fmt.Printf("Running %d client(s) against %s.\n", script.Clients, script.Address)
+	report := test.Run()
+	fmt.Print("\n", report)
+	return 0
+}
@@ -3,10 +3,11 @@ package main
 import (
 	"astrongo/clientagent"
 	"astrongo/core"
-	"astrongo/dclass/dc"
+	"astrongo/dclass/parse"
 	"astrongo/eventlogger"
 	"astrongo/messagedirector"
-	"astrongo/util"
+	"astrongo/metrics"
+	"astrongo/stateserver"
 	"fmt"
 	"github.com/apex/log"
 	"github.com/spf13/pflag"
@@ -15,10 +16,22 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 )
 
+// Default amount of time the daemon is given to drain before it is forcefully terminated.
+const SHUTDOWN_TIMEOUT = 10
+
+const SHUTDOWN_REASON = "The server is shutting down for maintenance."
+
 var mainLog *log.Entry
 
+var clientAgents = make(map[string]*clientagent.ClientAgent)
+var stateServers = make(map[string]*stateserver.StateServer)
+
+var loglevelChoices = map[string]log.Level{"info": log.InfoLevel, "warning": log.WarnLevel, "error": log.ErrorLevel, "fatal": log.FatalLevel, "debug": log.DebugLevel}
+
 func init() {
 	log.SetHandler(core.Log)
 	log.SetLevel(log.DebugLevel)
@@ -28,9 +41,12 @@ func init() {
 }
 
 func main() {
+	runCommand()
+
 	pflag.Usage = func() {
 		fmt.Printf(
 			`Usage:    astron [options]... [CONFIG_FILE]
+          astron COMMAND [args]...
       
       Astron is a distributed server CLI.
       By default Astron looks for a configuration file in the current
@@ -42,6 +58,18 @@ func main() {
       -L, --log       Specify a file to write log messages to.
       -l, --loglevel  Specify the minimum log level that should be logged;
                         Error and Fatal levels will always be logged.
+      --check-config  Validate the configuration file and exit.
+      --allow-dc-change  Allow a reload (SIGHUP) to replace the DC file even
+                        when its hash differs from the running one.
+
+      Commands:
+      dc fmt          Rewrite DC files in their canonical form.
+      dc compat       Check whether a new revision of the DC files is compatible.
+      dc gen-go       Generate typed Go values for the fields of DC classes.
+      dissect         Decode server or client datagrams, or a capture file.
+      events          Search, filter and follow event logs.
+      loadtest        Simulate many clients to measure a cluster under load.
+      replay          Replay a capture of routed datagrams into an MD.
 `)
 		os.Exit(1)
 	}
@@ -50,6 +78,8 @@ func main() {
 	loglevelPtr := pflag.StringP("loglevel", "l", "info", "Specify minimum log level that should be logged.")
 	versionPtr := pflag.BoolP("version", "v", false, "Show the application version.")
 	helpPtr := pflag.BoolP("help", "h", false, "Show the application usage.")
+	checkConfigPtr := pflag.Bool("check-config", false, "Validate the configuration file and exit.")
+	allowDCChange = pflag.Bool("allow-dc-change", false, "Allow incompatible DC files to be loaded on reload.")
 
 	pflag.Parse()
 
@@ -66,7 +96,6 @@ Revision: INDEV`)
 		os.Exit(1)
 	}
 	if *loglevelPtr != "" {
-		loglevelChoices := map[string]log.Level{"info": log.InfoLevel, "warning": log.WarnLevel, "error": log.ErrorLevel, "fatal": log.FatalLevel, "debug": log.DebugLevel}
 		if choice, validChoice := loglevelChoices[*loglevelPtr]; !validChoice {
 			mainLog.Fatal(fmt.Sprintf("Unknown log-level \"%s\".", *loglevelPtr))
 			pflag.Usage()
@@ -106,45 +135,151 @@ Revision: INDEV`)
 		mainLog.Fatal(err.Error())
 	}
 
+	if problems := core.ValidateConfig(core.Config); len(problems) != 0 {
+		for _, problem := range problems {
+			mainLog.Error(problem)
+		}
+		mainLog.Fatal(fmt.Sprintf("Found %d problem(s) in the configuration file.", len(problems)))
+		os.Exit(1)
+	} else if *checkConfigPtr {
+		mainLog.Info("Configuration file is valid.")
+		os.Exit(0)
+	}
+
+	// A log level given on the command line takes precedence over the configuration file
+	loglevelFromFlag = pflag.CommandLine.Changed("loglevel")
+	if !loglevelFromFlag && core.Config.Daemon.Loglevel != "" {
+		if choice, validChoice := loglevelChoices[core.Config.Daemon.Loglevel]; !validChoice {
+			mainLog.Fatal(fmt.Sprintf("Unknown log-level \"%s\".", core.Config.Daemon.Loglevel))
+		} else {
+			log.SetLevel(choice)
+		}
+	}
+
 	if err := core.LoadDC(); err != nil {
+		if errs, ok := err.(parse.ErrorList); ok {
+			for _, err := range errs {
+				mainLog.Error(err.Error())
+			}
+			mainLog.Fatal(fmt.Sprintf("Found %d problem(s) in the DC files.", len(errs)))
+		}
 		mainLog.Fatal(err.Error())
 	}
 
-	hasher := dc.NewHashGenerator()
-	core.DC.GenerateHash(hasher)
-	core.Hash = hasher.Hash()
-	mainLog.Info(fmt.Sprintf("DC hash: 0x%x", hasher.Hash()))
-	eventlogger.StartEventLogger()
+	core.Hash = core.ComputeHash(core.DC)
+	mainLog.Info(fmt.Sprintf("DC hash: 0x%x", core.Hash))
+	startEventLogger()
+	metrics.Start()
 	messagedirector.Start()
 
 	// Configure UberDOG list
-	for _, ud := range core.Config.Uberdogs {
-		class, ok := core.DC.ClassByName(ud.Class)
-		if !ok {
-			mainLog.Fatalf("For UberDOG %d, class %s does not exist!", ud.ID, ud.Class)
-			return
+	uberdogs, err := core.LoadUberdogs(core.Config, core.DC)
+	if err != nil {
+		mainLog.Fatal(err.Error())
+		return
+	}
+	core.Uberdogs = uberdogs
+
+	// Instantiate roles
+	for _, role := range core.Config.Roles {
+		startRole(role)
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	shuttingDown := false
+	for sig := range c {
+		switch {
+		case sig == syscall.SIGHUP:
+			if !shuttingDown {
+				mainLog.Info(fmt.Sprintf("Got %s signal. Reloading configuration...", sig))
+				reload()
+			}
+		case !shuttingDown:
+			mainLog.Info(fmt.Sprintf("Got %s signal. Shutting down...", sig))
+			shuttingDown = true
+			go shutdown()
+		default:
+			// A second signal skips the drain entirely
+			mainLog.Fatal(fmt.Sprintf("Got %s signal during shutdown. Aborting...", sig))
+			os.Exit(1)
 		}
+	}
+}
 
-		core.Uberdogs = append(core.Uberdogs, core.Uberdog{
-			Anonymous: ud.Anonymous,
-			Id:        util.Doid_t(ud.ID),
-			Class:     class,
-		})
+// roleKey identifies a role across configuration reloads.
+func roleKey(role core.Role) string {
+	switch role.Type {
+	case "clientagent":
+		return fmt.Sprintf("%s/%s", role.Type, role.Bind)
+	case "stateserver":
+		return fmt.Sprintf("%s/%d", role.Type, role.Control)
 	}
+	return role.Type
+}
 
-	// Instantiate roles
+// startEventLogger starts the event logger before any role, so that every event is logged. Without an
+//  eventlogger role, events are forwarded to the event logger given by general.eventlogger, or
+//  logged by this daemon when there is none.
+func startEventLogger() {
 	for _, role := range core.Config.Roles {
-		switch role.Type {
-		case "clientagent":
-			clientagent.NewClientAgent(role)
+		if role.Type == "eventlogger" {
+			eventlogger.StartEventLoggerRole(role)
+			return
+		}
+	}
+
+	if addr := core.Config.General.Eventlogger; addr != "" {
+		if err := eventlogger.StartForwarding(addr); err != nil {
+			mainLog.Fatal(fmt.Sprintf("Unable to forward events to %s: %s", addr, err))
 		}
+		return
 	}
 
-	c := make(chan os.Signal)
-	signal.Notify(c, os.Interrupt)
+	eventlogger.StartEventLogger()
+}
+
+func startRole(role core.Role) {
+	switch role.Type {
+	case "clientagent":
+		clientAgents[roleKey(role)] = clientagent.NewClientAgent(role)
+	case "stateserver":
+		stateServers[roleKey(role)] = stateserver.NewStateServer(role)
+	}
+}
+
+// shutdown stops the daemon in an orderly fashion: clients are ejected, objects are deleted and the MD
+//  is drained before the event log is flushed. If this takes longer than the configured deadline, the
+//  daemon exits regardless.
+func shutdown() {
+	timeout := core.Config.Daemon.Shutdown_Timeout
+	if timeout <= 0 {
+		timeout = SHUTDOWN_TIMEOUT
+	}
+
+	done := make(chan bool)
+	go func() {
+		for _, ca := range clientAgents {
+			if ca != nil {
+				ca.Shutdown(SHUTDOWN_REASON)
+			}
+		}
+
+		for _, ss := range stateServers {
+			ss.Shutdown()
+		}
+
+		messagedirector.MD.Shutdown()
+		eventlogger.Shutdown()
+		done <- true
+	}()
+
 	select {
-	case sig := <-c:
-		mainLog.Fatal(fmt.Sprintf("Got %s signal. Aborting...", sig))
+	case <-done:
+		mainLog.Info("Shutdown complete.")
+		os.Exit(0)
+	case <-time.After(time.Duration(timeout) * time.Second):
+		mainLog.Errorf("Failed to shut down within %d seconds; exiting anyway.", timeout)
 		os.Exit(1)
 	}
 }
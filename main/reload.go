@@ -0,0 +1,157 @@
+package main
+
+import (
+	"astrongo/core"
+	"astrongo/eventlogger"
+	"github.com/apex/log"
+)
+
+// Set by --allow-dc-change; permits a reload to swap in a DC file whose hash differs from the running one.
+var allowDCChange *bool
+
+// Set when the log level was given on the command line, in which case the configuration may not change it.
+var loglevelFromFlag bool
+
+// reload re-reads the configuration and DC files and applies every change which can be made to a
+//  running daemon. Changes which cannot be applied live are logged and otherwise ignored; they will
+//  take effect once the daemon is restarted.
+func reload() {
+	conf, err := core.ReadConfig()
+	if err != nil {
+		mainLog.Errorf("Reload aborted: %s", err)
+		return
+	}
+
+	if problems := core.ValidateConfig(conf); len(problems) != 0 {
+		for _, problem := range problems {
+			mainLog.Error(problem)
+		}
+		mainLog.Errorf("Reload aborted: found %d problem(s) in the configuration file.", len(problems))
+		return
+	}
+
+	eventlogger.ApplyDefaults(conf)
+	current := core.Current()
+	old := current.Config
+
+	// DC file
+	file, hash := current.DC, current.Hash
+	newFile, err := core.ReadDC(conf.General.DC_Files)
+	if err != nil {
+		mainLog.Errorf("Reload aborted: %s", err)
+		return
+	}
+
+	newHash := core.ComputeHash(newFile)
+	switch {
+	case newHash == current.Hash:
+		file = newFile
+	case *allowDCChange:
+		mainLog.Warnf("DC hash changed from 0x%x to 0x%x; existing objects keep their old definitions.", current.Hash, newHash)
+		file, hash = newFile, newHash
+	default:
+		mainLog.Errorf("Refusing to load DC files with hash 0x%x (running 0x%x); "+
+			"restart the daemon or pass --allow-dc-change to replace them.", newHash, current.Hash)
+		conf.General.DC_Files = old.General.DC_Files
+	}
+
+	uberdogs, err := core.LoadUberdogs(conf, file)
+	if err != nil {
+		mainLog.Errorf("Reload aborted: %s", err)
+		return
+	}
+
+	// Log level
+	if conf.Daemon.Loglevel != old.Daemon.Loglevel && !loglevelFromFlag {
+		if choice, ok := loglevelChoices[conf.Daemon.Loglevel]; ok {
+			log.SetLevel(choice)
+			mainLog.Infof("Log level set to %s", conf.Daemon.Loglevel)
+		} else if conf.Daemon.Loglevel != "" {
+			mainLog.Errorf("Unknown log-level \"%s\"; keeping the current level.", conf.Daemon.Loglevel)
+			conf.Daemon.Loglevel = old.Daemon.Loglevel
+		}
+	}
+
+	// Settings bound to sockets cannot change without a restart
+	refuse := func(setting string, changed bool) {
+		if changed {
+			mainLog.Errorf("Cannot change %s while the daemon is running; restart to apply it.", setting)
+		}
+	}
+	refuse("messagedirector", conf.MessageDirector != old.MessageDirector)
+	refuse("eventlogger bind", conf.Eventlogger.Bind != old.Eventlogger.Bind)
+	refuse("general.eventlogger", conf.General.Eventlogger != old.General.Eventlogger)
+	refuse("metrics bind", conf.Metrics != old.Metrics)
+	conf.MessageDirector = old.MessageDirector
+	conf.Eventlogger.Bind = old.Eventlogger.Bind
+	conf.General.Eventlogger = old.General.Eventlogger
+	conf.Metrics = old.Metrics
+
+	conf.Roles = reloadRoles(old.Roles, conf.Roles)
+
+	core.Publish(core.State{Config: conf, DC: file, Hash: hash, Uberdogs: uberdogs})
+
+	// The event log is rotated and its sinks reopened on every reload, which applies any changes to them
+	eventlogger.Rotate("reload")
+	eventlogger.OpenSinks()
+
+	mainLog.Info("Configuration reloaded.")
+}
+
+// reloadRoles starts roles which were added to the configuration and reconfigures the ones which
+//  were changed in a safe manner. It returns the roles which are running afterwards.
+func reloadRoles(running []core.Role, roles []core.Role) []core.Role {
+	current := make(map[string]core.Role)
+	for _, role := range running {
+		current[roleKey(role)] = role
+	}
+
+	var started []core.Role
+	seen := make(map[string]bool)
+	for _, role := range roles {
+		key := roleKey(role)
+		seen[key] = true
+
+		old, ok := current[key]
+		if !ok && role.Type == "eventlogger" {
+			mainLog.Errorf("Cannot add role %s while the daemon is running; restart to apply it.", key)
+			continue
+		}
+		if !ok {
+			mainLog.Infof("Starting new %s role", role.Type)
+			startRole(role)
+			started = append(started, role)
+			continue
+		}
+
+		if role == old {
+			continue
+		}
+
+		// Client settings and tuning only affect new connections
+		if role.Type == "clientagent" {
+			safe := old
+			safe.Version, safe.Client, safe.Tuning = role.Version, role.Client, role.Tuning
+			if role == safe {
+				if ca := clientAgents[key]; ca != nil {
+					ca.Reconfigure(role)
+				}
+				current[key] = role
+				continue
+			}
+		}
+
+		mainLog.Errorf("Cannot change the configuration of running role %s; restart to apply it.", key)
+	}
+
+	var result []core.Role
+	for _, role := range running {
+		key := roleKey(role)
+		if !seen[key] {
+			mainLog.Errorf("Cannot remove running role %s; restart to apply it.", key)
+		}
+		result = append(result, current[key])
+	}
+
+	return append(result, started...)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"astrongo/core"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const reloadDC = `
+dclass Avatar {
+	setName(string name) required broadcast;
+};
+`
+
+const reloadConfig = `
+general:
+  dc_files: [%s]
+uberdogs: %s
+`
+
+func writeReloadFiles(t *testing.T, dir string, dc string, uberdogs string) {
+	dcPath := filepath.Join(dir, "reload.dc")
+	require.NoError(t, ioutil.WriteFile(dcPath, []byte(dc), 0644))
+	conf := []byte(fmt.Sprintf(reloadConfig, dcPath, uberdogs))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "astrond.yml"), conf, 0644))
+}
+
+func TestReload(t *testing.T) {
+	log.SetHandler(log.HandlerFunc(func(*log.Entry) error { return nil }))
+
+	dir, err := ioutil.TempDir("", "reload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeReloadFiles(t, dir, reloadDC, "[]")
+	require.NoError(t, core.LoadConfig(dir, "astrond"))
+	require.NoError(t, core.LoadDC())
+	oldHash := core.ComputeHash(core.DC)
+	core.Publish(core.State{Config: core.Config, DC: core.DC, Hash: oldHash})
+
+	// The new revision adds a class, along with an UberDOG of it
+	newDC := reloadDC + "\ndclass Manager {\n\trequestAvatar(uint32 id) clsend;\n};\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "new.dc"), []byte(newDC), 0644))
+	newFile, err := core.ReadDC([]string{filepath.Join(dir, "new.dc")})
+	require.NoError(t, err)
+	newHash := core.ComputeHash(newFile)
+	require.NotEqual(t, oldHash, newHash)
+
+	allow := false
+	allowDCChange = &allow
+
+	// Without --allow-dc-change, the running DC file is kept
+	writeReloadFiles(t, dir, newDC, "[{id: 4665, class: Manager}]")
+	reload()
+	require.Equal(t, oldHash, core.Current().Hash)
+	_, ok := core.Current().DC.ClassByName("Manager")
+	require.False(t, ok)
+
+	// Roles reading the state while it is reloaded see the configuration, DC file and UberDOGs of one
+	//  reload together
+	stop := make(chan bool)
+	var readers sync.WaitGroup
+	for n := 0; n < 4; n++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				state := core.Current()
+				_, hasManager := state.DC.ClassByName("Manager")
+				if hasManager {
+					assert.Equal(t, newHash, state.Hash)
+					assert.Len(t, state.Uberdogs, 1)
+				} else {
+					assert.Equal(t, oldHash, state.Hash)
+					assert.Empty(t, state.Uberdogs)
+				}
+			}
+		}()
+	}
+
+	allow = true
+	reload()
+	close(stop)
+	readers.Wait()
+
+	state := core.Current()
+	require.Equal(t, newHash, state.Hash)
+	require.Len(t, state.Uberdogs, 1)
+	require.Equal(t, "Manager", state.Uberdogs[0].Class.Name())
+	require.Equal(t, []string{filepath.Join(dir, "reload.dc")}, state.Config.General.DC_Files)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"astrongo/messagedirector"
+	"astrongo/test"
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/spf13/pflag"
+	"io"
+	"os"
+	"time"
+)
+
+const replayUsage = `Usage:    astron replay [options]... CAPTURE_FILE
+
+      Replay a capture file, as written by an MD with messagedirector.capture
+      set, into a running MD. Each participant of the capture is replayed
+      by a connection of its own, named after it.
+
+      --md            The address of the MD (default 127.0.0.1:7199).
+      --speed         How much faster than recorded to replay; 0 replays
+                        every datagram as fast as possible (default 1).
+`
+
+func replayCommand(args []string) int {
+	flags := pflag.NewFlagSet("replay", pflag.ContinueOnError)
+	addr := flags.String("md", "127.0.0.1:7199", "The address of the MD.")
+	speed := flags.Float64("speed", 1, "How much faster than recorded to replay.")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 || *speed < 0 {
+		fmt.Print(replayUsage)
+		return 1
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return commandError("%s", err)
+	}
+	defer file.Close()
+
+	capture, err := messagedirector.NewCaptureReader(bufio.NewReader(file))
+	if err != nil {
+		return commandError("%s: %s", flags.Arg(0), err)
+	}
+
+	connections := make(map[string]*test.TestMDConnection)
+	defer func() {
+		for _, conn := range connections {
+			conn.Close()
+		}
+	}()
+
+	var first time.Time
+	start := time.Now()
+	count := 0
+	for {
+		record, err := capture.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return commandError("%s: %s", flags.Arg(0), err)
+		}
+
+		conn, ok := connections[record.Sender]
+		if !ok {
+			if conn, err = connectReplay(*addr, record.Sender); err != nil {
+				return commandError("%s", err)
+			}
+			connections[record.Sender] = conn
+		}
+
+		// Datagrams are sent when they were routed, relative to the first one of the capture
+		if count == 0 {
+			first = record.Time
+		} else if *speed > 0 {
+			due := start.Add(time.Duration(float64(record.Time.Sub(first)) / *speed))
+			time.Sleep(time.Until(due))
+		}
+
+		conn.SendDatagram(record.Datagram)
+		count++
+	}
+
+	fmt.Printf("Replayed %d datagram(s) from %d participant(s) in %s.\n",
+		count, len(connections), time.Since(start).Round(time.Millisecond))
+	return 0
+}
+
+// connectReplay connects to the MD on behalf of a participant of the capture.
+func connectReplay(addr string, name string) (conn *test.TestMDConnection, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprint(r))
+		}
+	}()
+
+	conn = (&test.TestMDConnection{}).Connect(addr, name)
+	if name != "" {
+		conn.SendDatagram(*(&test.TestDatagram{}).CreateSetConName(name))
+	}
+	return conn, nil
+}
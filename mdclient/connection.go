@@ -0,0 +1,433 @@
+package mdclient
+
+import (
+	"astrongo/core"
+	"astrongo/dclass/dc"
+	. "astrongo/util"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	"io"
+	gonet "net"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_RECONNECT_DELAY = 2 * time.Second
+	DEFAULT_TIMEOUT         = 5 * time.Second
+
+	// Datagrams from the message director larger than this end the connection.
+	MAX_DATAGRAM_SIZE = 1 << 24
+)
+
+var (
+	ErrClosed       = errors.New("connection closed")
+	ErrDisconnected = errors.New("not connected to the message director")
+	ErrTimeout      = errors.New("no response from the state server")
+)
+
+// Handler receives the datagrams routed to a connection which are not responses to its requests.
+//  The iterator is positioned at the start of the datagram, as for an MDParticipant.
+type Handler interface {
+	HandleDatagram(dg Datagram, dgi *DatagramIterator)
+}
+
+type HandlerFunc func(dg Datagram, dgi *DatagramIterator)
+
+func (f HandlerFunc) HandleDatagram(dg Datagram, dgi *DatagramIterator) { f(dg, dgi) }
+
+type Config struct {
+	Address string
+	Name    string // Sent with CONTROL_SET_CON_NAME, for the logs of the message director
+	URL     string // Sent with CONTROL_SET_CON_URL
+
+	// Channel is subscribed to when connecting and is the sender of every request; responses to
+	//  GetField, GetAll and GetLocation are routed to it.
+	Channel Channel_t
+
+	// DC describes the objects handled by GetAll and CreateObject; the DC file of the daemon is used
+	//  if it is nil.
+	DC *dc.File
+
+	// Handler is called in order, on the goroutine reading from the message director, so it must not
+	//  wait on a request of the same connection. It may be nil.
+	Handler Handler
+
+	// Reconnect is the delay between attempts to reconnect once the connection is lost; it defaults
+	//  to DEFAULT_RECONNECT_DELAY, and a negative delay disables reconnecting.
+	Reconnect time.Duration
+
+	// Timeout bounds how long requests wait for a response, and defaults to DEFAULT_TIMEOUT.
+	Timeout time.Duration
+}
+
+type channelRange struct {
+	min, max Channel_t
+	add      bool
+}
+
+// Connection is a connection to a message director for AI and UberDOG servers. Channels, ranges and
+//  post-removes are remembered, and set up again whenever the connection is reestablished.
+type Connection struct {
+	config Config
+	log    *log.Entry
+
+	writeLock sync.Mutex
+
+	lock        sync.Mutex
+	conn        gonet.Conn
+	channels    map[Channel_t]bool
+	ranges      []channelRange
+	postRemoves map[Channel_t][]Datagram
+	context     uint32
+	pending     map[uint32]chan *DatagramIterator
+
+	closed    chan bool
+	closeOnce sync.Once
+	done      chan bool
+}
+
+// Dial connects to a message director and subscribes to the channel of the config. Only the first
+//  attempt to connect is reported as an error; later ones are retried as configured.
+func Dial(config Config) (*Connection, error) {
+	if config.DC == nil {
+		config.DC = core.Current().DC
+	}
+	if config.Reconnect == 0 {
+		config.Reconnect = DEFAULT_RECONNECT_DELAY
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DEFAULT_TIMEOUT
+	}
+
+	c := &Connection{
+		config:      config,
+		channels:    make(map[Channel_t]bool),
+		postRemoves: make(map[Channel_t][]Datagram),
+		pending:     make(map[uint32]chan *DatagramIterator),
+		closed:      make(chan bool),
+		done:        make(chan bool),
+		log: log.WithFields(log.Fields{
+			"name": fmt.Sprintf("MD client (%s)", config.Address),
+		}),
+	}
+	if config.Channel != 0 {
+		c.channels[config.Channel] = true
+	}
+
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	go c.run(conn)
+	return c, nil
+}
+
+// connect dials the message director and sets up the state of the connection again.
+func (c *Connection) connect() (gonet.Conn, error) {
+	conn, err := gonet.DialTimeout("tcp", c.config.Address, c.config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var setup []Datagram
+	if c.config.Name != "" {
+		dg := NewDatagram()
+		dg.AddControlHeader(CONTROL_SET_CON_NAME)
+		dg.AddString(c.config.Name)
+		setup = append(setup, dg)
+	}
+	if c.config.URL != "" {
+		dg := NewDatagram()
+		dg.AddControlHeader(CONTROL_SET_CON_URL)
+		dg.AddString(c.config.URL)
+		setup = append(setup, dg)
+	}
+	for channel := range c.channels {
+		setup = append(setup, channelControl(CONTROL_ADD_CHANNEL, channel))
+	}
+	for _, r := range c.ranges {
+		setup = append(setup, rangeControl(r))
+	}
+	for sender, datagrams := range c.postRemoves {
+		for _, pr := range datagrams {
+			setup = append(setup, postRemoveControl(sender, pr))
+		}
+	}
+
+	for _, dg := range setup {
+		if err := c.write(conn, dg); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	c.conn = conn
+	return conn, nil
+}
+
+func channelControl(msgType uint16, channel Channel_t) Datagram {
+	dg := NewDatagram()
+	dg.AddControlHeader(msgType)
+	dg.AddChannel(channel)
+	return dg
+}
+
+func rangeControl(r channelRange) Datagram {
+	dg := NewDatagram()
+	if r.add {
+		dg.AddControlHeader(CONTROL_ADD_RANGE)
+	} else {
+		dg.AddControlHeader(CONTROL_REMOVE_RANGE)
+	}
+	dg.AddChannel(r.min)
+	dg.AddChannel(r.max)
+	return dg
+}
+
+func postRemoveControl(sender Channel_t, pr Datagram) Datagram {
+	dg := NewDatagram()
+	dg.AddControlHeader(CONTROL_ADD_POST_REMOVE)
+	dg.AddChannel(sender)
+	dg.AddBlob(&pr)
+	return dg
+}
+
+func (c *Connection) write(conn gonet.Conn, dg Datagram) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	frame := NewDatagram()
+	frame.AddSize(Dgsize_t(dg.Len()))
+	frame.AddDatagram(&dg)
+
+	conn.SetWriteDeadline(time.Now().Add(c.config.Timeout))
+	if _, err := conn.Write(frame.Bytes()); err != nil {
+		// The reader notices the connection is closed, and reconnects
+		conn.Close()
+		return ErrDisconnected
+	}
+	return nil
+}
+
+// SendDatagram routes a datagram through the message director.
+func (c *Connection) SendDatagram(dg Datagram) error {
+	c.lock.Lock()
+	conn := c.conn
+	c.lock.Unlock()
+
+	if conn == nil {
+		if c.isClosed() {
+			return ErrClosed
+		}
+		return ErrDisconnected
+	}
+	return c.write(conn, dg)
+}
+
+// control records a change to the state of the connection, then sends it if connected. Changes made
+//  while disconnected are sent once the connection is reestablished.
+func (c *Connection) control(record func(), dg Datagram) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	record()
+	if c.conn != nil {
+		c.write(c.conn, dg)
+	}
+	return nil
+}
+
+func (c *Connection) SubscribeChannel(channel Channel_t) error {
+	return c.control(func() {
+		c.channels[channel] = true
+	}, channelControl(CONTROL_ADD_CHANNEL, channel))
+}
+
+func (c *Connection) UnsubscribeChannel(channel Channel_t) error {
+	return c.control(func() {
+		delete(c.channels, channel)
+	}, channelControl(CONTROL_REMOVE_CHANNEL, channel))
+}
+
+func (c *Connection) SubscribeRange(min Channel_t, max Channel_t) error {
+	r := channelRange{min, max, true}
+	return c.control(func() {
+		c.ranges = append(c.ranges, r)
+	}, rangeControl(r))
+}
+
+// UnsubscribeRange removes a range of channels, which may be part of a larger range subscribed to.
+func (c *Connection) UnsubscribeRange(min Channel_t, max Channel_t) error {
+	r := channelRange{min, max, false}
+	return c.control(func() {
+		// Ranges are replayed in order, so a range which is removed exactly as it was added is forgotten
+		for n := len(c.ranges) - 1; n >= 0; n-- {
+			if c.ranges[n] == (channelRange{min, max, true}) {
+				c.ranges = append(c.ranges[:n], c.ranges[n+1:]...)
+				return
+			}
+		}
+		c.ranges = append(c.ranges, r)
+	}, rangeControl(r))
+}
+
+// AddPostRemove asks the message director to route a datagram once the connection is lost. Post-removes
+//  are grouped by sender, so that those of one object can be cleared with ClearPostRemoves.
+func (c *Connection) AddPostRemove(sender Channel_t, pr Datagram) error {
+	return c.control(func() {
+		c.postRemoves[sender] = append(c.postRemoves[sender], pr)
+	}, postRemoveControl(sender, pr))
+}
+
+func (c *Connection) ClearPostRemoves(sender Channel_t) error {
+	return c.control(func() {
+		delete(c.postRemoves, sender)
+	}, channelControl(CONTROL_CLEAR_POST_REMOVES, sender))
+}
+
+// run reads from the message director until the connection is closed, reconnecting if it is lost.
+func (c *Connection) run(conn gonet.Conn) {
+	defer close(c.done)
+
+	for {
+		err := c.read(conn)
+
+		c.lock.Lock()
+		c.conn = nil
+		for context, response := range c.pending {
+			delete(c.pending, context)
+			close(response)
+		}
+		c.lock.Unlock()
+
+		if c.isClosed() {
+			return
+		}
+
+		c.log.Warnf("Lost connection to the message director: %s", err)
+		if c.config.Reconnect < 0 {
+			c.Close()
+			return
+		}
+
+		for conn = nil; conn == nil; {
+			select {
+			case <-time.After(c.config.Reconnect):
+			case <-c.closed:
+				return
+			}
+
+			if conn, err = c.connect(); err != nil {
+				c.log.Warnf("Failed to reconnect: %s", err)
+			}
+		}
+
+		// The connection may have been closed while reconnecting
+		if c.isClosed() {
+			conn.Close()
+			return
+		}
+		c.log.Infof("Reconnected to the message director")
+	}
+}
+
+func (c *Connection) read(conn gonet.Conn) error {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	size := make([]byte, Dgsize)
+	for {
+		if _, err := io.ReadFull(reader, size); err != nil {
+			return err
+		}
+
+		length := binary.LittleEndian.Uint32(size)
+		if length > MAX_DATAGRAM_SIZE {
+			return errors.New(fmt.Sprintf("datagram of %d bytes is too large", length))
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return err
+		}
+
+		dg := NewDatagram()
+		dg.Write(data)
+		c.handle(dg)
+	}
+}
+
+// handle passes a datagram to the request awaiting it, or else to the handler.
+func (c *Connection) handle(dg Datagram) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(DatagramIteratorEOF); ok {
+				c.log.Warnf("Received a truncated datagram")
+			} else {
+				panic(r)
+			}
+		}
+	}()
+
+	dgi := NewDatagramIterator(&dg)
+	dgi.SeekPayload()
+	dgi.ReadChannel() // Sender
+	switch dgi.ReadUint16() {
+	case STATESERVER_OBJECT_GET_FIELD_RESP, STATESERVER_OBJECT_GET_ALL_RESP, STATESERVER_OBJECT_GET_LOCATION_RESP:
+		context := dgi.ReadUint32()
+		c.lock.Lock()
+		response, ok := c.pending[context]
+		delete(c.pending, context)
+		c.lock.Unlock()
+
+		if ok {
+			response <- dgi
+			return
+		}
+	}
+
+	if c.config.Handler != nil {
+		c.config.Handler.HandleDatagram(dg, NewDatagramIterator(&dg))
+	}
+}
+
+func (c *Connection) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close disconnects from the message director, which then routes the post-removes of the connection.
+func (c *Connection) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.lock.Lock()
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.lock.Unlock()
+	})
+
+	return nil
+}
+
+// Wait blocks until the connection is closed, either by Close or by losing a connection which does
+//  not reconnect.
+func (c *Connection) Wait() {
+	<-c.done
+}
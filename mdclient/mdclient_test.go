@@ -0,0 +1,419 @@
+package mdclient
+
+import (
+	"astrongo/core"
+	"astrongo/test"
+	. "astrongo/util"
+	"bufio"
+	"encoding/binary"
+	"github.com/apex/log"
+	"github.com/stretchr/testify/require"
+	"io"
+	gonet "net"
+	"os"
+	"testing"
+	"time"
+)
+
+const ssChannel = Channel_t(400000)
+
+func TestMain(m *testing.M) {
+	log.SetHandler(log.HandlerFunc(func(*log.Entry) error { return nil }))
+
+	dcf, err := core.ReadDC([]string{"dclass/parse/test.dc"})
+	if err != nil {
+		panic(err)
+	}
+	core.DC = dcf
+
+	os.Exit(m.Run())
+}
+
+// fakeMD accepts connections one at a time, passing on every datagram it receives.
+type fakeMD struct {
+	listener gonet.Listener
+	conns    chan gonet.Conn
+	received chan Datagram
+}
+
+func startFakeMD(t *testing.T) *fakeMD {
+	listener, err := gonet.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	md := &fakeMD{listener: listener, conns: make(chan gonet.Conn, 4), received: make(chan Datagram, 64)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			md.conns <- conn
+			md.serve(conn)
+		}
+	}()
+	return md
+}
+
+func (md *fakeMD) serve(conn gonet.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		size := make([]byte, Dgsize)
+		if _, err := io.ReadFull(reader, size); err != nil {
+			return
+		}
+		data := make([]byte, binary.LittleEndian.Uint32(size))
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return
+		}
+
+		dg := NewDatagram()
+		dg.Write(data)
+		md.received <- dg
+	}
+}
+
+func (md *fakeMD) expect(t *testing.T, expected Datagram) {
+	select {
+	case dg := <-md.received:
+		require.Equal(t, expected.Bytes(), dg.Bytes())
+	case <-time.After(time.Second):
+		t.Fatalf("no datagram received, expected % x", expected.Bytes())
+	}
+}
+
+func (md *fakeMD) receive(t *testing.T) *DatagramIterator {
+	select {
+	case dg := <-md.received:
+		return NewDatagramIterator(&dg)
+	case <-time.After(time.Second):
+		t.Fatalf("no datagram received")
+		return nil
+	}
+}
+
+func send(t *testing.T, conn gonet.Conn, dg Datagram) {
+	frame := NewDatagram()
+	frame.AddSize(Dgsize_t(dg.Len()))
+	frame.AddDatagram(&dg)
+	_, err := conn.Write(frame.Bytes())
+	require.NoError(t, err)
+}
+
+func control(msgType uint16, channels ...Channel_t) Datagram {
+	dg := NewDatagram()
+	dg.AddControlHeader(msgType)
+	for _, channel := range channels {
+		dg.AddChannel(channel)
+	}
+	return dg
+}
+
+func conName(name string) Datagram {
+	dg := control(CONTROL_SET_CON_NAME)
+	dg.AddString(name)
+	return dg
+}
+
+func postRemove(sender Channel_t, pr Datagram) Datagram {
+	dg := control(CONTROL_ADD_POST_REMOVE, sender)
+	dg.AddBlob(&pr)
+	return dg
+}
+
+// uint32Field and stringField stand in for fields generated with `astron dc gen-go`.
+type uint32Field struct {
+	id    uint16
+	Value uint32
+}
+
+func (f *uint32Field) FieldId() uint16              { return f.id }
+func (f *uint32Field) Pack(dg *Datagram)            { dg.AddUint32(f.Value) }
+func (f *uint32Field) Unpack(dgi *DatagramIterator) { f.Value = dgi.ReadUint32() }
+
+type stringField struct {
+	id    uint16
+	Value string
+}
+
+func (f *stringField) FieldId() uint16              { return f.id }
+func (f *stringField) Pack(dg *Datagram)            { dg.AddString(f.Value) }
+func (f *stringField) Unpack(dgi *DatagramIterator) { f.Value = dgi.ReadString() }
+
+func TestConnection_Control(t *testing.T) {
+	md := startFakeMD(t)
+	defer md.listener.Close()
+
+	c, err := Dial(Config{Address: md.listener.Addr().String(), Name: "AI #1", Channel: 4000})
+	require.NoError(t, err)
+	defer c.Close()
+
+	md.expect(t, conName("AI #1"))
+	md.expect(t, control(CONTROL_ADD_CHANNEL, 4000))
+
+	require.NoError(t, c.SubscribeChannel(5000))
+	md.expect(t, control(CONTROL_ADD_CHANNEL, 5000))
+	require.NoError(t, c.UnsubscribeChannel(5000))
+	md.expect(t, control(CONTROL_REMOVE_CHANNEL, 5000))
+	require.NoError(t, c.SubscribeRange(100, 200))
+	md.expect(t, control(CONTROL_ADD_RANGE, 100, 200))
+	require.NoError(t, c.UnsubscribeRange(150, 160))
+	md.expect(t, control(CONTROL_REMOVE_RANGE, 150, 160))
+
+	pr := NewDatagram()
+	pr.AddServerHeader(ssChannel, 4000, STATESERVER_OBJECT_DELETE_RAM)
+	pr.AddDoid(4000)
+	require.NoError(t, c.AddPostRemove(4000, pr))
+	md.expect(t, postRemove(4000, pr))
+	require.NoError(t, c.ClearPostRemoves(4000))
+	md.expect(t, control(CONTROL_CLEAR_POST_REMOVES, 4000))
+
+	require.NoError(t, c.SetField(1000, &uint32Field{test.SetRequired1, 5}))
+	dg := NewDatagram()
+	dg.AddServerHeader(1000, 4000, STATESERVER_OBJECT_SET_FIELD)
+	dg.AddDoid(1000)
+	dg.AddUint16(test.SetRequired1)
+	dg.AddUint32(5)
+	md.expect(t, dg)
+
+	c.Close()
+	c.Wait()
+	require.Equal(t, ErrClosed, c.SubscribeChannel(6000))
+	require.Equal(t, ErrClosed, c.SendDatagram(dg))
+}
+
+func TestConnection_Requests(t *testing.T) {
+	md := startFakeMD(t)
+	defer md.listener.Close()
+
+	handled := make(chan uint16, 1)
+	c, err := Dial(Config{
+		Address: md.listener.Addr().String(),
+		Channel: 4000,
+		Timeout: 200 * time.Millisecond,
+		Handler: HandlerFunc(func(dg Datagram, dgi *DatagramIterator) {
+			dgi.SeekPayload()
+			dgi.ReadChannel()
+			handled <- dgi.ReadUint16()
+		}),
+	})
+	require.NoError(t, err)
+	defer c.Close()
+	conn := <-md.conns
+	md.expect(t, control(CONTROL_ADD_CHANNEL, 4000))
+
+	name := &stringField{id: test.SetBR1}
+	fieldErr := make(chan error)
+	go func() { fieldErr <- c.GetField(1000, name) }()
+	type location struct {
+		parent Doid_t
+		zone   Zone_t
+		err    error
+	}
+	locationDone := make(chan location)
+	go func() {
+		parent, zone, err := c.GetLocation(1001)
+		locationDone <- location{parent, zone, err}
+	}()
+
+	// Requests are told apart by their context, whichever order they are answered in
+	contexts := make(map[uint16]uint32)
+	for n := 0; n < 2; n++ {
+		dgi := md.receive(t)
+		dgi.SeekPayload()
+		require.Equal(t, Channel_t(4000), dgi.ReadChannel())
+		msgType := dgi.ReadUint16()
+		contexts[msgType] = dgi.ReadUint32()
+	}
+	require.Len(t, contexts, 2)
+
+	dg := NewDatagram()
+	dg.AddServerHeader(4000, 1001, STATESERVER_OBJECT_GET_LOCATION_RESP)
+	dg.AddUint32(contexts[STATESERVER_OBJECT_GET_LOCATION])
+	dg.AddDoid(1001)
+	dg.AddLocation(20, 30)
+	send(t, conn, dg)
+	require.Equal(t, location{20, 30, nil}, <-locationDone)
+
+	dg = NewDatagram()
+	dg.AddServerHeader(4000, 1000, STATESERVER_OBJECT_GET_FIELD_RESP)
+	dg.AddUint32(contexts[STATESERVER_OBJECT_GET_FIELD])
+	dg.AddBool(true)
+	dg.AddUint16(test.SetBR1)
+	dg.AddString("Bob")
+	send(t, conn, dg)
+	require.NoError(t, <-fieldErr)
+	require.Equal(t, "Bob", name.Value)
+
+	// A response nobody is waiting for goes to the handler
+	send(t, conn, dg)
+	require.Equal(t, uint16(STATESERVER_OBJECT_GET_FIELD_RESP), <-handled)
+
+	go func() { fieldErr <- c.GetField(1000, name) }()
+	dgi := md.receive(t)
+	dgi.Seek(dgi.Tell() + 1 + 2*Chansize + 2)
+	dg = NewDatagram()
+	dg.AddServerHeader(4000, 1000, STATESERVER_OBJECT_GET_FIELD_RESP)
+	dg.AddUint32(dgi.ReadUint32())
+	dg.AddBool(false)
+	send(t, conn, dg)
+	require.Equal(t, ErrFieldNotSet, <-fieldErr)
+
+	objDone := make(chan *Object)
+	go func() {
+		obj, err := c.GetAll(1002)
+		require.NoError(t, err)
+		objDone <- obj
+	}()
+	dgi = md.receive(t)
+	dgi.Seek(dgi.Tell() + 1 + 2*Chansize + 2)
+	dg = NewDatagram()
+	dg.AddServerHeader(4000, 1002, STATESERVER_OBJECT_GET_ALL_RESP)
+	dg.AddUint32(dgi.ReadUint32())
+	dg.AddDoid(1002)
+	dg.AddLocation(20, 30)
+	dg.AddUint16(test.DistributedTestObject3)
+	dg.AddUint32(78) // setRequired1
+	dg.AddUint32(9)  // setRDB3
+	dg.AddUint16(1)
+	dg.AddUint16(test.SetBR1)
+	dg.AddString("Alice")
+	send(t, conn, dg)
+
+	obj := <-objDone
+	require.Equal(t, Doid_t(1002), obj.Doid)
+	require.Equal(t, Doid_t(20), obj.Parent)
+	require.Equal(t, Zone_t(30), obj.Zone)
+	require.Equal(t, "DistributedTestObject3", obj.Class.Name())
+	require.Len(t, obj.Fields, 3)
+
+	rdb := &uint32Field{id: test.SetRDB3}
+	ok, err := obj.Get(rdb)
+	require.True(t, ok)
+	require.NoError(t, err)
+	require.Equal(t, uint32(9), rdb.Value)
+	ok, _ = obj.Get(name)
+	require.True(t, ok)
+	require.Equal(t, "Alice", name.Value)
+	ok, _ = obj.Get(&uint32Field{id: test.SetBRA1})
+	require.False(t, ok)
+
+	// Requests which are never answered time out
+	_, _, err = c.GetLocation(1003)
+	require.Equal(t, ErrTimeout, err)
+}
+
+func TestObject_Create(t *testing.T) {
+	cls, _ := core.DC.ClassByName("DistributedTestObject3")
+	obj, err := NewObject(cls, 1000, 20, 30, &uint32Field{test.SetRDB3, 9}, &uint32Field{test.SetRequired1, 78})
+	require.NoError(t, err)
+
+	// Required fields are sent in the order of the class
+	dg, err := obj.Create(ssChannel, 4000)
+	require.NoError(t, err)
+	expected := NewDatagram()
+	expected.AddServerHeader(ssChannel, 4000, STATESERVER_CREATE_OBJECT_WITH_REQUIRED)
+	expected.AddDoid(1000)
+	expected.AddLocation(20, 30)
+	expected.AddUint16(test.DistributedTestObject3)
+	expected.AddUint32(78)
+	expected.AddUint32(9)
+	require.Equal(t, expected.Bytes(), dg.Bytes())
+
+	require.NoError(t, obj.Set(&uint32Field{test.SetRequired1, 5}))
+	require.NoError(t, obj.Set(&stringField{test.SetBR1, "Bob"}))
+	require.NoError(t, obj.Set(&stringField{test.SetDb3, "data"}))
+	dg, err = obj.Create(ssChannel, 4000)
+	require.NoError(t, err)
+	expected = NewDatagram()
+	expected.AddServerHeader(ssChannel, 4000, STATESERVER_CREATE_OBJECT_WITH_REQUIRED_OTHER)
+	expected.AddDoid(1000)
+	expected.AddLocation(20, 30)
+	expected.AddUint16(test.DistributedTestObject3)
+	expected.AddUint32(5)
+	expected.AddUint32(9)
+	expected.AddUint16(2)
+	expected.AddUint16(test.SetBR1)
+	expected.AddString("Bob")
+	expected.AddUint16(test.SetDb3)
+	expected.AddString("data")
+	require.Equal(t, expected.Bytes(), dg.Bytes())
+
+	require.NoError(t, obj.Set(&uint32Field{test.SetB1, 1}))
+	_, err = obj.Create(ssChannel, 4000)
+	require.EqualError(t, err, "field setB1 of DistributedTestObject3 is neither required nor ram")
+
+	obj, _ = NewObject(cls, 1000, 20, 30, &uint32Field{test.SetRequired1, 78})
+	_, err = obj.Create(ssChannel, 4000)
+	require.EqualError(t, err, "required field setRDB3 of DistributedTestObject3 has no value")
+
+	_, err = NewObject(cls, 1000, 20, 30, &uint32Field{test.SetX, 1})
+	require.Error(t, err)
+}
+
+func TestConnection_Reconnect(t *testing.T) {
+	md := startFakeMD(t)
+	defer md.listener.Close()
+
+	c, err := Dial(Config{
+		Address:   md.listener.Addr().String(),
+		Name:      "UberDOG",
+		Channel:   4000,
+		Reconnect: 20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	conn := <-md.conns
+	md.expect(t, conName("UberDOG"))
+	md.expect(t, control(CONTROL_ADD_CHANNEL, 4000))
+
+	pr := NewDatagram()
+	pr.AddServerHeader(ssChannel, 4000, STATESERVER_OBJECT_DELETE_RAM)
+	pr.AddDoid(4000)
+	require.NoError(t, c.SubscribeRange(100, 200))
+	require.NoError(t, c.SubscribeRange(300, 400))
+	require.NoError(t, c.UnsubscribeRange(300, 400))
+	require.NoError(t, c.UnsubscribeRange(150, 160))
+	require.NoError(t, c.AddPostRemove(4000, pr))
+	for n := 0; n < 5; n++ {
+		md.receive(t)
+	}
+
+	// Requests in flight fail once the connection is lost
+	locationErr := make(chan error)
+	go func() {
+		_, _, err := c.GetLocation(1000)
+		locationErr <- err
+	}()
+	md.receive(t)
+	conn.Close()
+	require.Equal(t, ErrDisconnected, <-locationErr)
+
+	// Everything is set up again on the new connection
+	<-md.conns
+	md.expect(t, conName("UberDOG"))
+	md.expect(t, control(CONTROL_ADD_CHANNEL, 4000))
+	md.expect(t, control(CONTROL_ADD_RANGE, 100, 200))
+	md.expect(t, control(CONTROL_REMOVE_RANGE, 150, 160))
+	md.expect(t, postRemove(4000, pr))
+
+	require.NoError(t, c.SubscribeChannel(5000))
+	md.expect(t, control(CONTROL_ADD_CHANNEL, 5000))
+
+	c.Close()
+	c.Wait()
+}
+
+func TestConnection_NoReconnect(t *testing.T) {
+	md := startFakeMD(t)
+	defer md.listener.Close()
+
+	c, err := Dial(Config{Address: md.listener.Addr().String(), Reconnect: -1})
+	require.NoError(t, err)
+
+	conn := <-md.conns
+	conn.Close()
+	c.Wait()
+	require.Equal(t, ErrClosed, c.SubscribeChannel(5000))
+}
@@ -0,0 +1,151 @@
+package mdclient
+
+import (
+	"astrongo/dclass/dc"
+	. "astrongo/util"
+	"errors"
+	"fmt"
+)
+
+// Field is implemented by the values generated for every field with `astron dc gen-go`, so that the
+//  generated package can be used with a connection as is.
+type Field interface {
+	FieldId() uint16
+
+	Pack(dg *Datagram)
+	Unpack(dgi *DatagramIterator)
+}
+
+// Object is a distributed object, along with packed values for some of its fields.
+type Object struct {
+	Doid   Doid_t
+	Parent Doid_t
+	Zone   Zone_t
+	Class  *dc.Class
+	Fields []dc.FieldValue
+}
+
+// NewObject prepares an object to be created with the given field values.
+func NewObject(cls *dc.Class, doid Doid_t, parent Doid_t, zone Zone_t, fields ...Field) (*Object, error) {
+	obj := &Object{Doid: doid, Parent: parent, Zone: zone, Class: cls}
+	for _, field := range fields {
+		if err := obj.Set(field); err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// requiredFields lists the fields sent with the required fields of an object, in the order they
+//  are sent; molecular fields are left out, since their components are sent themselves.
+func requiredFields(cls *dc.Class) []dc.Field {
+	var fields []dc.Field
+	for n := 0; n < cls.GetNumFields(); n++ {
+		field := cls.GetField(n)
+		if _, ok := field.(*dc.MolecularField); ok {
+			continue
+		}
+
+		if field.HasKeyword("required") {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func (o *Object) value(id uint16) (int, bool) {
+	for n, fv := range o.Fields {
+		if fv.Field.Id() == uint(id) {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// Get unpacks the value of a field of the object into field, returning false if the object has no
+//  value for it.
+func (o *Object) Get(field Field) (ok bool, err error) {
+	n, ok := o.value(field.FieldId())
+	if !ok {
+		return false, nil
+	}
+
+	dg := NewDatagram()
+	dg.AddData(o.Fields[n].Data)
+	dgi := NewDatagramIterator(&dg)
+	return true, decode(func() error {
+		field.Unpack(dgi)
+		return nil
+	})
+}
+
+// Set packs the value of a field of the object, replacing any value it had.
+func (o *Object) Set(field Field) error {
+	f, ok := o.Class.GetFieldById(uint(field.FieldId()))
+	if !ok {
+		return errors.New(fmt.Sprintf("class %s has no field %d", o.Class.Name(), field.FieldId()))
+	}
+
+	dg := NewDatagram()
+	field.Pack(&dg)
+	fv := dc.FieldValue{Field: f, Data: dg.Bytes()}
+	if n, ok := o.value(field.FieldId()); ok {
+		o.Fields[n] = fv
+	} else {
+		o.Fields = append(o.Fields, fv)
+	}
+	return nil
+}
+
+// Create builds a STATESERVER_CREATE_OBJECT_WITH_REQUIRED which creates the object on a state
+//  server; the object must have a value for every required field. If it has values for other fields,
+//  which must then be ram fields, they are sent with a STATESERVER_CREATE_OBJECT_WITH_REQUIRED_OTHER
+//  instead.
+func (o *Object) Create(stateServer Channel_t, from Channel_t) (Datagram, error) {
+	required := requiredFields(o.Class)
+	values := make(map[dc.Field][]byte)
+	for _, fv := range o.Fields {
+		values[fv.Field] = fv.Data
+	}
+
+	body := NewDatagram()
+	body.AddDoid(o.Doid)
+	body.AddLocation(o.Parent, o.Zone)
+	body.AddUint16(uint16(o.Class.ClassId()))
+	for _, field := range required {
+		data, ok := values[field]
+		if !ok {
+			return Datagram{}, errors.New(fmt.Sprintf("required field %s of %s has no value", field.Name(), o.Class.Name()))
+		}
+		body.AddData(data)
+		delete(values, field)
+	}
+
+	// Other fields are sent in the order they were set
+	var other []dc.FieldValue
+	for _, fv := range o.Fields {
+		if _, ok := values[fv.Field]; !ok {
+			continue
+		}
+		if !fv.Field.HasKeyword("ram") {
+			return Datagram{}, errors.New(fmt.Sprintf("field %s of %s is neither required nor ram", fv.Field.Name(), o.Class.Name()))
+		}
+		other = append(other, fv)
+	}
+
+	dg := NewDatagram()
+	if len(other) == 0 {
+		dg.AddServerHeader(stateServer, from, STATESERVER_CREATE_OBJECT_WITH_REQUIRED)
+		dg.AddDatagram(&body)
+		return dg, nil
+	}
+
+	dg.AddServerHeader(stateServer, from, STATESERVER_CREATE_OBJECT_WITH_REQUIRED_OTHER)
+	dg.AddDatagram(&body)
+	dg.AddUint16(uint16(len(other)))
+	for _, fv := range other {
+		dg.AddUint16(uint16(fv.Field.Id()))
+		dg.AddData(fv.Data)
+	}
+	return dg, nil
+}
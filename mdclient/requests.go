@@ -0,0 +1,187 @@
+package mdclient
+
+import (
+	"astrongo/dclass/dc"
+	. "astrongo/util"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrFieldNotSet = errors.New("field is not set on the object")
+
+// request sends a datagram built with a new context, and returns an iterator over the response
+//  positioned after the context.
+func (c *Connection) request(build func(context uint32) Datagram) (*DatagramIterator, error) {
+	response := make(chan *DatagramIterator, 1)
+	c.lock.Lock()
+	c.context++
+	context := c.context
+	c.pending[context] = response
+	c.lock.Unlock()
+
+	forget := func() {
+		c.lock.Lock()
+		delete(c.pending, context)
+		c.lock.Unlock()
+	}
+
+	if err := c.SendDatagram(build(context)); err != nil {
+		forget()
+		return nil, err
+	}
+
+	select {
+	case dgi, ok := <-response:
+		if !ok {
+			return nil, ErrDisconnected
+		}
+		return dgi, nil
+	case <-time.After(c.config.Timeout):
+		forget()
+		return nil, ErrTimeout
+	case <-c.closed:
+		return nil, ErrClosed
+	}
+}
+
+// decode turns a response which is cut short or otherwise invalid into an error.
+func decode(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case DatagramIteratorEOF:
+				err = errors.New(fmt.Sprintf("truncated response: %s", r))
+			case FieldConstraintViolation:
+				err = errors.New(fmt.Sprintf("invalid response: %s", r))
+			default:
+				panic(r)
+			}
+		}
+	}()
+
+	return f()
+}
+
+// GetField queries the value of one field of an object, unpacking it into field. ErrFieldNotSet is
+//  returned if the object does not have the field, or it has no value.
+func (c *Connection) GetField(doid Doid_t, field Field) error {
+	dgi, err := c.request(func(context uint32) Datagram {
+		dg := NewDatagram()
+		dg.AddServerHeader(Channel_t(doid), c.config.Channel, STATESERVER_OBJECT_GET_FIELD)
+		dg.AddUint32(context)
+		dg.AddDoid(doid)
+		dg.AddUint16(field.FieldId())
+		return dg
+	})
+	if err != nil {
+		return err
+	}
+
+	return decode(func() error {
+		if !dgi.ReadBool() {
+			return ErrFieldNotSet
+		}
+
+		if id := dgi.ReadUint16(); id != field.FieldId() {
+			return errors.New(fmt.Sprintf("response is for field %d rather than %d", id, field.FieldId()))
+		}
+		field.Unpack(dgi)
+		return nil
+	})
+}
+
+// GetAll queries the location and every field which an object has a value for.
+func (c *Connection) GetAll(doid Doid_t) (*Object, error) {
+	dgi, err := c.request(func(context uint32) Datagram {
+		dg := NewDatagram()
+		dg.AddServerHeader(Channel_t(doid), c.config.Channel, STATESERVER_OBJECT_GET_ALL)
+		dg.AddUint32(context)
+		dg.AddDoid(doid)
+		return dg
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &Object{}
+	err = decode(func() error {
+		obj.Doid = dgi.ReadDoid()
+		obj.Parent = dgi.ReadDoid()
+		obj.Zone = dgi.ReadZone()
+
+		id := dgi.ReadUint16()
+		cls, ok := c.config.DC.Class(int(id))
+		if !ok {
+			return errors.New(fmt.Sprintf("object %d has unknown dclass %d", doid, id))
+		}
+		obj.Class = cls
+
+		for _, field := range requiredFields(cls) {
+			obj.Fields = append(obj.Fields, dc.FieldValue{Field: field, Data: dgi.UnpackFieldtoUint8(field)})
+		}
+
+		count := dgi.ReadUint16()
+		for n := 0; n < int(count); n++ {
+			id := dgi.ReadUint16()
+			field, ok := cls.GetFieldById(uint(id))
+			if !ok {
+				return errors.New(fmt.Sprintf("object %d has unknown field %d", doid, id))
+			}
+			obj.Fields = append(obj.Fields, dc.FieldValue{Field: field, Data: dgi.UnpackFieldtoUint8(field)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// GetLocation queries the parent and zone of an object.
+func (c *Connection) GetLocation(doid Doid_t) (parent Doid_t, zone Zone_t, err error) {
+	dgi, err := c.request(func(context uint32) Datagram {
+		dg := NewDatagram()
+		dg.AddServerHeader(Channel_t(doid), c.config.Channel, STATESERVER_OBJECT_GET_LOCATION)
+		dg.AddUint32(context)
+		return dg
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = decode(func() error {
+		dgi.ReadDoid()
+		parent, zone = dgi.ReadDoid(), dgi.ReadZone()
+		return nil
+	})
+	return parent, zone, err
+}
+
+// SetField updates a field of an object, as the channel of the connection.
+func (c *Connection) SetField(doid Doid_t, field Field) error {
+	dg := NewDatagram()
+	dg.AddServerHeader(Channel_t(doid), c.config.Channel, STATESERVER_OBJECT_SET_FIELD)
+	dg.AddDoid(doid)
+	dg.AddUint16(field.FieldId())
+	field.Pack(&dg)
+	return c.SendDatagram(dg)
+}
+
+// CreateObject asks a state server to create an object; see Object.Create.
+func (c *Connection) CreateObject(stateServer Channel_t, obj *Object) error {
+	dg, err := obj.Create(stateServer, c.config.Channel)
+	if err != nil {
+		return err
+	}
+	return c.SendDatagram(dg)
+}
+
+// DeleteObject removes an object, along with its children, from the state server.
+func (c *Connection) DeleteObject(doid Doid_t) error {
+	dg := NewDatagram()
+	dg.AddServerHeader(Channel_t(doid), c.config.Channel, STATESERVER_OBJECT_DELETE_RAM)
+	dg.AddDoid(doid)
+	return c.SendDatagram(dg)
+}
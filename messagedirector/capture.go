@@ -0,0 +1,159 @@
+package messagedirector
+
+import (
+	. "astrongo/util"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Capture files start with this header, followed by one record per routed datagram. Each record is
+//  a size-prefixed datagram holding the time it was routed (in nanoseconds since the Unix epoch), the
+//  name of the participant which sent it, and the datagram itself as a blob.
+const CAPTURE_MAGIC = "ASTRONCAP"
+const CAPTURE_VERSION = 1
+
+// CaptureRecord is a datagram routed by the MD, as written to a capture file.
+type CaptureRecord struct {
+	Time     time.Time
+	Sender   string
+	Datagram Datagram
+}
+
+// Capture writes every datagram routed by an MD to a file.
+type Capture struct {
+	sync.Mutex
+
+	file   *os.File
+	writer *bufio.Writer
+	failed bool
+}
+
+// NewCapture creates a capture file, replacing any file at the same path.
+func NewCapture(path string) (*Capture, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Capture{file: file, writer: bufio.NewWriter(file)}
+	header := NewDatagram()
+	header.AddData([]byte(CAPTURE_MAGIC))
+	header.AddUint16(CAPTURE_VERSION)
+	if _, err := c.writer.Write(header.Bytes()); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Write appends a datagram to the capture. The capture is flushed whenever flush is set, which the MD
+//  does once its queue is empty. After a failed write, nothing more is written.
+func (c *Capture) Write(at time.Time, sender string, dg Datagram, flush bool) {
+	c.Lock()
+	defer c.Unlock()
+	if c.failed {
+		return
+	}
+
+	record := NewDatagram()
+	record.AddUint64(uint64(at.UnixNano()))
+	record.AddString(sender)
+	record.AddBlob(&dg)
+
+	size := make([]byte, Dgsize)
+	binary.LittleEndian.PutUint32(size, uint32(record.Len()))
+	_, err := c.writer.Write(size)
+	if err == nil {
+		_, err = c.writer.Write(record.Bytes())
+	}
+	if err == nil && flush {
+		err = c.writer.Flush()
+	}
+
+	if err != nil {
+		MDLog.Errorf("Failed to write capture file; capture stopped: %s", err)
+		c.failed = true
+	}
+}
+
+// captureName names the sender of a captured datagram: the name it gave the MD, or else its type.
+func captureName(p MDParticipant) string {
+	if p == nil {
+		return ""
+	}
+
+	if name := p.Name(); name != "" {
+		return name
+	}
+
+	if sub := p.Subscriber(); sub != nil && sub.participant != nil {
+		return fmt.Sprintf("%T", sub.participant)
+	}
+	return fmt.Sprintf("%T", p)
+}
+
+// Close flushes the capture and closes its file.
+func (c *Capture) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	err := c.writer.Flush()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// CaptureReader reads the records of a capture file in order.
+type CaptureReader struct {
+	reader io.Reader
+}
+
+// NewCaptureReader checks the header of a capture file, and returns a reader for its records.
+func NewCaptureReader(r io.Reader) (*CaptureReader, error) {
+	header := make([]byte, len(CAPTURE_MAGIC)+2)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(CAPTURE_MAGIC)]) != CAPTURE_MAGIC {
+		return nil, errors.New("not a capture file")
+	}
+
+	if version := binary.LittleEndian.Uint16(header[len(CAPTURE_MAGIC):]); version != CAPTURE_VERSION {
+		return nil, errors.New(fmt.Sprintf("unsupported capture version %d", version))
+	}
+
+	return &CaptureReader{reader: r}, nil
+}
+
+// Next reads the next record, returning io.EOF once the capture has been read entirely. A record cut
+//  short by the end of the file, as happens when the MD was stopped abruptly, counts as the end.
+func (c *CaptureReader) Next() (record CaptureRecord, err error) {
+	size := make([]byte, Dgsize)
+	if _, err := io.ReadFull(c.reader, size); err != nil {
+		return record, io.EOF
+	}
+
+	data := make([]byte, binary.LittleEndian.Uint32(size))
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return record, io.EOF
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("malformed capture record")
+		}
+	}()
+
+	dg := NewDatagram()
+	dg.Write(data)
+	dgi := NewDatagramIterator(&dg)
+	record.Time = time.Unix(0, int64(dgi.ReadUint64()))
+	record.Sender = dgi.ReadString()
+	record.Datagram = *dgi.ReadDatagram()
+	return record, nil
+}
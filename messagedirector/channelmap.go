@@ -1,7 +1,9 @@
 package messagedirector
 
 import (
+	"astrongo/core"
 	. "astrongo/util"
+	"fmt"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -344,6 +346,9 @@ func (r *RangeMap) Send(ch Channel_t, data *MDDatagram) {
 					found = true
 					if !data.HasSent(sub.participant.Subscriber()) {
 						data.sent = append(data.sent, sub.participant.Subscriber())
+						if core.TraceEnabled() {
+							core.TraceDatagram(fmt.Sprintf("RangeMap -> %s", sub.participant.Name()), *data.dg.Dg)
+						}
 						go sub.participant.HandleDatagram(*data.dg.Dg, data.dg.Copy())
 					}
 				}
@@ -489,6 +494,9 @@ func (c *ChannelMap) Send(ch Channel_t, data *MDDatagram) {
 			if data.sender == nil || sub.participant.Subscriber() != data.sender.Subscriber() {
 				if !data.HasSent(sub.participant.Subscriber()) {
 					data.sent = append(data.sent, sub.participant.Subscriber())
+					if core.TraceEnabled() {
+						core.TraceDatagram(fmt.Sprintf("ChannelMap -> %s", sub.participant.Name()), *data.dg.Dg)
+					}
 					go sub.participant.HandleDatagram(*data.dg.Dg, data.dg.Copy())
 				}
 			}
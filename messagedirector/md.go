@@ -2,14 +2,16 @@ package messagedirector
 
 import (
 	"astrongo/core"
+	"astrongo/metrics"
 	"astrongo/net"
 	. "astrongo/util"
 	"fmt"
 	"github.com/apex/log"
 	gonet "net"
-	"os"
-	"os/signal"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Maximum number of datagrams that can be added to the MD queue.
@@ -18,6 +20,9 @@ const QUEUE_MAX = 1024
 var MDLog *log.Entry
 var MD *MessageDirector
 
+var routedDatagrams = metrics.NewCounter("astron_md_routed_datagrams_total",
+	"Number of datagrams routed by the MD.", "msgtype")
+
 type MessageDirector struct {
 	sync.Mutex
 	net.Server
@@ -35,16 +40,38 @@ type MessageDirector struct {
 		md MDParticipant
 	}
 
+	// Number of datagrams which were queued and have not finished routing yet, including the one
+	//  currently being routed by the queue loop.
+	pending int64
+
 	// If an MD is configurated to be upstream, it will connect to the downstream MD and route channelmap
 	// events through it. Clients subscribing to channels that reside in other parts of the network will
 	// receive updates for them through the downstream MD.
 	upstream *MDUpstream
+
+	// If configured, every routed datagram is written to a capture file for debugging.
+	capture *Capture
 }
 
 func init() {
 	MDLog = log.WithFields(log.Fields{
 		"name": "MD",
 	})
+
+	metrics.NewGaugeFunc("astron_md_queue_length", "Number of datagrams waiting in the MD queue.", func() float64 {
+		if MD == nil {
+			return 0
+		}
+		return float64(len(MD.Queue))
+	})
+	metrics.NewGaugeFunc("astron_md_subscribers", "Number of participants connected to the MD.", func() float64 {
+		if MD == nil {
+			return 0
+		}
+		MD.Lock()
+		defer MD.Unlock()
+		return float64(len(MD.participants))
+	})
 }
 
 func Start() {
@@ -64,6 +91,15 @@ func Start() {
 		bindAddr = "127.0.0.1:7199"
 	}
 
+	if path := core.Config.MessageDirector.Capture; path != "" {
+		capture, err := NewCapture(path)
+		if err != nil {
+			MDLog.Fatal(fmt.Sprintf("Unable to open capture file: %s", err))
+		}
+		MD.capture = capture
+		MDLog.Infof("Capturing routed datagrams to %s", path)
+	}
+
 	connectAddr := core.Config.MessageDirector.Connect
 	if connectAddr != "" {
 		MD.upstream = NewMDUpstream(MD, connectAddr)
@@ -83,10 +119,18 @@ func Start() {
 	go MD.Start(bindAddr, errChan)
 }
 
+// enqueue adds a datagram to the queue to be routed on behalf of a participant, which is nil for
+//  datagrams received from the upstream MD.
+func (m *MessageDirector) enqueue(dg Datagram, md MDParticipant) {
+	atomic.AddInt64(&m.pending, 1)
+	m.Queue <- struct {
+		dg Datagram
+		md MDParticipant
+	}{dg, md}
+}
+
 func (m *MessageDirector) queueLoop() {
 	finish := make(chan bool)
-	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, os.Interrupt)
 
 	for {
 		select {
@@ -102,6 +146,11 @@ func (m *MessageDirector) queueLoop() {
 					}
 				}()
 
+				core.TraceDatagram("MD", obj.dg)
+				if m.capture != nil {
+					m.capture.Write(time.Now(), captureName(obj.md), obj.dg, len(m.Queue) == 0)
+				}
+
 				// Iterate the datagram for receivers
 				var receivers []Channel_t
 				dgi := NewDatagramIterator(&obj.dg)
@@ -109,6 +158,7 @@ func (m *MessageDirector) queueLoop() {
 				for n := 0; uint8(n) < chanCount; n++ {
 					receivers = append(receivers, dgi.ReadChannel())
 				}
+				routedDatagrams.Inc(strconv.Itoa(int(dgi.MessageType())))
 
 				// Send payload datagram to every available receiver
 				seekDgi := NewDatagramIterator(&obj.dg)
@@ -125,8 +175,7 @@ func (m *MessageDirector) queueLoop() {
 				finish <- true
 			}()
 			<-finish
-		case <-signalCh:
-			return
+			atomic.AddInt64(&m.pending, -1)
 		case <-core.StopChan:
 			return
 		}
@@ -183,6 +232,35 @@ func (m *MessageDirector) RecallPostRemoves(sender Channel_t) {
 	}
 }
 
+// Shutdown cleans up every participant that is still connected so that their post-removes are
+//  routed, then blocks until the queue has been drained and closes the capture file.
+func (m *MessageDirector) Shutdown() {
+	m.Lock()
+	participants := append([]MDParticipant{}, m.participants...)
+	m.Unlock()
+
+	for _, p := range participants {
+		if participant, ok := p.(*MDParticipantBase); ok && !participant.IsTerminated() {
+			participant.Cleanup()
+		}
+	}
+
+	m.Drain()
+
+	if m.capture != nil {
+		if err := m.capture.Close(); err != nil {
+			MDLog.Errorf("Failed to close capture file: %s", err)
+		}
+	}
+}
+
+// Drain blocks until every datagram in the queue has been routed, along with the one being routed.
+func (m *MessageDirector) Drain() {
+	for atomic.LoadInt64(&m.pending) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func (m *MessageDirector) RemoveParticipant(p MDParticipant) {
 	m.Lock()
 	for n, participant := range MD.participants {
@@ -6,7 +6,11 @@ import (
 	"astrongo/core"
 	. "astrongo/test"
 	. "astrongo/util"
+	"bytes"
 	"github.com/apex/log"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
 	"os"
 	"testing"
 	"time"
@@ -24,6 +28,7 @@ func TestMain(m *testing.M) {
 		core.ServerConfig{MessageDirector: struct {
 			Bind    string
 			Connect string
+			Capture string
 		}{Bind: "127.0.0.1:57123", Connect: "127.0.0.1:57124"}})
 	Start()
 
@@ -58,6 +63,82 @@ func TestMD_Single(t *testing.T) {
 	mainClient.Expect(t, *dg, false)
 }
 
+func TestMD_Capture(t *testing.T) {
+	file, err := ioutil.TempFile("", "capture")
+	require.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	capture, err := NewCapture(file.Name())
+	require.NoError(t, err)
+	MD.capture = capture
+
+	mainClient.Flush()
+	dg := (&TestDatagram{}).Create([]Channel_t{1234, 5678}, 4321, 1337)
+	dg.AddString("CAPTURED")
+	client1.SendDatagram(*dg)
+	mainClient.Expect(t, *dg, false)
+
+	MD.capture = nil
+	require.NoError(t, capture.Close())
+
+	data, err := ioutil.ReadFile(file.Name())
+	require.NoError(t, err)
+	reader, err := NewCaptureReader(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	record, err := reader.Next()
+	require.NoError(t, err)
+	require.Equal(t, "*messagedirector.MDNetworkParticipant", record.Sender)
+	require.Equal(t, dg.Bytes(), record.Datagram.Bytes())
+	require.WithinDuration(t, time.Now(), record.Time, time.Second)
+
+	_, err = reader.Next()
+	require.Equal(t, io.EOF, err)
+
+	// A record cut short ends the capture
+	reader, err = NewCaptureReader(bytes.NewReader(data[:len(data)-1]))
+	require.NoError(t, err)
+	_, err = reader.Next()
+	require.Equal(t, io.EOF, err)
+
+	_, err = NewCaptureReader(bytes.NewReader([]byte("ASTRONLOG\x01\x00")))
+	require.Error(t, err)
+}
+
+func TestMD_Drain(t *testing.T) {
+	file, err := ioutil.TempFile("", "capture")
+	require.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	capture, err := NewCapture(file.Name())
+	require.NoError(t, err)
+	MD.capture = capture
+
+	// Once drained, every queued datagram has been routed, including the last one taken off the queue
+	for n := 0; n < 100; n++ {
+		dg := (&TestDatagram{}).Create([]Channel_t{5678}, 4321, 1337)
+		dg.AddUint32(uint32(n))
+		MD.enqueue(*dg, nil)
+	}
+	MD.Drain()
+
+	MD.capture = nil
+	require.NoError(t, capture.Close())
+
+	data, err := ioutil.ReadFile(file.Name())
+	require.NoError(t, err)
+	reader, err := NewCaptureReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	for n := 0; n < 100; n++ {
+		_, err = reader.Next()
+		require.NoError(t, err)
+	}
+	_, err = reader.Next()
+	require.Equal(t, io.EOF, err)
+}
+
 func TestMD_Subscribe(t *testing.T) {
 	mainClient.Flush()
 	client1.Flush()
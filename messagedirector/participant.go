@@ -49,10 +49,7 @@ func (m *MDParticipantBase) Subscriber() *Subscriber {
 }
 
 func (m *MDParticipantBase) RouteDatagram(datagram Datagram) {
-	MD.Queue <- struct {
-		dg Datagram
-		md MDParticipant
-	}{datagram, m}
+	MD.enqueue(datagram, m)
 }
 
 func (m *MDParticipantBase) PostRemove() {
@@ -63,10 +63,7 @@ func (m *MDUpstream) HandleDatagram(datagram Datagram, dgi *DatagramIterator) {
 }
 
 func (m *MDUpstream) ReceiveDatagram(datagram Datagram) {
-	MD.Queue <- struct {
-		dg Datagram
-		md MDParticipant
-	}{datagram, nil}
+	MD.enqueue(datagram, nil)
 }
 
 func (m *MDUpstream) Terminate(err error) {
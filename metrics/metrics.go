@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"astrongo/core"
+	"fmt"
+	"github.com/apex/log"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+var MetricsLog *log.Entry
+
+var registry []Collector
+var registryLock sync.Mutex
+
+// Collector is anything that can write itself to the metrics endpoint in the Prometheus text format.
+type Collector interface {
+	Name() string
+	Write(io.Writer)
+}
+
+type metricType string
+
+const (
+	COUNTER metricType = "counter"
+	GAUGE   metricType = "gauge"
+)
+
+// Metric is a counter or gauge which is optionally partitioned by a single label, such as a msgtype
+//  or a dclass name. Metrics without a label always report a single sample.
+type Metric struct {
+	sync.Mutex
+
+	name  string
+	help  string
+	mtype metricType
+	label string
+
+	values map[string]float64
+}
+
+func newMetric(mtype metricType, name string, help string, label string) *Metric {
+	m := &Metric{name: name, help: help, mtype: mtype, label: label, values: make(map[string]float64)}
+	if label == "" {
+		m.values[""] = 0
+	}
+
+	Register(m)
+	return m
+}
+
+func NewCounter(name string, help string, label string) *Metric {
+	return newMetric(COUNTER, name, help, label)
+}
+
+func NewGauge(name string, help string, label string) *Metric {
+	return newMetric(GAUGE, name, help, label)
+}
+
+func (m *Metric) Name() string { return m.name }
+
+func (m *Metric) Add(label string, val float64) {
+	m.Lock()
+	m.values[label] += val
+	m.Unlock()
+}
+
+func (m *Metric) Set(label string, val float64) {
+	m.Lock()
+	m.values[label] = val
+	m.Unlock()
+}
+
+func (m *Metric) Inc(label string) { m.Add(label, 1) }
+func (m *Metric) Dec(label string) { m.Add(label, -1) }
+
+func (m *Metric) Value(label string) float64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.values[label]
+}
+
+func (m *Metric) Write(w io.Writer) {
+	m.Lock()
+	defer m.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.mtype)
+
+	labels := make([]string, 0, len(m.values))
+	for label := range m.values {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	for _, label := range labels {
+		if m.label == "" {
+			fmt.Fprintf(w, "%s %v\n", m.name, m.values[label])
+		} else {
+			fmt.Fprintf(w, "%s{%s=%q} %v\n", m.name, m.label, label, m.values[label])
+		}
+	}
+}
+
+// GaugeFunc is a gauge whose value is computed by a callback each time the endpoint is scraped; it
+//  is useful for values that are already tracked elsewhere, like the length of the MD queue.
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func NewGaugeFunc(name string, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	Register(g)
+	return g
+}
+
+func (g *GaugeFunc) Name() string { return g.name }
+
+func (g *GaugeFunc) Write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", g.name, g.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", g.name, GAUGE)
+	fmt.Fprintf(w, "%s %v\n", g.name, g.fn())
+}
+
+func Register(c Collector) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	for _, existing := range registry {
+		if existing.Name() == c.Name() {
+			MetricsLog.Fatalf("Metric %s was registered twice", c.Name())
+			return
+		}
+	}
+
+	registry = append(registry, c)
+}
+
+func WriteAll(w io.Writer) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	for _, c := range registry {
+		c.Write(w)
+	}
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	WriteAll(w)
+}
+
+func Start() {
+	bindAddr := core.Config.Metrics.Bind
+	if bindAddr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", handleMetrics)
+
+	go func() {
+		MetricsLog.Infof("Opened metrics endpoint at http://%s/metrics", bindAddr)
+		if err := http.ListenAndServe(bindAddr, mux); err != nil {
+			MetricsLog.Errorf("Metrics endpoint closed: %s", err)
+		}
+	}()
+}
+
+func init() {
+	MetricsLog = log.WithFields(log.Fields{
+		"name": "Metrics",
+	})
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"astrongo/core"
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetric_Write(t *testing.T) {
+	counter := NewCounter("test_routed_total", "Test counter.", "msgtype")
+	counter.Inc("2020")
+	counter.Add("2020", 2)
+	counter.Inc("1000")
+
+	gauge := NewGauge("test_objects", "Test gauge.", "")
+	gauge.Inc("")
+	gauge.Inc("")
+	gauge.Dec("")
+
+	out := &bytes.Buffer{}
+	counter.Write(out)
+	gauge.Write(out)
+	require.Equal(t, "# HELP test_routed_total Test counter.\n"+
+		"# TYPE test_routed_total counter\n"+
+		"test_routed_total{msgtype=\"1000\"} 1\n"+
+		"test_routed_total{msgtype=\"2020\"} 3\n"+
+		"# HELP test_objects Test gauge.\n"+
+		"# TYPE test_objects gauge\n"+
+		"test_objects 1\n", out.String())
+}
+
+func TestMetrics_Endpoint(t *testing.T) {
+	NewGaugeFunc("test_queue_length", "Test gauge function.", func() float64 { return 42 })
+
+	core.Config = &core.ServerConfig{}
+	core.Config.Metrics.Bind = "127.0.0.1:57150"
+	Start()
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get("http://127.0.0.1:57150/metrics")
+	if err != nil {
+		t.Fatalf("failed to query metrics endpoint: %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	require.True(t, strings.Contains(string(body), "test_queue_length 42\n"))
+}
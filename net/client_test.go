@@ -99,5 +99,5 @@ func init() {
 		keepAlive: 60 * time.Second,
 	}
 	participant = &MDParticipantFake{}
-	netclient = NewClient(Transport(ssocket), participant)
+	netclient = NewClient(Transport(ssocket), participant, 60*time.Second)
 }
@@ -5,10 +5,7 @@ package net
 import (
 	"astrongo/core"
 	"net"
-	"os"
-	"os/signal"
 	"sync/atomic"
-	"syscall"
 	"time"
 )
 
@@ -50,7 +47,7 @@ func (s *NetworkServer) listenConn(address string, errChan chan error) error {
 	s.ln = ln
 
 	errChan <- nil
-	s.handleInterrupts()
+	s.handleStop()
 	atomic.StoreUint32(&s.listening, 1)
 	for atomic.LoadUint32(&s.listening) == 1 {
 		conn, err := ln.Accept()
@@ -62,16 +59,12 @@ func (s *NetworkServer) listenConn(address string, errChan chan error) error {
 	return nil
 }
 
-func (s *NetworkServer) handleInterrupts() {
-	c := make(chan os.Signal)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+// Signals are handled by the daemon, which shuts down each server in order; the stop channel
+//  is only used to tear servers down between tests.
+func (s *NetworkServer) handleStop() {
 	go func() {
-		select {
-		case <-c:
-			s.Shutdown()
-		case <-core.StopChan:
-			s.Shutdown()
-		}
+		<-core.StopChan
+		s.Shutdown()
 	}()
 }
 
@@ -1,7 +1,9 @@
 package stateserver
 
 import (
+	"astrongo/core"
 	"astrongo/dclass/dc"
+	"astrongo/eventlogger"
 	"astrongo/messagedirector"
 	. "astrongo/util"
 	"bytes"
@@ -344,9 +346,18 @@ func (d *DistributedObject) annihilate(sender Channel_t, notifyParent bool) {
 	d.RouteDatagram(dg)
 
 	d.deleteChildren(sender)
+	d.stateserver.objectsLock.Lock()
 	delete(d.stateserver.objects, d.do)
+	d.stateserver.objectsLock.Unlock()
+	objectCount.Dec(d.dclass.Name())
 	d.log.Debug("Deleted object.")
 
+	event := eventlogger.NewLoggedEvent(eventlogger.EVENT_OBJECT_DELETED, "")
+	event.AddDoid("doid", d.do)
+	event.Add("dclass", d.dclass.Name())
+	event.AddChannel("deleted_by", sender)
+	d.stateserver.logEvent(event)
+
 	d.Cleanup()
 }
 
@@ -390,8 +401,19 @@ func (d *DistributedObject) handleOneUpdate(dgi *DatagramIterator, sender Channe
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				if _, ok := r.(DatagramIteratorEOF); ok {
+				switch r := r.(type) {
+				case DatagramIteratorEOF:
 					d.log.Errorf("Received truncated update for field %s", field.Name())
+				case FieldConstraintViolation:
+					d.log.Errorf("Received invalid update for field %s: %s", field.Name(), r.Error())
+
+					event := eventlogger.NewLoggedEvent(eventlogger.EVENT_FIELD_VIOLATION, "")
+					event.AddDoid("doid", d.do)
+					event.Add("dclass", d.dclass.Name())
+					event.Add("field", field.Name())
+					event.AddChannel("from", sender)
+					event.Add("reason", r.Error())
+					d.stateserver.logEvent(event)
 				}
 				finish <- false
 			}
@@ -490,6 +512,10 @@ func (d *DistributedObject) HandleDatagram(dg Datagram, dgi *DatagramIterator) {
 		}
 	}()
 
+	if core.TraceEnabled() {
+		core.TraceDatagram(fmt.Sprintf("%s (%d)", d.dclass.Name(), d.do), dg)
+	}
+
 	sender := dgi.ReadChannel()
 	msgType := dgi.ReadUint16()
 
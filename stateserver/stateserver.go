@@ -2,18 +2,27 @@ package stateserver
 
 import (
 	"astrongo/core"
+	"astrongo/eventlogger"
 	"astrongo/messagedirector"
+	"astrongo/metrics"
 	. "astrongo/util"
 	"fmt"
 	"github.com/apex/log"
+	"sync"
 )
 
+var objectCount = metrics.NewGauge("astron_stateserver_objects",
+	"Number of objects hosted by the StateServer.", "dclass")
+
 type StateServer struct {
 	messagedirector.MDParticipantBase
 
-	config  core.Role
-	log     *log.Entry
-	objects map[Doid_t]*DistributedObject
+	config core.Role
+	log    *log.Entry
+
+	// Objects are created and deleted from the goroutines which the MD routes datagrams on
+	objectsLock sync.Mutex
+	objects     map[Doid_t]*DistributedObject
 }
 
 func NewStateServer(config core.Role) *StateServer {
@@ -41,30 +50,50 @@ func (s *StateServer) handleGenerate(dgi *DatagramIterator, other bool) {
 	zone := dgi.ReadZone()
 	dc := dgi.ReadUint16()
 
-	if _, ok := s.objects[do]; ok {
+	s.objectsLock.Lock()
+	_, exists := s.objects[do]
+	s.objectsLock.Unlock()
+	if exists {
 		s.log.Warnf("Received generate for already-existing object ID=%d", do)
 		return
 	}
 
-	dclass, ok := core.DC.Class(int(dc))
+	dclass, ok := core.Current().DC.Class(int(dc))
 	if !ok {
 		s.log.Errorf("Received create for unknown dclass id %d", dc)
 		return
 	}
 
 	obj := NewDistributedObject(s, do, parent, zone, dclass, dgi, other)
+	s.objectsLock.Lock()
 	s.objects[do] = obj
+	s.objectsLock.Unlock()
+	objectCount.Inc(dclass.Name())
+
+	event := eventlogger.NewLoggedEvent(eventlogger.EVENT_OBJECT_CREATED, "")
+	event.AddDoid("doid", do)
+	event.Add("dclass", dclass.Name())
+	event.AddDoid("parent", parent)
+	event.AddZone("zone", zone)
+	s.logEvent(event)
+}
+
+func (s *StateServer) logEvent(event eventlogger.LoggedEvent) {
+	event.Add("sender", fmt.Sprintf("StateServer: %d", s.config.Control))
+	event.Send()
 }
 
 func (s *StateServer) handleDelete(dgi *DatagramIterator, sender Channel_t) {
 	var targets []Channel_t
 	ai := dgi.ReadChannel()
 
+	s.objectsLock.Lock()
 	for do, obj := range s.objects {
 		if obj.aiChannel == ai && obj.explicitAi {
 			targets = append(targets, Channel_t(do))
 		}
 	}
+	s.objectsLock.Unlock()
 
 	if len(targets) > 0 {
 		dg := NewDatagram()
@@ -74,6 +103,26 @@ func (s *StateServer) handleDelete(dgi *DatagramIterator, sender Channel_t) {
 	}
 }
 
+// Shutdown deletes every object hosted by the StateServer, which notifies their AI, owner and
+//  location of the deletion.
+func (s *StateServer) Shutdown() {
+	s.objectsLock.Lock()
+	objects := make([]*DistributedObject, 0, len(s.objects))
+	for _, obj := range s.objects {
+		objects = append(objects, obj)
+	}
+	s.objectsLock.Unlock()
+
+	s.log.Infof("Deleting %d objects for shutdown", len(objects))
+	for _, obj := range objects {
+		obj.Lock()
+		if !obj.IsTerminated() {
+			obj.annihilate(Channel_t(s.config.Control), false)
+		}
+		obj.Unlock()
+	}
+}
+
 func (s *StateServer) HandleDatagram(dg Datagram, dgi *DatagramIterator) {
 	defer func() {
 		if r := recover(); r != nil {
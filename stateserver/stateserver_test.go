@@ -58,6 +58,7 @@ func TestMain(m *testing.M) {
 		core.ServerConfig{MessageDirector: struct {
 			Bind    string
 			Connect string
+			Capture string
 		}{Bind: "127.0.0.1:57123"},
 			General: struct {
 				Eventlogger string
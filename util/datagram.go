@@ -1,6 +1,7 @@
 package util
 
 import (
+	"astrongo/dclass/dc"
 	"bytes"
 	"encoding/binary"
 )
@@ -54,6 +55,17 @@ func (d *Datagram) AddBlob(v *Datagram) {
 	d.Write(v.Bytes())
 }
 
+// AddValue packs a tree of Go values as a field, as described by dc.Pack.
+func (d *Datagram) AddValue(field dc.Field, value interface{}) error {
+	data, err := dc.Pack(field, value)
+	if err != nil {
+		return err
+	}
+
+	d.Write(data)
+	return nil
+}
+
 func (d *Datagram) AddServerHeader(to Channel_t, from Channel_t, messageType uint16) {
 	d.AddUint8(1)
 	d.AddChannel(to)
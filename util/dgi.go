@@ -16,6 +16,9 @@ type FieldConstraintViolation struct {
 	err string
 }
 
+func (e DatagramIteratorEOF) Error() string      { return e.err }
+func (e FieldConstraintViolation) Error() string { return e.err }
+
 type DatagramIterator struct {
 	Dg     *Datagram
 	offset Dgsize_t
@@ -252,6 +255,17 @@ func (dgi *DatagramIterator) UnpackField(field dc.Field, buffer *bytes.Buffer) {
 	dgi.UnpackDtype(field.FieldType(), buffer)
 }
 
+// UnpackValue reads a field as a tree of Go values, as described by dc.Unpack.
+func (dgi *DatagramIterator) UnpackValue(field dc.Field) interface{} {
+	value, size, err := dc.Unpack(field, dgi.Dg.Bytes()[dgi.offset:])
+	if err != nil {
+		panic(FieldConstraintViolation{fmt.Sprintf("field constraint violation: %s", err)})
+	}
+
+	dgi.Skip(Dgsize_t(size))
+	return value
+}
+
 func (dgi *DatagramIterator) UnpackDtype(dtype dc.BaseType, buffer *bytes.Buffer) {
 	fixed := (dtype.Type() == dc.T_METHOD || dtype.Type() == dc.T_STRUCT) && dtype.HasRange()
 
@@ -320,9 +334,31 @@ func (dgi *DatagramIterator) UnpackDtype(dtype dc.BaseType, buffer *bytes.Buffer
 		for n := 0; n < params; n++ {
 			dgi.UnpackDtype(method.GetParameter(n).Type(), buffer)
 		}
+	case dc.T_SWITCH:
+		sw := dtype.(*dc.SwitchType)
+		keyDgi := dgi.Copy()
+		dgi.UnpackDtype(sw.Key(), buffer)
+
+		c := dgi.switchCase(sw, keyDgi.ReadData(dgi.Tell()-keyDgi.Tell()))
+		fields := c.GetNumFields()
+		for n := 0; n < fields; n++ {
+			dgi.UnpackDtype(c.GetField(n).FieldType(), buffer)
+		}
 	}
 }
 
+// switchCase selects the case of a switch matching the given key, as read from the datagram.
+func (dgi *DatagramIterator) switchCase(sw *dc.SwitchType, key []byte) *dc.SwitchCase {
+	c, ok := sw.CaseByValue(key)
+	if !ok {
+		panic(FieldConstraintViolation{
+			fmt.Sprintf("field constraint violation: no case of switch %s matches key %x", sw.Name(), key),
+		})
+	}
+
+	return c
+}
+
 func (dgi *DatagramIterator) SkipField(field dc.Field) {
 	dgi.SkipDtype(field.FieldType())
 }
@@ -354,6 +390,16 @@ func (dgi *DatagramIterator) SkipDtype(dtype dc.BaseType) {
 		for n := 0; n < params; n++ {
 			dgi.SkipDtype(method.GetParameter(n).Type())
 		}
+	case dc.T_SWITCH:
+		sw := dtype.(*dc.SwitchType)
+		keyDgi := dgi.Copy()
+		dgi.SkipDtype(sw.Key())
+
+		c := dgi.switchCase(sw, keyDgi.ReadData(dgi.Tell()-keyDgi.Tell()))
+		fields := c.GetNumFields()
+		for n := 0; n < fields; n++ {
+			dgi.SkipDtype(c.GetField(n).FieldType())
+		}
 	}
 }
 
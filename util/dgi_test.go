@@ -1,6 +1,7 @@
 package util
 
 import (
+	"astrongo/dclass/dc"
 	"astrongo/dclass/parse"
 	"bytes"
 	"github.com/stretchr/testify/require"
@@ -161,3 +162,93 @@ func TestDatagramIterator_Unpack(t *testing.T) {
 		t.Errorf(err)
 	}
 }
+
+func TestDatagramIterator_UnpackSwitch(t *testing.T) {
+	dct, err := parse.ParseFile("util/test.dc")
+	if err != nil {
+		t.Fatalf("test dclass parse failed: %s", err)
+	}
+
+	dcf := dct.Traverse()
+	cls, _ := dcf.ClassByName("switches")
+	setShape, _ := cls.GetFieldByName("setShape")
+	setNamed, _ := cls.GetFieldByName("setNamed")
+
+	dg := NewDatagram()
+	dg.AddUint8(2)
+	dg.AddUint16(640)
+	dg.AddUint16(480)
+	dg.AddUint8(7)
+	dg.AddString("triangle")
+	dg.AddUint8(0)
+	dg.AddUint16(12)
+	dg.AddString("ab")
+	dg.AddInt8(-1)
+
+	dgi := NewDatagramIterator(&dg)
+	require.Equal(t, []byte{2, 128, 2, 224, 1}, dgi.UnpackFieldtoUint8(setShape))
+	require.Equal(t, []byte{7, 8, 0, 0, 0, 't', 'r', 'i', 'a', 'n', 'g', 'l', 'e'}, dgi.UnpackFieldtoUint8(setShape))
+	dgi.SkipField(setShape)
+	require.Equal(t, []byte{2, 0, 0, 0, 'a', 'b', 255}, dgi.UnpackFieldtoUint8(setNamed))
+	require.EqualValues(t, dg.Len(), dgi.Tell())
+
+	dg = NewDatagram()
+	dg.AddString("cd")
+	dgi = NewDatagramIterator(&dg)
+	require.Panics(t, func() { dgi.SkipField(setNamed) })
+}
+
+func TestDatagramIterator_UnpackValue(t *testing.T) {
+	dct, err := parse.ParseFile("util/test.dc")
+	if err != nil {
+		t.Fatalf("test dclass parse failed: %s", err)
+	}
+
+	dcf := dct.Traverse()
+	cls, _ := dcf.ClassByName("values")
+	field := func(name string) dc.Field {
+		field, _ := cls.GetFieldByName(name)
+		return field
+	}
+
+	dg := NewDatagram()
+	require.NoError(t, dg.AddValue(field("setPos"), []interface{}{[]float64{1.5, -2}, -90}))
+	require.NoError(t, dg.AddValue(field("setName"), []interface{}{"Bob", "B"}))
+	require.NoError(t, dg.AddValue(field("setPath"), []interface{}{
+		[]interface{}{[]interface{}{0.1, 0.2}}, []byte{1, 2, 3},
+	}))
+	require.NoError(t, dg.AddValue(field("setPairs"), []interface{}{
+		[]interface{}{[]interface{}{uint32(100000), 7}},
+	}))
+	require.NoError(t, dg.AddValue(field("setScale"), []interface{}{1.25}))
+
+	dgi := NewDatagramIterator(&dg)
+	require.Equal(t, []byte{15, 0, 236, 255, 14, 1}, dgi.Copy().ReadData(6))
+	require.Equal(t, []interface{}{[]interface{}{1.5, -2.0}, uint64(270)}, dgi.UnpackValue(field("setPos")))
+	require.Equal(t, []interface{}{"Bob", "B"}, dgi.UnpackValue(field("setName")))
+	require.Equal(t, []interface{}{
+		[]interface{}{[]interface{}{0.1, 0.2}}, []byte{1, 2, 3},
+	}, dgi.UnpackValue(field("setPath")))
+	require.Equal(t, []interface{}{
+		[]interface{}{[]interface{}{uint64(100000), uint64(7)}},
+	}, dgi.UnpackValue(field("setPairs")))
+	require.Equal(t, []interface{}{1.25}, dgi.UnpackValue(field("setScale")))
+	require.EqualValues(t, dg.Len(), dgi.Tell())
+
+	dg = NewDatagram()
+	require.EqualError(t, dg.AddValue(field("setName"), []interface{}{"Too long a name", "T"}),
+		"setName: name: length 15 is outside of the range 0-8")
+	require.EqualError(t, dg.AddValue(field("setName"), []interface{}{"Bob"}),
+		"setName: expected 2 values, got 1")
+	require.EqualError(t, dg.AddValue(field("setPos"), []interface{}{[]interface{}{4000, 0}, 0}),
+		"setPos: pos: x: value 4000 does not fit in a int16")
+	require.EqualError(t, dg.AddValue(field("setScale"), []interface{}{2.5}),
+		"setScale: scale: value 2.5 is outside of the range 0-2")
+	require.EqualError(t, dg.AddValue(field("setPairs"), []interface{}{[]interface{}{[]interface{}{-1, 0}}}),
+		"setPairs: [0]: [0]: [0]: value -1 does not fit in a uint32")
+
+	dg = NewDatagram()
+	dg.AddFloat64(300)
+	dgi = NewDatagramIterator(&dg)
+	require.Panics(t, func() { dgi.UnpackValue(field("setScale")) })
+}